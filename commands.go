@@ -0,0 +1,241 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/cszczepaniak/go-istage/git"
+	"github.com/cszczepaniak/go-istage/history"
+	"github.com/cszczepaniak/go-istage/patch"
+	"github.com/cszczepaniak/go-istage/recovery"
+	"github.com/cszczepaniak/go-istage/server"
+	"github.com/cszczepaniak/go-istage/services"
+)
+
+const (
+	exitOK = iota
+	exitFailure
+	exitUsage
+	exitNothingToApply
+)
+
+func runCommand(
+	args []string,
+	ps *services.PatchingService,
+	ds *services.DocumentService,
+	gs git.Backend,
+	backups *recovery.Store,
+) int {
+	switch args[0] {
+	case `stage`:
+		return runPatchCommand(args, patch.Stage, ds.UnstagedChanges, ps)
+	case `unstage`:
+		return runPatchCommand(args, patch.Unstage, ds.StagedChanges, ps)
+	case `reset`:
+		return runPatchCommand(args, patch.Reset, ds.UnstagedChanges, ps)
+	case `dump`:
+		return runDumpCommand(args, ds)
+	case `undo`:
+		return runHistoryCommand(args[0], ps.Undo, history.ErrNothingToUndo)
+	case `redo`:
+		return runHistoryCommand(args[0], ps.Redo, history.ErrNothingToRedo)
+	case `backups`:
+		return runBackupsCommand(backups)
+	case `restore`:
+		return runRestoreCommand(args, ps, backups)
+	case `serve`:
+		return runServeCommand(ps, ds, gs)
+	}
+
+	fmt.Fprintf(os.Stderr, "unknown command %q\n", args[0])
+	usage()
+	return exitUsage
+}
+
+func runPatchCommand(
+	args []string,
+	dir patch.Direction,
+	getDoc func() (patch.Document, error),
+	ps *services.PatchingService,
+) int {
+	name := args[0]
+
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	linesArg := make(lines, 0)
+	fs.TextVar(&linesArg, `lines`, &lines{}, `comma-separated indices of the lines to `+name)
+
+	err := fs.Parse(args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return exitOK
+	} else if err != nil {
+		return exitUsage
+	}
+
+	if len(linesArg) == 0 {
+		fmt.Fprintf(os.Stderr, "%s: no lines given\n", name)
+		return exitUsage
+	}
+
+	doc, err := getDoc()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: failed to load changes: %s\n", name, err)
+		return exitFailure
+	}
+
+	hasChanges := false
+	for _, l := range linesArg {
+		if l < 0 || l >= len(doc.Lines) {
+			fmt.Fprintf(os.Stderr, "%s: line %d is out of range (document has %d lines)\n", name, l, len(doc.Lines))
+			return exitUsage
+		}
+		if doc.Lines[l].Kind.IsAdditionOrRemoval() {
+			hasChanges = true
+		}
+	}
+
+	if !hasChanges {
+		fmt.Fprintf(os.Stderr, "%s: none of the given lines are additions or removals\n", name)
+		return exitNothingToApply
+	}
+
+	err = ps.ApplyPatch(dir, doc, linesArg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", name, err)
+		return exitFailure
+	}
+
+	return exitOK
+}
+
+func runDumpCommand(args []string, ds *services.DocumentService) int {
+	name := args[0]
+
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	staged := fs.Bool(`staged`, false, `dump the staged changes instead of the unstaged changes`)
+	pretty := fs.Bool(`pretty`, false, `indent the JSON output`)
+
+	err := fs.Parse(args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return exitOK
+	} else if err != nil {
+		return exitUsage
+	}
+
+	getDoc := ds.UnstagedChanges
+	if *staged {
+		getDoc = ds.StagedChanges
+	}
+
+	doc, err := getDoc()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: failed to load changes: %s\n", name, err)
+		return exitFailure
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	if *pretty {
+		enc.SetIndent(``, `  `)
+	}
+
+	err = enc.Encode(doc)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", name, err)
+		return exitFailure
+	}
+
+	return exitOK
+}
+
+func runHistoryCommand(name string, do func() error, nothingToDo error) int {
+	err := do()
+	if errors.Is(err, nothingToDo) {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", name, err)
+		return exitNothingToApply
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", name, err)
+		return exitFailure
+	}
+	return exitOK
+}
+
+func runBackupsCommand(backups *recovery.Store) int {
+	bs, err := backups.List()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "backups: %s\n", err)
+		return exitFailure
+	}
+
+	for i, b := range bs {
+		fmt.Printf("%d\t%s\t%.7s\t%s\n", i, b.Time.Format(`2006-01-02 15:04:05`), b.BlobID, strings.Join(b.Paths, `, `))
+	}
+	return exitOK
+}
+
+func runRestoreCommand(args []string, ps *services.PatchingService, backups *recovery.Store) int {
+	name := args[0]
+
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	printOnly := fs.Bool(`print`, false, `print the backed up patch instead of restoring it`)
+
+	err := fs.Parse(args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return exitOK
+	} else if err != nil {
+		return exitUsage
+	}
+
+	if fs.NArg() != 1 {
+		fmt.Fprintf(os.Stderr, "%s: expected the number of a backup\n", name)
+		return exitUsage
+	}
+
+	n, err := strconv.Atoi(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: invalid backup number %q\n", name, fs.Arg(0))
+		return exitUsage
+	}
+
+	bs, err := backups.List()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", name, err)
+		return exitFailure
+	}
+
+	if n < 0 || n >= len(bs) {
+		fmt.Fprintf(os.Stderr, "%s: no backup number %d (there are %d)\n", name, n, len(bs))
+		return exitUsage
+	}
+
+	content, err := backups.Load(bs[n])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", name, err)
+		return exitFailure
+	}
+
+	if *printOnly {
+		fmt.Print(content)
+		return exitOK
+	}
+
+	err = ps.Restore(content)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", name, err)
+		return exitFailure
+	}
+
+	return exitOK
+}
+
+func runServeCommand(ps *services.PatchingService, ds *services.DocumentService, gs git.Backend) int {
+	err := server.New(ds, ps, ps, gs).Serve(os.Stdin, os.Stdout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "serve: %s\n", err)
+		return exitFailure
+	}
+	return exitOK
+}
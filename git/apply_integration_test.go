@@ -0,0 +1,256 @@
+package git
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/cszczepaniak/go-istage/nolibgit"
+	"github.com/cszczepaniak/go-istage/patch"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// linesWithText returns the indices of the lines of the document with the given texts, prefix included.
+func linesWithText(doc patch.Document, texts ...string) []int {
+	var res []int
+	for i, l := range doc.Lines {
+		for _, txt := range texts {
+			if l.Text == txt {
+				res = append(res, i)
+			}
+		}
+	}
+	return res
+}
+
+func computePatch(t *testing.T, changes []string, dir patch.Direction, texts ...string) string {
+	doc := patch.ParseDocument(changes)
+	p, err := patch.Compute(doc, linesWithText(doc, texts...), dir)
+	require.NoError(t, err)
+	return p
+}
+
+func TestApplyPatch(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, newClient newClientFunc) {
+		r := NewTestRepo(t)
+
+		f := r.MakeFile(t, `a.txt`).Add("1\n2\n3\n4\n5").ShouldCommit(`abc`).Build()
+		f.Replace("1\ntwo\n3\n4\nfive\nsix\n")
+
+		gc, err := newClient(r.env)
+		require.NoError(t, err)
+
+		unstaged, err := gc.UnstagedChanges(DefaultDiffOptions())
+		require.NoError(t, err)
+		stage := computePatch(t, unstaged, patch.Stage, `-2`, `+two`, `-5`, `+five`)
+		require.NoError(t, gc.ApplyPatch(stage, patch.Stage))
+
+		staged, err := gc.StagedChanges(DefaultDiffOptions())
+		require.NoError(t, err)
+		require.Len(t, staged, 1)
+		assert.Contains(t, staged[0], "-2\n+two\n")
+		assert.Contains(t, staged[0], "-5\n\\ No newline at end of file\n+five\n")
+		assert.NotContains(t, staged[0], `six`)
+
+		require.NoError(t, gc.UnapplyPatch(stage, patch.Stage))
+		staged, err = gc.StagedChanges(DefaultDiffOptions())
+		require.NoError(t, err)
+		assert.Empty(t, staged)
+
+		require.NoError(t, gc.ApplyPatch(stage, patch.Stage))
+		staged, err = gc.StagedChanges(DefaultDiffOptions())
+		require.NoError(t, err)
+		unstage := computePatch(t, staged, patch.Unstage, `-2`, `+two`)
+		require.NoError(t, gc.ApplyPatch(unstage, patch.Unstage))
+
+		staged, err = gc.StagedChanges(DefaultDiffOptions())
+		require.NoError(t, err)
+		require.Len(t, staged, 1)
+		assert.NotContains(t, staged[0], `two`)
+		assert.Contains(t, staged[0], "+five\n")
+
+		unstaged, err = gc.UnstagedChanges(DefaultDiffOptions())
+		require.NoError(t, err)
+		reset := computePatch(t, unstaged, patch.Reset, `+six`)
+		require.NoError(t, gc.ApplyPatch(reset, patch.Reset))
+
+		bs, err := os.ReadFile(`a.txt`)
+		require.NoError(t, err)
+		assert.Equal(t, "1\ntwo\n3\n4\nfive\n", string(bs))
+
+		require.NoError(t, gc.UnapplyPatch(reset, patch.Reset))
+		bs, err = os.ReadFile(`a.txt`)
+		require.NoError(t, err)
+		assert.Equal(t, "1\ntwo\n3\n4\nfive\nsix\n", string(bs))
+	})
+}
+
+func TestApplyPatchToNewFile(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, newClient newClientFunc) {
+		r := NewTestRepo(t)
+		r.MakeFile(t, `a b.txt`).AddLine(`x`).AddLine(`y`).Build()
+
+		gc, err := newClient(r.env)
+		require.NoError(t, err)
+
+		unstaged, err := gc.UnstagedChanges(DefaultDiffOptions())
+		require.NoError(t, err)
+		stage := computePatch(t, unstaged, patch.Stage, `+x`, `+y`)
+		require.NoError(t, gc.ApplyPatch(stage, patch.Stage))
+
+		staged, err := gc.StagedFiles()
+		require.NoError(t, err)
+		assert.Equal(t, []File{{Path: `a b.txt`, Status: FileStatusAdded}}, staged)
+
+		require.NoError(t, gc.UnapplyPatch(stage, patch.Stage))
+		staged, err = gc.StagedFiles()
+		require.NoError(t, err)
+		assert.Empty(t, staged)
+	})
+}
+
+func TestApplyPartialPatchToNewFile(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, newClient newClientFunc) {
+		r := NewTestRepo(t)
+		r.MakeFile(t, `a.txt`).AddLine(`a`).AddLine(`b`).AddLine(`c`).ShouldStage().Build()
+		r.MakeFile(t, `b.txt`).AddLine(`x`).AddLine(`y`).AddLine(`z`).Build()
+
+		gc, err := newClient(r.env)
+		require.NoError(t, err)
+
+		staged, err := gc.StagedChanges(DefaultDiffOptions())
+		require.NoError(t, err)
+		unstage := computePatch(t, staged, patch.Unstage, `+b`)
+		require.NoError(t, gc.ApplyPatch(unstage, patch.Unstage))
+
+		staged, err = gc.StagedChanges(DefaultDiffOptions())
+		require.NoError(t, err)
+		require.Len(t, staged, 1)
+		assert.Contains(t, staged[0], "new file mode 100644\n")
+		assert.Contains(t, staged[0], "+a\n+c\n")
+
+		unstaged, err := gc.UnstagedChanges(DefaultDiffOptions())
+		require.NoError(t, err)
+		reset := computePatch(t, unstaged, patch.Reset, `+y`)
+		require.NoError(t, gc.ApplyPatch(reset, patch.Reset))
+
+		bs, err := os.ReadFile(`b.txt`)
+		require.NoError(t, err)
+		assert.Equal(t, "x\nz\n", string(bs))
+	})
+}
+
+func TestApplyPatchChecksAnchors(t *testing.T) {
+	r := NewTestRepo(t)
+	f := r.MakeFile(t, `a.txt`).Add("x\ny\nz\n").ShouldCommit(`abc`).Build()
+	f.Replace("new\nx\ny\nz\n")
+
+	gc, err := NewExecClient(r.env)
+	require.NoError(t, err)
+
+	unstaged, err := gc.UnstagedChanges(DefaultDiffOptions())
+	require.NoError(t, err)
+	stage := computePatch(t, unstaged, patch.Stage, `+new`)
+	assert.False(t, lacksContext(stage))
+
+	// The patch adds a line at the start of the file, so it must not apply anywhere else once the start changed.
+	f.Replace("w\nx\ny\nz\n")
+	r.Add(`a.txt`)
+	assert.Error(t, gc.ApplyPatch(stage, patch.Stage))
+
+	bs, err := os.ReadFile(`a.txt`)
+	require.NoError(t, err)
+	assert.Equal(t, "w\nx\ny\nz\n", string(bs))
+	staged, err := gc.StagedChanges(DefaultDiffOptions())
+	require.NoError(t, err)
+	require.Len(t, staged, 1)
+	assert.NotContains(t, staged[0], `new`)
+}
+
+// TestGitPatch checks the patches libgit2 is given by having git apply them, so that they are known to mean the same
+// as the patches they come from even in builds without libgit2.
+func TestGitPatch(t *testing.T) {
+	r := NewTestRepo(t)
+
+	f := r.MakeFile(t, `a.txt`).Add("1\n2\n3").ShouldCommit(`abc`).Build()
+	f.Replace("1\n-- 2\n3\n4\n")
+	r.MakeFile(t, `b.txt`).AddLine(`x`).Build()
+	require.NoError(t, Exec(r.env, `add`).WithArgs(`--intent-to-add`, `b.txt`).Run())
+
+	var out strings.Builder
+	require.NoError(t, Exec(r.env, `diff`).WithArgs(`--no-color`, `--unified=0`).WithStdout(&out).Run())
+	changes := splitPatches(out.String())
+	require.Len(t, changes, 2)
+
+	apply := func(p string, args ...string) {
+		if lacksContext(p) {
+			args = append(args, `--unidiff-zero`)
+		}
+		err := Exec(r.env, `apply`).WithArgs(args...).WithStdin(strings.NewReader(p)).Run()
+		require.NoError(t, err)
+	}
+	diff := func(args ...string) string {
+		var out strings.Builder
+		require.NoError(t, Exec(r.env, `diff`).WithArgs(args...).WithStdout(&out).Run())
+		return out.String()
+	}
+
+	stage := computePatch(t, changes, patch.Stage, `-2`, `+-- 2`, `-3`, `+3`, `+4`, `+x`)
+	forward, err := gitPatch(stage, false)
+	require.NoError(t, err)
+	assert.Contains(t, forward, "diff --git a/b.txt b/b.txt\nnew file mode 100644\n--- /dev/null\n+++ b/b.txt\n")
+
+	apply(forward, `--cached`)
+	assert.Empty(t, diff(), `everything should be staged`)
+
+	backward, err := gitPatch(stage, true)
+	require.NoError(t, err)
+	assert.Contains(t, backward, "diff --git a/b.txt b/b.txt\ndeleted file mode 100644\n--- a/b.txt\n+++ /dev/null\n")
+	assert.Contains(t, backward, "@@ -2,3 +2,2 @@\n+2\n+3\n\\ No newline at end of file\n--- 2\n-3\n-4\n")
+
+	apply(backward, `--cached`)
+	assert.Empty(t, diff(`--cached`), `nothing should be staged`)
+
+	reset := computePatch(t, changes[:1], patch.Reset, `+4`)
+	backward, err = gitPatch(reset, true)
+	require.NoError(t, err)
+	apply(backward)
+
+	bs, err := os.ReadFile(`a.txt`)
+	require.NoError(t, err)
+	assert.Equal(t, "1\n-- 2\n3\n", string(bs))
+}
+
+func BenchmarkApplyPatch(b *testing.B) {
+	for _, tb := range testBackends() {
+		tb := tb
+		b.Run(tb.String(), func(b *testing.B) {
+			r := NewTestRepo(b)
+
+			var sb strings.Builder
+			for i := 0; i < 1000; i++ {
+				sb.WriteString("line\n")
+			}
+			f := r.MakeFile(b, `a.txt`).Add(sb.String()).ShouldCommit(`abc`).Build()
+			f.Append("new\n")
+
+			env, err := nolibgit.LoadEnvironment()
+			require.NoError(b, err)
+			gc, err := tb.newClient(env)
+			require.NoError(b, err)
+
+			unstaged, err := gc.UnstagedChanges(DefaultDiffOptions())
+			require.NoError(b, err)
+			doc := patch.ParseDocument(unstaged)
+			p, err := patch.Compute(doc, linesWithText(doc, `+new`), patch.Stage)
+			require.NoError(b, err)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				require.NoError(b, gc.ApplyPatch(p, patch.Stage))
+				require.NoError(b, gc.UnapplyPatch(p, patch.Stage))
+			}
+		})
+	}
+}
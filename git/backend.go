@@ -0,0 +1,91 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/cszczepaniak/go-istage/nolibgit"
+	"github.com/cszczepaniak/go-istage/patch"
+)
+
+// Backend is everything go-istage reads from and does to a repository. Client reads the repository with libgit2, and
+// ExecClient with the git executable; both change it by running git.
+type Backend interface {
+	Root() string
+	Branch() (BranchInfo, error)
+	// LimitToPaths restricts the files and changes reported to the ones matching the given pathspecs, which are
+	// relative to the root of the working tree.
+	LimitToPaths(pathspec []string)
+
+	UnstagedFiles() ([]File, error)
+	StagedFiles() ([]File, error)
+	// UnstagedChanges and StagedChanges return a patch per changed file.
+	UnstagedChanges(opts DiffOptions) ([]string, error)
+	StagedChanges(opts DiffOptions) ([]string, error)
+	// UnstagedStats and StagedStats count what UnstagedChanges and StagedChanges would return.
+	UnstagedStats(opts DiffOptions) (DiffStats, error)
+	StagedStats(opts DiffOptions) (DiffStats, error)
+
+	ApplyPatch(patchContents string, dir patch.Direction) error
+	// UnapplyPatch reverts a patch that was previously applied with ApplyPatch in the same direction.
+	UnapplyPatch(patchContents string, dir patch.Direction) error
+	StageFiles(files []File) error
+	UnstageFiles(files []File) error
+	// IndexEntries and RestoreIndex save how the index has some files and put it back, partial staging included.
+	IndexEntries(paths []string) ([]IndexEntry, error)
+	RestoreIndex(paths []string, entries []IndexEntry) error
+	Commit(msg string) error
+
+	WriteBlob(data []byte) (string, error)
+	ReadBlob(id string) ([]byte, error)
+	// KeepBlob makes a blob reachable from a ref, so that git gc doesn't prune it.
+	KeepBlob(ref, id string) error
+
+	// CancelCommands stops the git commands that are running, which then fail with ErrCanceled.
+	CancelCommands()
+}
+
+// Options are choices about how a backend works that don't change what it does.
+type Options struct {
+	// ApplyInProcess applies patches with libgit2 instead of running git apply, which saves starting a process and
+	// reloading the repository for every patch. Only the libgit2 backend can do it.
+	ApplyInProcess bool
+	// Timeouts stop the git commands that run for too long. There are none without them.
+	Timeouts Timeouts
+}
+
+const (
+	LibGit2Backend = `libgit2`
+	ExecBackend    = `git`
+)
+
+// Backends returns the names of the backends that were built in, the default one first.
+func Backends() []string {
+	if hasLibGit2 {
+		return []string{LibGit2Backend, ExecBackend}
+	}
+	return []string{ExecBackend}
+}
+
+// NewBackend opens the repository of the environment with the backend of the given name.
+func NewBackend(name string, env nolibgit.Environment, opts Options) (Backend, error) {
+	switch name {
+	case LibGit2Backend:
+		if !hasLibGit2 {
+			return nil, errors.New(`go-istage was built without libgit2`)
+		}
+		return newLibGit2Backend(env, opts)
+	case ExecBackend:
+		if opts.ApplyInProcess {
+			return nil, errors.New(`only the libgit2 backend can apply patches in process`)
+		}
+		c, err := NewExecClient(env)
+		if err != nil {
+			return nil, err
+		}
+		c.timeouts = opts.Timeouts
+		return c, nil
+	}
+	return nil, fmt.Errorf(`unknown backend %q, expected one of %s`, name, strings.Join(Backends(), `, `))
+}
@@ -0,0 +1,15 @@
+package git
+
+// BranchInfo describes what HEAD points at. Name is empty when HEAD is detached, and Upstream is empty when the branch
+// doesn't track anything.
+type BranchInfo struct {
+	Name     string
+	Commit   string
+	Upstream string
+	Ahead    int
+	Behind   int
+}
+
+func (bi BranchInfo) Detached() bool {
+	return bi.Name == ``
+}
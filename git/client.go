@@ -1,219 +1,214 @@
 package git
 
 import (
-	"path"
+	"context"
+	"math"
 	"strings"
+	"sync"
 
 	"github.com/cszczepaniak/go-istage/nolibgit"
 	"github.com/cszczepaniak/go-istage/patch"
-	git "github.com/libgit2/git2go/v34"
 )
 
-type Client struct {
-	repo *git.Repository
-	env  nolibgit.Environment
+// commands holds what every backend shares: changes to the repository are always made by running git, whatever reads
+// it. update reloads whatever the backend caches about the repository after a command changed it.
+type commands struct {
+	env      nolibgit.Environment
+	update   func() error
+	timeouts Timeouts
+
+	pathspec []string
+
+	// mu guards ctx, which commands run with until CancelCommands cancels it.
+	mu     sync.Mutex
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
-func NewClient(env nolibgit.Environment) (*Client, error) {
-	c := &Client{
-		env: env,
-	}
-	err := c.UpdateRepository()
-	if err != nil {
-		return nil, err
+// CancelCommands stops the git commands that are running, which then fail with ErrCanceled. The commands started
+// afterwards run as usual.
+func (c *commands) CancelCommands() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.cancel != nil {
+		c.cancel()
 	}
-	return c, nil
+	c.ctx, c.cancel = context.WithCancel(context.Background())
 }
 
-func (c *Client) UpdateRepository() error {
-	repo, err := git.OpenRepository(c.env.RepoDir)
-	if err != nil {
-		return err
+func (c *commands) context() context.Context {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.ctx == nil {
+		c.ctx, c.cancel = context.WithCancel(context.Background())
 	}
+	return c.ctx
+}
 
-	c.repo = repo
+// LimitToPaths restricts the files and changes the client reports to the ones matching the given pathspecs, which are
+// relative to the root of the working tree.
+func (c *commands) LimitToPaths(pathspec []string) {
+	c.pathspec = pathspec
+}
 
-	return nil
+// Root returns the top-level directory of the working tree.
+func (c *commands) Root() string {
+	return c.env.WorkingDir
 }
 
-func (c *Client) ApplyPatch(patchContents string, dir patch.Direction) error {
-	isUndo := dir == patch.Reset || dir == patch.Unstage
+func (c *commands) ApplyPatch(patchContents string, dir patch.Direction) error {
+	return c.applyPatch(patchContents, dir, dir.IsUndo())
+}
+
+// UnapplyPatch reverts a patch that was previously applied with ApplyPatch in the same direction.
+func (c *commands) UnapplyPatch(patchContents string, dir patch.Direction) error {
+	return c.applyPatch(patchContents, dir, !dir.IsUndo())
+}
 
+func (c *commands) applyPatch(patchContents string, dir patch.Direction, reverse bool) error {
 	b := c.Exec(`apply`).WithStdin(strings.NewReader(patchContents))
 
 	b.WithArgs(`-v`)
 	if dir != patch.Reset {
 		b.WithArgs(`--cached`)
 	}
-	if isUndo {
+	if reverse {
 		b.WithArgs(`--reverse`)
 	}
 	b.WithArgs(`--whitespace=nowarn`)
+	// Diffs shown without context result in patches without context, which git only applies when told they are fine.
+	// Other patches are left to git's checks that hunks without context on one side are at that end of the file.
+	if lacksContext(patchContents) {
+		b.WithArgs(`--unidiff-zero`)
+	}
 
 	return b.Run()
 }
 
-func (c *Client) StageFile(file File) error {
-	path := path.Join(c.repo.Workdir(), file.Path)
-	path = file.Path
-	return c.Exec(`add`).WithArgs(path).Run()
-}
-
-func (c *Client) UnstageFile(file File) error {
-	path := path.Join(c.repo.Workdir(), file.Path)
-	path = file.Path
-	if file.Status == FileStatusDeleted {
-		return c.Exec(`restore`).WithArgs(`--staged`, path).Run()
-	}
-	return c.Exec(`reset`).WithArgs(path).Run()
-}
-
-func (c *Client) UnstagedFiles() ([]File, error) {
-	opts := &git.StatusOptions{
-		Show:  git.StatusShowWorkdirOnly,
-		Flags: git.StatusOptIncludeUntracked | git.StatusOptRecurseUntrackedDirs | git.StatusOptRenamesIndexToWorkdir,
-	}
-	sl, err := c.repo.StatusList(opts)
-	if err != nil {
-		return nil, err
-	}
-
-	n, err := sl.EntryCount()
-	if err != nil {
-		return nil, err
-	}
-
-	res := make([]File, 0, n)
-	for i := 0; i < n; i++ {
-		e, err := sl.ByIndex(i)
+// lacksContext returns whether a hunk of the patch has no context lines at all.
+func lacksContext(patchContents string) bool {
+	lines := strings.SplitAfter(patchContents, "\n")
+	for i := 0; i < len(lines); i++ {
+		fields := strings.Fields(lines[i])
+		if !strings.HasPrefix(lines[i], `@@ `) || len(fields) < 4 {
+			continue
+		}
+		oldLength, err := rangeLength(fields[1])
 		if err != nil {
-			return nil, err
+			continue
 		}
-		res = append(res, File{
-			Path:   e.IndexToWorkdir.NewFile.Path,
-			Status: fileStatusFromGitDelta(e.IndexToWorkdir.Status),
-		})
-	}
-
-	return res, nil
-}
-
-func (c *Client) StagedFiles() ([]File, error) {
-	opts := &git.StatusOptions{
-		Show:  git.StatusShowIndexOnly,
-		Flags: git.StatusOptIncludeUntracked | git.StatusOptRecurseUntrackedDirs | git.StatusOptRenamesHeadToIndex,
-	}
-	sl, err := c.repo.StatusList(opts)
-	if err != nil {
-		return nil, err
-	}
-
-	n, err := sl.EntryCount()
-	if err != nil {
-		return nil, err
-	}
-
-	res := make([]File, 0, n)
-	for i := 0; i < n; i++ {
-		e, err := sl.ByIndex(i)
+		newLength, err := rangeLength(fields[2])
 		if err != nil {
-			return nil, err
+			continue
+		}
+
+		context := false
+		for i++; i < len(lines) && lines[i] != `` && (oldLength > 0 || newLength > 0); i++ {
+			switch lines[i][0] {
+			case ' ':
+				context = true
+				oldLength--
+				newLength--
+			case '-':
+				oldLength--
+			case '+':
+				newLength--
+			}
+		}
+		if !context {
+			return true
 		}
-		res = append(res, File{
-			Path:   e.HeadToIndex.NewFile.Path,
-			Status: fileStatusFromGitDelta(e.HeadToIndex.Status),
-		})
+		i--
 	}
+	return false
+}
 
-	return res, nil
+func (c *commands) StageFile(file File) error {
+	return c.StageFiles([]File{file})
 }
 
-func (c *Client) UnstagedChanges() ([]string, error) {
-	opts, err := git.DefaultDiffOptions()
-	if err != nil {
-		return nil, err
-	}
-	opts.Flags |= git.DiffShowUntrackedContent
-	opts.Flags |= git.DiffRecurseUntracked
+func (c *commands) UnstageFile(file File) error {
+	return c.UnstageFiles([]File{file})
+}
 
-	diff, err := c.repo.DiffIndexToWorkdir(nil, &opts)
-	if err != nil {
-		return nil, err
+// StageFiles stages several files with a single git command.
+func (c *commands) StageFiles(files []File) error {
+	if len(files) == 0 {
+		return nil
 	}
 
-	err = handleRenames(diff)
-	if err != nil {
-		return nil, err
+	args := []string{`--`}
+	for _, f := range files {
+		args = append(args, f.Path)
 	}
-
-	return patchesFromDiff(diff)
+	return c.Exec(`add`).WithArgs(args...).Run()
 }
 
-func (c *Client) StagedChanges() ([]string, error) {
-	opts, err := git.DefaultDiffOptions()
-	if err != nil {
-		return nil, err
-	}
-
-	headRef, err := c.repo.Head()
-	if err != nil {
-		return nil, err
-	}
-	commit, err := c.repo.LookupCommit(headRef.Target())
-	if err != nil {
-		return nil, err
-	}
-	tree, err := commit.Tree()
-	if err != nil {
-		return nil, err
+// UnstageFiles unstages several files, with at most one git command for the deleted files and one for the rest.
+func (c *commands) UnstageFiles(files []File) error {
+	var deleted, other []string
+	for _, f := range files {
+		if f.Status == FileStatusDeleted {
+			deleted = append(deleted, f.Path)
+		} else {
+			other = append(other, f.Path)
+		}
 	}
 
-	diff, err := c.repo.DiffTreeToIndex(tree, nil, &opts)
-	if err != nil {
-		return nil, err
+	if len(deleted) > 0 {
+		err := c.Exec(`restore`).WithArgs(append([]string{`--staged`, `--`}, deleted...)...).Run()
+		if err != nil {
+			return err
+		}
 	}
-
-	err = handleRenames(diff)
-	if err != nil {
-		return nil, err
+	if len(other) > 0 {
+		return c.Exec(`reset`).WithArgs(append([]string{`--`}, other...)...).Run()
 	}
-
-	return patchesFromDiff(diff)
+	return nil
 }
 
-func patchesFromDiff(diff *git.Diff) ([]string, error) {
-	ndl, err := diff.NumDeltas()
-	if err != nil {
-		return nil, err
-	}
+func (c *commands) Commit(msg string) error {
+	return c.Exec(`commit`).WithArgs(`-F`, `-`).WithStdin(strings.NewReader(msg)).Run()
+}
 
-	res := make([]string, 0, ndl)
-	for i := 0; i < ndl; i++ {
-		p, err := diff.Patch(i)
-		if err != nil {
-			return nil, err
-		}
+// DiffOptions controls how much of the unchanged content around changes diffs show.
+type DiffOptions struct {
+	// ContextLines is the number of unchanged lines around each change. FullContext shows whole files.
+	ContextLines int
+	// InterhunkLines is the number of unchanged lines between two hunks up to which they are merged into one.
+	InterhunkLines int
+	// Whitespace is which changes of whitespace are left out of the diff.
+	Whitespace Whitespace
+}
 
-		txt, err := p.String()
-		if err != nil {
-			return nil, err
-		}
+// DiffStats counts the files and lines of a diff, which is much cheaper than computing it.
+type DiffStats struct {
+	Files     int
+	Additions int
+	Removals  int
+}
 
-		if txt != `` {
-			res = append(res, txt)
-		}
-	}
+// Whitespace is a way of comparing lines that ignores some changes of whitespace, like the whitespace options of git
+// diff.
+type Whitespace int
+
+const (
+	ExactWhitespace Whitespace = iota
+	// IgnoreWhitespaceAtEOL ignores changes of whitespace at the end of lines, like --ignore-space-at-eol.
+	IgnoreWhitespaceAtEOL
+	// IgnoreWhitespaceChange ignores changes in the amount of whitespace, like --ignore-space-change.
+	IgnoreWhitespaceChange
+	// IgnoreAllWhitespace ignores whitespace altogether, like --ignore-all-space.
+	IgnoreAllWhitespace
+)
 
-	return res, nil
-}
+// FullContext as the number of context lines shows the whole file around the changes.
+const FullContext = math.MaxInt32
 
-func handleRenames(diff *git.Diff) error {
-	findOpts, err := git.DefaultDiffFindOptions()
-	if err != nil {
-		return err
+func DefaultDiffOptions() DiffOptions {
+	return DiffOptions{
+		ContextLines: 3,
 	}
-	findOpts.Flags |= git.DiffFindRenames
-	findOpts.Flags |= git.DiffFindForUntracked
-
-	return diff.FindSimilar(&findOpts)
 }
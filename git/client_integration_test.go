@@ -1,100 +1,109 @@
 package git
 
 import (
+	"os"
+	"strings"
+	"sync"
 	"testing"
 
+	"github.com/cszczepaniak/go-istage/patch"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
 func TestUnstagedFiles(t *testing.T) {
-	r := NewTestRepo(t)
-
-	f1 := r.MakeFile(t, `a.txt`).AddLine(`abc`).Build()
-	f2 := r.MakeFile(t, `b.txt`).AddLine(`def`).ShouldCommit(`abc`).Build()
-	f3 := r.MakeFile(t, `c.txt`).AddLine(`ghi`).ShouldCommit(`abc`).Build()
-	f4 := r.MakeFile(t, `old.txt`).AddLine(`old text`).ShouldCommit(`abc`).Build()
-
-	gc, err := NewClient(r.env)
-	require.NoError(t, err)
-
-	f2.Append("ghi\n")
-	f3.Remove()
-	f4.Rename(`new.txt`)
-
-	fs, err := gc.UnstagedFiles()
-	require.NoError(t, err)
-	require.Len(t, fs, 4)
-	assert.Equal(t, File{
-		Path:   f1.path,
-		Status: FileStatusUntracked,
-	}, fs[0])
-	assert.Equal(t, File{
-		Path:   f2.path,
-		Status: FileStatusModified,
-	}, fs[1])
-	assert.Equal(t, File{
-		Path:   f3.path,
-		Status: FileStatusDeleted,
-	}, fs[2])
-	assert.Equal(t, File{
-		Path:   `new.txt`,
-		Status: FileStatusRenamed,
-	}, fs[3])
+	forEachBackend(t, func(t *testing.T, newClient newClientFunc) {
+		r := NewTestRepo(t)
+
+		f1 := r.MakeFile(t, `a.txt`).AddLine(`abc`).Build()
+		f2 := r.MakeFile(t, `b.txt`).AddLine(`def`).ShouldCommit(`abc`).Build()
+		f3 := r.MakeFile(t, `c.txt`).AddLine(`ghi`).ShouldCommit(`abc`).Build()
+		f4 := r.MakeFile(t, `old.txt`).AddLine(`old text`).ShouldCommit(`abc`).Build()
+
+		gc, err := newClient(r.env)
+		require.NoError(t, err)
+
+		f2.Append("ghi\n")
+		f3.Remove()
+		f4.Rename(`new.txt`)
+
+		fs, err := gc.UnstagedFiles()
+		require.NoError(t, err)
+		require.Len(t, fs, 4)
+		assert.Equal(t, File{
+			Path:   f1.path,
+			Status: FileStatusUntracked,
+		}, fs[0])
+		assert.Equal(t, File{
+			Path:   f2.path,
+			Status: FileStatusModified,
+		}, fs[1])
+		assert.Equal(t, File{
+			Path:   f3.path,
+			Status: FileStatusDeleted,
+		}, fs[2])
+		assert.Equal(t, File{
+			Path:   `new.txt`,
+			Status: FileStatusRenamed,
+		}, fs[3])
+	})
 }
 
 func TestStagedFiles(t *testing.T) {
-	r := NewTestRepo(t)
-
-	f2 := r.MakeFile(t, `b.txt`).AddLine(`def`).ShouldCommit(`abc`).Build()
-	f3 := r.MakeFile(t, `c.txt`).AddLine(`ghi`).ShouldCommit(`abc`).Build()
-	f4 := r.MakeFile(t, `old.txt`).AddLine(`old text`).ShouldCommit(`abc`).Build()
-
-	f1 := r.MakeFile(t, `a.txt`).AddLine(`abc`).ShouldStage().Build()
-
-	gc, err := NewClient(r.env)
-	require.NoError(t, err)
-
-	f2.Append("ghi\n")
-	f3.Remove()
-	f4.Rename(`new.txt`)
-
-	r.AddAll()
-
-	fs, err := gc.StagedFiles()
-	require.NoError(t, err)
-	require.Len(t, fs, 4)
-	assert.Equal(t, File{
-		Path:   f1.path,
-		Status: FileStatusAdded,
-	}, fs[0])
-	assert.Equal(t, File{
-		Path:   f2.path,
-		Status: FileStatusModified,
-	}, fs[1])
-	assert.Equal(t, File{
-		Path:   f3.path,
-		Status: FileStatusDeleted,
-	}, fs[2])
-	assert.Equal(t, File{
-		Path:   `new.txt`,
-		Status: FileStatusRenamed,
-	}, fs[3])
+	forEachBackend(t, func(t *testing.T, newClient newClientFunc) {
+		r := NewTestRepo(t)
+
+		f2 := r.MakeFile(t, `b.txt`).AddLine(`def`).ShouldCommit(`abc`).Build()
+		f3 := r.MakeFile(t, `c.txt`).AddLine(`ghi`).ShouldCommit(`abc`).Build()
+		f4 := r.MakeFile(t, `old.txt`).AddLine(`old text`).ShouldCommit(`abc`).Build()
+
+		f1 := r.MakeFile(t, `a.txt`).AddLine(`abc`).ShouldStage().Build()
+
+		gc, err := newClient(r.env)
+		require.NoError(t, err)
+
+		f2.Append("ghi\n")
+		f3.Remove()
+		f4.Rename(`new.txt`)
+
+		r.AddAll()
+
+		fs, err := gc.StagedFiles()
+		require.NoError(t, err)
+		require.Len(t, fs, 4)
+		assert.Equal(t, File{
+			Path:   f1.path,
+			Status: FileStatusAdded,
+		}, fs[0])
+		assert.Equal(t, File{
+			Path:   f2.path,
+			Status: FileStatusModified,
+		}, fs[1])
+		assert.Equal(t, File{
+			Path:   f3.path,
+			Status: FileStatusDeleted,
+		}, fs[2])
+		assert.Equal(t, File{
+			Path:   `new.txt`,
+			Status: FileStatusRenamed,
+		}, fs[3])
+	})
 }
 
 func TestUnstagedChanges(t *testing.T) {
-	r := NewTestRepo(t)
+	forEachBackend(t, func(t *testing.T, newClient newClientFunc) {
+		r := NewTestRepo(t)
 
-	f := r.MakeFile(t, `a.txt`).AddLine(`abc`).Build()
+		f := r.MakeFile(t, `a.txt`).AddLine(`abc`).Build()
 
-	gc, err := NewClient(r.env)
-	require.NoError(t, err)
+		gc, err := newClient(r.env)
+		require.NoError(t, err)
 
-	c, err := gc.UnstagedChanges()
-	require.NoError(t, err)
-	require.Len(t, c, 1)
+		c, err := gc.UnstagedChanges(DefaultDiffOptions())
+		require.NoError(t, err)
+		require.Len(t, c, 1)
 
-	assert.Equal(t, `diff --git a/a.txt b/a.txt
+		assert.Equal(t, `diff --git a/a.txt b/a.txt
 new file mode 100644
 index 0000000..8baef1b
 --- /dev/null
@@ -103,16 +112,16 @@ index 0000000..8baef1b
 +abc
 `, c[0])
 
-	r.AddAll()
-	r.Commit(`adding file`)
+		r.AddAll()
+		r.Commit(`adding file`)
 
-	f.Append("abc\n")
+		f.Append("abc\n")
 
-	c, err = gc.UnstagedChanges()
-	require.NoError(t, err)
-	require.Len(t, c, 1)
+		c, err = gc.UnstagedChanges(DefaultDiffOptions())
+		require.NoError(t, err)
+		require.Len(t, c, 1)
 
-	assert.Equal(t, `diff --git a/a.txt b/a.txt
+		assert.Equal(t, `diff --git a/a.txt b/a.txt
 index 8baef1b..5d8a556 100644
 --- a/a.txt
 +++ b/a.txt
@@ -121,15 +130,15 @@ index 8baef1b..5d8a556 100644
 +abc
 `, c[0])
 
-	r.ClearUnstagedChanges()
+		r.ClearUnstagedChanges()
 
-	f.Replace("def")
+		f.Replace("def")
 
-	c, err = gc.UnstagedChanges()
-	require.NoError(t, err)
-	require.Len(t, c, 1)
+		c, err = gc.UnstagedChanges(DefaultDiffOptions())
+		require.NoError(t, err)
+		require.Len(t, c, 1)
 
-	assert.Equal(t, `diff --git a/a.txt b/a.txt
+		assert.Equal(t, `diff --git a/a.txt b/a.txt
 index 8baef1b..0c00383 100644
 --- a/a.txt
 +++ b/a.txt
@@ -139,15 +148,15 @@ index 8baef1b..0c00383 100644
 \ No newline at end of file
 `, c[0])
 
-	r.ClearUnstagedChanges()
+		r.ClearUnstagedChanges()
 
-	f.Remove()
+		f.Remove()
 
-	c, err = gc.UnstagedChanges()
-	require.NoError(t, err)
-	require.Len(t, c, 1)
+		c, err = gc.UnstagedChanges(DefaultDiffOptions())
+		require.NoError(t, err)
+		require.Len(t, c, 1)
 
-	assert.Equal(t, `diff --git a/a.txt b/a.txt
+		assert.Equal(t, `diff --git a/a.txt b/a.txt
 deleted file mode 100644
 index 8baef1b..0000000
 --- a/a.txt
@@ -155,22 +164,24 @@ index 8baef1b..0000000
 @@ -1 +0,0 @@
 -abc
 `, c[0])
+	})
 }
 
 func TestStagedChanges(t *testing.T) {
-	r := NewTestRepo(t)
+	forEachBackend(t, func(t *testing.T, newClient newClientFunc) {
+		r := NewTestRepo(t)
 
-	f := r.MakeFile(t, `b.txt`).AddLine(`def`).ShouldStage().Build()
-	_ = f
+		f := r.MakeFile(t, `b.txt`).AddLine(`def`).ShouldStage().Build()
+		_ = f
 
-	gc, err := NewClient(r.env)
-	require.NoError(t, err)
+		gc, err := newClient(r.env)
+		require.NoError(t, err)
 
-	c, err := gc.StagedChanges()
-	require.NoError(t, err)
-	require.Len(t, c, 1)
+		c, err := gc.StagedChanges(DefaultDiffOptions())
+		require.NoError(t, err)
+		require.Len(t, c, 1)
 
-	assert.Equal(t, `diff --git a/b.txt b/b.txt
+		assert.Equal(t, `diff --git a/b.txt b/b.txt
 new file mode 100644
 index 0000000..24c5735
 --- /dev/null
@@ -179,16 +190,16 @@ index 0000000..24c5735
 +def
 `, c[0])
 
-	r.Commit(`added b.txt`)
+		r.Commit(`added b.txt`)
 
-	f.Append("abc\n")
-	r.AddAll()
+		f.Append("abc\n")
+		r.AddAll()
 
-	c, err = gc.StagedChanges()
-	require.NoError(t, err)
-	require.Len(t, c, 1)
+		c, err = gc.StagedChanges(DefaultDiffOptions())
+		require.NoError(t, err)
+		require.Len(t, c, 1)
 
-	assert.Equal(t, `diff --git a/b.txt b/b.txt
+		assert.Equal(t, `diff --git a/b.txt b/b.txt
 index 24c5735..7320698 100644
 --- a/b.txt
 +++ b/b.txt
@@ -197,15 +208,15 @@ index 24c5735..7320698 100644
 +abc
 `, c[0])
 
-	r.Commit(`change`)
-	f.Remove()
-	r.AddAll()
+		r.Commit(`change`)
+		f.Remove()
+		r.AddAll()
 
-	c, err = gc.StagedChanges()
-	require.NoError(t, err)
-	require.Len(t, c, 1)
+		c, err = gc.StagedChanges(DefaultDiffOptions())
+		require.NoError(t, err)
+		require.Len(t, c, 1)
 
-	assert.Equal(t, `diff --git a/b.txt b/b.txt
+		assert.Equal(t, `diff --git a/b.txt b/b.txt
 deleted file mode 100644
 index 7320698..0000000
 --- a/b.txt
@@ -214,4 +225,423 @@ index 7320698..0000000
 -def
 -abc
 `, c[0])
+	})
+}
+
+func TestWriteAndReadBlob(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, newClient newClientFunc) {
+		r := NewTestRepo(t)
+
+		gc, err := newClient(r.env)
+		require.NoError(t, err)
+
+		id, err := gc.WriteBlob([]byte("abc\n"))
+		require.NoError(t, err)
+		assert.Equal(t, `8baef1b4abc478178b004d62031cf7fe6db6f903`, id)
+
+		bs, err := gc.ReadBlob(id)
+		require.NoError(t, err)
+		assert.Equal(t, "abc\n", string(bs))
+
+		_, err = gc.ReadBlob(`0000000000000000000000000000000000000001`)
+		assert.Error(t, err)
+	})
+}
+
+func TestKeepBlob(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, newClient newClientFunc) {
+		r := NewTestRepo(t)
+
+		gc, err := newClient(r.env)
+		require.NoError(t, err)
+
+		var ids []string
+		for _, data := range []string{"a\n", "b\n", "c\n"} {
+			id, err := gc.WriteBlob([]byte(data))
+			require.NoError(t, err)
+			ids = append(ids, id)
+		}
+		require.NoError(t, gc.KeepBlob(`refs/test/kept`, ids[0]))
+		require.NoError(t, gc.KeepBlob(`refs/test/kept`, ids[1]))
+		require.NoError(t, gc.KeepBlob(`refs/test/kept`, ids[0]))
+
+		var tree strings.Builder
+		require.NoError(t, Exec(r.env, `ls-tree`).WithArgs(`--name-only`, `refs/test/kept`).WithStdout(&tree).Run())
+		assert.ElementsMatch(t, ids[:2], strings.Fields(tree.String()))
+
+		require.NoError(t, Exec(r.env, `gc`).WithArgs(`--prune=now`, `--quiet`).Run())
+		for _, id := range ids[:2] {
+			assert.NoError(t, Exec(r.env, `cat-file`).WithArgs(`-e`, id).Run())
+		}
+		assert.Error(t, Exec(r.env, `cat-file`).WithArgs(`-e`, ids[2]).Run())
+	})
+}
+
+func TestBranch(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, newClient newClientFunc) {
+		r := NewTestRepo(t)
+
+		gc, err := newClient(r.env)
+		require.NoError(t, err)
+
+		bi, err := gc.Branch()
+		require.NoError(t, err)
+		assert.Equal(t, `master`, bi.Name)
+		assert.Empty(t, bi.Upstream)
+		assert.Len(t, bi.Commit, 7)
+
+		require.NoError(t, gc.Exec(`branch`).WithArgs(`other`).Run())
+		require.NoError(t, gc.Exec(`branch`).WithArgs(`--set-upstream-to=other`).Run())
+		r.MakeFile(t, `a.txt`).AddLine(`abc`).ShouldCommit(`abc`).Build()
+		require.NoError(t, gc.UpdateRepository())
+
+		bi, err = gc.Branch()
+		require.NoError(t, err)
+		assert.Equal(t, BranchInfo{
+			Name:     `master`,
+			Commit:   bi.Commit,
+			Upstream: `other`,
+			Ahead:    1,
+			Behind:   0,
+		}, bi)
+
+		require.NoError(t, gc.Exec(`checkout`).WithArgs(`--detach`).Run())
+
+		bi, err = gc.Branch()
+		require.NoError(t, err)
+		assert.True(t, bi.Detached())
+		assert.Empty(t, bi.Upstream)
+	})
+}
+
+func TestLimitToPaths(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, newClient newClientFunc) {
+		r := NewTestRepo(t)
+
+		require.NoError(t, os.Mkdir(`sub`, 0o755))
+		r.MakeFile(t, `a.txt`).AddLine(`abc`).Build()
+		r.MakeFile(t, `sub/b.txt`).AddLine(`def`).Build()
+		r.MakeFile(t, `sub/c.txt`).AddLine(`ghi`).ShouldStage().Build()
+		r.MakeFile(t, `d.txt`).AddLine(`jkl`).ShouldStage().Build()
+
+		gc, err := newClient(r.env)
+		require.NoError(t, err)
+		gc.LimitToPaths([]string{`sub`})
+
+		fs, err := gc.UnstagedFiles()
+		require.NoError(t, err)
+		assert.Equal(t, []File{{Path: `sub/b.txt`, Status: FileStatusUntracked}}, fs)
+
+		fs, err = gc.StagedFiles()
+		require.NoError(t, err)
+		assert.Equal(t, []File{{Path: `sub/c.txt`, Status: FileStatusAdded}}, fs)
+
+		changes, err := gc.UnstagedChanges(DefaultDiffOptions())
+		require.NoError(t, err)
+		require.Len(t, changes, 1)
+		assert.Contains(t, changes[0], `+++ b/sub/b.txt`)
+
+		changes, err = gc.StagedChanges(DefaultDiffOptions())
+		require.NoError(t, err)
+		require.Len(t, changes, 1)
+		assert.Contains(t, changes[0], `+++ b/sub/c.txt`)
+	})
+}
+
+func TestStageAndUnstageFiles(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, newClient newClientFunc) {
+		r := NewTestRepo(t)
+
+		require.NoError(t, os.Mkdir(`sub`, 0o755))
+		f1 := r.MakeFile(t, `b.txt`).AddLine(`def`).ShouldCommit(`abc`).Build()
+		f2 := r.MakeFile(t, `sub/c.txt`).AddLine(`ghi`).ShouldCommit(`abc`).Build()
+		r.MakeFile(t, `sub/a.txt`).AddLine(`abc`).Build()
+
+		gc, err := newClient(r.env)
+		require.NoError(t, err)
+
+		f1.Append("ghi\n")
+		f2.Remove()
+
+		unstaged, err := gc.UnstagedFiles()
+		require.NoError(t, err)
+		require.Len(t, unstaged, 3)
+
+		require.NoError(t, gc.StageFiles(unstaged))
+
+		staged, err := gc.StagedFiles()
+		require.NoError(t, err)
+		assert.Equal(t, []File{
+			{Path: `b.txt`, Status: FileStatusModified},
+			{Path: `sub/a.txt`, Status: FileStatusAdded},
+			{Path: `sub/c.txt`, Status: FileStatusDeleted},
+		}, staged)
+
+		require.NoError(t, gc.UnstageFiles(staged))
+
+		staged, err = gc.StagedFiles()
+		require.NoError(t, err)
+		assert.Empty(t, staged)
+	})
+}
+
+func TestDiffOptions(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, newClient newClientFunc) {
+		r := NewTestRepo(t)
+
+		f := r.MakeFile(t, `a.txt`).Add("1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n").ShouldCommit(`abc`).Build()
+		f.Replace("1\n2\n3\n4\nfive\n6\n7\n8\n9\n10\n")
+
+		gc, err := newClient(r.env)
+		require.NoError(t, err)
+
+		c, err := gc.UnstagedChanges(DiffOptions{ContextLines: 1})
+		require.NoError(t, err)
+		require.Len(t, c, 1)
+		assert.Contains(t, c[0], `@@ -4,3 +4,3 @@`)
+
+		c, err = gc.UnstagedChanges(DiffOptions{ContextLines: FullContext})
+		require.NoError(t, err)
+		require.Len(t, c, 1)
+		assert.Contains(t, c[0], `@@ -1,10 +1,10 @@`)
+
+		r.AddAll()
+
+		c, err = gc.StagedChanges(DiffOptions{ContextLines: FullContext})
+		require.NoError(t, err)
+		require.Len(t, c, 1)
+		assert.Contains(t, c[0], `@@ -1,10 +1,10 @@`)
+	})
+}
+
+func TestDiffOptionsWhitespace(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, newClient newClientFunc) {
+		r := NewTestRepo(t)
+
+		f := r.MakeFile(t, `a.txt`).Add("a\n  b\nc\nd e\n").ShouldCommit(`abc`).Build()
+		f.Replace("a\nb\nc  \nd   e\nX\n")
+
+		gc, err := newClient(r.env)
+		require.NoError(t, err)
+
+		c, err := gc.UnstagedChanges(DiffOptions{ContextLines: 3})
+		require.NoError(t, err)
+		require.Len(t, c, 1)
+		assert.Contains(t, c[0], "-  b\n-c\n-d e\n")
+		assert.Contains(t, c[0], "+b\n+c  \n+d   e\n")
+
+		c, err = gc.UnstagedChanges(DiffOptions{ContextLines: 3, Whitespace: IgnoreWhitespaceAtEOL})
+		require.NoError(t, err)
+		require.Len(t, c, 1)
+		assert.Contains(t, c[0], "-  b\n+b\n")
+		assert.NotContains(t, c[0], "-c\n")
+		assert.Contains(t, c[0], "-d e\n+d   e\n")
+
+		c, err = gc.UnstagedChanges(DiffOptions{ContextLines: 3, Whitespace: IgnoreWhitespaceChange})
+		require.NoError(t, err)
+		require.Len(t, c, 1)
+		assert.Contains(t, c[0], "-  b\n+b\n")
+		assert.NotContains(t, c[0], "-d e\n")
+
+		c, err = gc.UnstagedChanges(DiffOptions{ContextLines: 3, Whitespace: IgnoreAllWhitespace})
+		require.NoError(t, err)
+		require.Len(t, c, 1)
+		assert.NotContains(t, c[0], "-  b\n")
+		assert.Contains(t, c[0], "+X\n")
+
+		// Every backend finds the same hunks as git diff with the same options.
+		for ws, arg := range map[Whitespace]string{
+			ExactWhitespace:        `--unified=3`,
+			IgnoreWhitespaceAtEOL:  `--ignore-space-at-eol`,
+			IgnoreWhitespaceChange: `--ignore-space-change`,
+			IgnoreAllWhitespace:    `--ignore-all-space`,
+		} {
+			var out strings.Builder
+			require.NoError(t, Exec(r.env, `diff`).WithArgs(`--no-color`, arg).WithStdout(&out).Run())
+
+			c, err = gc.UnstagedChanges(DiffOptions{ContextLines: 3, Whitespace: ws})
+			require.NoError(t, err)
+			require.Len(t, c, 1)
+			assert.Equal(t, hunks(out.String()), hunks(c[0]), arg)
+		}
+	})
+}
+
+func TestDiffIgnoresConfiguration(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, newClient newClientFunc) {
+		r := NewTestRepo(t)
+		r.MakeFile(t, `.gitattributes`).AddLine(`b.txt diff=shout`).ShouldCommit(`attributes`).Build()
+		r.MakeFile(t, `order`).AddLine(`b.txt`).ShouldCommit(`order`).Build()
+		for k, v := range map[string]string{
+			`diff.algorithm`:      `histogram`,
+			`diff.orderFile`:      `order`,
+			`diff.shout.textconv`: `sed s/^/converted:/`,
+		} {
+			require.NoError(t, Exec(r.env, `config`).WithArgs(k, v).Run())
+		}
+
+		// Histogram diffs remove and add back the a on the 8th line, Myers diffs keep it.
+		a := r.MakeFile(t, `a.txt`).Add("a\n}\nc\nb\nb\na\nc\na\n{\na\n").ShouldCommit(`a`).Build()
+		a.Replace("a\n}\nc\nb\n}\nb\na\nc\n{\na\nc\n{\na\nb\n")
+		b := r.MakeFile(t, `b.txt`).AddLine(`x`).ShouldCommit(`b`).Build()
+		b.Replace("y\n")
+
+		gc, err := newClient(r.env)
+		require.NoError(t, err)
+
+		var out strings.Builder
+		err = Exec(r.env, `diff`).WithArgs(`--no-color`, `--no-textconv`, `--diff-algorithm=myers`, `-O/dev/null`).
+			WithStdout(&out).Run()
+		require.NoError(t, err)
+		want := splitPatches(out.String())
+		require.Len(t, want, 2)
+
+		c, err := gc.UnstagedChanges(DefaultDiffOptions())
+		require.NoError(t, err)
+		require.Len(t, c, 2)
+		assert.Equal(t, hunks(want[0]), hunks(c[0]))
+		assert.Equal(t, hunks(want[1]), hunks(c[1]))
+		assert.NotContains(t, c[0], "\n-a\n")
+		assert.Contains(t, c[1], "-x\n+y\n")
+	})
+}
+
+// hunks returns a patch without its headers.
+func hunks(p string) string {
+	if i := strings.Index(p, "\n@@ "); i >= 0 {
+		return p[i+1:]
+	}
+	return p
+}
+
+// countChanges counts changes the way the stats of a backend count them.
+func countChanges(changes []string) DiffStats {
+	stats := DiffStats{Files: len(changes)}
+	for _, l := range patch.ParseDocument(changes).Lines {
+		switch l.Kind {
+		case patch.AdditionLine:
+			stats.Additions++
+		case patch.RemovalLine:
+			stats.Removals++
+		}
+	}
+	return stats
+}
+
+func TestDiffStats(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, newClient newClientFunc) {
+		r := NewTestRepo(t)
+
+		f := r.MakeFile(t, `a.txt`).Add("1\n2\n3\n").ShouldCommit(`abc`).Build()
+		f.Replace("one\n2\n3\nfour\n")
+		r.MakeFile(t, `b.txt`).Add("x\ny").Build()
+		r.MakeFile(t, `c.bin`).Add("\x00\x01\n").Build()
+		r.MakeFile(t, `d.txt`).Add("1\n2\n  3\n").ShouldStage().Build()
+
+		gc, err := newClient(r.env)
+		require.NoError(t, err)
+
+		opts := DiffOptions{ContextLines: FullContext, Whitespace: IgnoreAllWhitespace}
+		check := func() {
+			unstaged, err := gc.UnstagedChanges(opts)
+			require.NoError(t, err)
+			stats, err := gc.UnstagedStats(opts)
+			require.NoError(t, err)
+			assert.Equal(t, countChanges(unstaged), stats)
+
+			staged, err := gc.StagedChanges(opts)
+			require.NoError(t, err)
+			stats, err = gc.StagedStats(opts)
+			require.NoError(t, err)
+			assert.Equal(t, countChanges(staged), stats)
+		}
+
+		check()
+		stats, err := gc.UnstagedStats(opts)
+		require.NoError(t, err)
+		assert.Equal(t, DiffStats{Files: 3, Additions: 4, Removals: 1}, stats)
+
+		// A deleted file with the content of an untracked one is a rename.
+		r.Commit(`d`)
+		require.NoError(t, os.Rename(`d.txt`, `e.txt`))
+		check()
+	})
+}
+
+func TestApplyPatchWithoutContext(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, newClient newClientFunc) {
+		r := NewTestRepo(t)
+
+		f := r.MakeFile(t, `a.txt`).Add("1\n2\n3\n4\n5\n").ShouldCommit(`abc`).Build()
+		f.Replace("1\n2\nnew1\nnew2\n3\n4\n5\n")
+
+		gc, err := newClient(r.env)
+		require.NoError(t, err)
+
+		c, err := gc.UnstagedChanges(DiffOptions{})
+		require.NoError(t, err)
+		require.Len(t, c, 1)
+
+		doc := patch.ParseDocument(c)
+		var second int
+		for i, l := range doc.Lines {
+			if l.Text == `+new2` {
+				second = i
+			}
+		}
+
+		p, err := patch.Compute(doc, []int{second}, patch.Stage)
+		require.NoError(t, err)
+		require.NoError(t, gc.ApplyPatch(p, patch.Stage))
+
+		c, err = gc.StagedChanges(DiffOptions{})
+		require.NoError(t, err)
+		require.Len(t, c, 1)
+		assert.Contains(t, c[0], `@@ -2,0 +3 @@`)
+		assert.Contains(t, c[0], "+new2\n")
+		assert.NotContains(t, c[0], `new1`)
+	})
+}
+
+func TestConcurrentUse(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, newClient newClientFunc) {
+		r := NewTestRepo(t)
+		r.MakeFile(t, `a.txt`).AddLine(`abc`).ShouldCommit(`abc`).Build().Append("def\n")
+		r.MakeFile(t, `b.txt`).AddLine(`abc`).Build()
+
+		gc, err := newClient(r.env)
+		require.NoError(t, err)
+
+		// The UI loads documents in the background while commands change the repository.
+		var wg sync.WaitGroup
+		errs := make(chan error, 40)
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 5; j++ {
+					_, err := gc.UnstagedChanges(DefaultDiffOptions())
+					errs <- err
+					_, err = gc.StagedFiles()
+					errs <- err
+				}
+			}()
+		}
+
+		files := []File{{Path: `a.txt`}, {Path: `b.txt`}}
+		for i := 0; i < 5; i++ {
+			require.NoError(t, gc.StageFiles(files))
+			require.NoError(t, gc.UnstageFiles(files))
+		}
+
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			assert.NoError(t, err)
+		}
+
+		unstaged, err := gc.UnstagedFiles()
+		require.NoError(t, err)
+		assert.Len(t, unstaged, 2)
+	})
 }
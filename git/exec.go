@@ -2,19 +2,43 @@ package git
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"os"
 	"os/exec"
 	"strings"
+	"time"
 
 	"github.com/cszczepaniak/go-istage/nolibgit"
-	git "github.com/libgit2/git2go/v34"
 )
 
+var (
+	// ErrTimeout is returned when a git command ran for longer than its timeout.
+	ErrTimeout = errors.New(`git command timed out`)
+	// ErrCanceled is returned when a git command was stopped before it finished, like by Backend.CancelCommands.
+	ErrCanceled = errors.New(`git command canceled`)
+)
+
+// CommandError is returned when git ran to the end and failed.
+type CommandError struct {
+	Args   []string
+	Output string
+}
+
+func (e *CommandError) Error() string {
+	return fmt.Sprintf("error executing %+v:\n%s", e.Args, e.Output)
+}
+
 type GitExecBuilder struct {
-	env  nolibgit.Environment
-	repo *git.Repository
+	env nolibgit.Environment
+	// update reloads whatever the client caches about the repository after a command changed it.
+	update func() error
+	vars   []string
+
+	ctx     context.Context
+	timeout time.Duration
 
 	stdin  io.Reader
 	stdout io.Writer
@@ -24,10 +48,13 @@ type GitExecBuilder struct {
 	args       []string
 }
 
-func (gs *Client) Exec(name string) *GitExecBuilder {
+func (c *commands) Exec(name string) *GitExecBuilder {
 	return &GitExecBuilder{
-		env:  gs.env,
-		repo: gs.repo,
+		env:    c.env,
+		update: c.update,
+
+		ctx:     c.context(),
+		timeout: c.timeouts.For(name),
 
 		stdout: io.Discard,
 		stderr: io.Discard,
@@ -37,16 +64,17 @@ func (gs *Client) Exec(name string) *GitExecBuilder {
 	}
 }
 
-func Exec(env nolibgit.Environment, repo *git.Repository, name string) *GitExecBuilder {
+// Exec runs git commands without a client, so there is nothing to update after them.
+func Exec(env nolibgit.Environment, name string) *GitExecBuilder {
 	return &GitExecBuilder{
-		env:  env,
-		repo: repo,
+		env: env,
+
+		ctx: context.Background(),
 
 		stdout: io.Discard,
 		stderr: io.Discard,
 
-		updateRepo: true,
-		args:       []string{name},
+		args: []string{name},
 	}
 }
 
@@ -65,6 +93,18 @@ func (eb *GitExecBuilder) WithStderr(w io.Writer) *GitExecBuilder {
 	return eb
 }
 
+// WithEnv adds environment variables, like `GIT_INDEX_FILE=...`, to the ones the command inherits.
+func (eb *GitExecBuilder) WithEnv(vars ...string) *GitExecBuilder {
+	eb.vars = append(eb.vars, vars...)
+	return eb
+}
+
+// WithTimeout replaces the timeout of the command, zero meaning none.
+func (eb *GitExecBuilder) WithTimeout(d time.Duration) *GitExecBuilder {
+	eb.timeout = d
+	return eb
+}
+
 func (eb *GitExecBuilder) SkipUpdate() *GitExecBuilder {
 	eb.updateRepo = false
 	return eb
@@ -75,9 +115,27 @@ func (eb *GitExecBuilder) WithArgs(a ...string) *GitExecBuilder {
 	return eb
 }
 
+// Run runs the command with the context of the client it comes from, which CancelCommands cancels.
 func (eb *GitExecBuilder) Run() error {
-	cmd := exec.Command(eb.env.GitExecutable, eb.args...)
+	return eb.RunContext(eb.ctx)
+}
+
+// RunContext runs the command until it finishes, its timeout passes or ctx is done. Stopped commands fail with
+// ErrTimeout or ErrCanceled, and commands that git ran and failed with a *CommandError.
+func (eb *GitExecBuilder) RunContext(ctx context.Context) error {
+	if eb.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, eb.timeout)
+		defer cancel()
+	}
+
+	cmd := exec.CommandContext(ctx, eb.env.GitExecutable, eb.args...)
+	// Hooks may leave processes behind that keep the output open, which shouldn't keep us waiting once git is stopped.
+	cmd.WaitDelay = time.Second
 	cmd.Dir = eb.env.WorkingDir
+	if len(eb.vars) > 0 {
+		cmd.Env = append(os.Environ(), eb.vars...)
+	}
 
 	var out strings.Builder
 	cmd.Stdout = io.MultiWriter(&out, eb.stdout)
@@ -88,7 +146,7 @@ func (eb *GitExecBuilder) Run() error {
 
 	err := cmd.Run()
 	if err != nil {
-		return fmt.Errorf("error executing %+v:\n%s", eb.args, out.String())
+		return eb.runError(ctx, out.String())
 	}
 
 	output := out.String()
@@ -96,20 +154,24 @@ func (eb *GitExecBuilder) Run() error {
 	for sc.Scan() {
 		txt := sc.Text()
 		if strings.HasPrefix(txt, `fatal:`) || strings.HasPrefix(txt, `error:`) {
-			return fmt.Errorf("error executing %+v:\n%s", eb.args, output)
+			return &CommandError{Args: eb.args, Output: output}
 		}
 	}
 
-	if eb.updateRepo {
-		repo, err := git.OpenRepository(eb.env.RepoDir)
-		if err != nil {
-			return err
-		}
-
-		if repo == nil {
-			return errors.New(`nil repository returned`)
-		}
-		*eb.repo = *repo
+	if eb.updateRepo && eb.update != nil {
+		return eb.update()
 	}
 	return nil
 }
+
+func (eb *GitExecBuilder) runError(ctx context.Context, output string) error {
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded) && eb.timeout > 0:
+		return fmt.Errorf(`%w after %s: %+v`, ErrTimeout, eb.timeout, eb.args)
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return fmt.Errorf(`%w: %+v`, ErrTimeout, eb.args)
+	case errors.Is(ctx.Err(), context.Canceled):
+		return fmt.Errorf(`%w: %+v`, ErrCanceled, eb.args)
+	}
+	return &CommandError{Args: eb.args, Output: output}
+}
@@ -1,8 +1,13 @@
 package git
 
 import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/cszczepaniak/go-istage/nolibgit"
 	"github.com/stretchr/testify/assert"
@@ -10,48 +15,119 @@ import (
 )
 
 func TestExec(t *testing.T) {
-	NewTestRepo(t)
+	forEachBackend(t, func(t *testing.T, newClient newClientFunc) {
+		NewTestRepo(t)
 
-	env, err := nolibgit.LoadEnvironment()
-	require.NoError(t, err)
+		env, err := nolibgit.LoadEnvironment()
+		require.NoError(t, err)
 
-	gs, err := NewClient(env)
-	require.NoError(t, err)
+		gs, err := newClient(env)
+		require.NoError(t, err)
 
-	err = gs.Exec(`status`).Run()
-	require.NoError(t, err)
+		err = gs.Exec(`status`).Run()
+		require.NoError(t, err)
+	})
 }
 
 func TestExecWithStdout(t *testing.T) {
-	NewTestRepo(t)
+	forEachBackend(t, func(t *testing.T, newClient newClientFunc) {
+		NewTestRepo(t)
 
-	env, err := nolibgit.LoadEnvironment()
-	require.NoError(t, err)
+		env, err := nolibgit.LoadEnvironment()
+		require.NoError(t, err)
 
-	gs, err := NewClient(env)
-	require.NoError(t, err)
+		gs, err := newClient(env)
+		require.NoError(t, err)
 
-	sb := &strings.Builder{}
+		sb := &strings.Builder{}
 
-	err = gs.Exec(`status`).WithStdout(sb).Run()
-	require.NoError(t, err)
+		err = gs.Exec(`status`).WithStdout(sb).Run()
+		require.NoError(t, err)
 
-	assert.Equal(t, "On branch master\nnothing to commit, working tree clean\n", sb.String())
+		assert.Equal(t, "On branch master\nnothing to commit, working tree clean\n", sb.String())
+	})
 }
 
 func TestExecWithStderr(t *testing.T) {
-	NewTestRepo(t)
+	forEachBackend(t, func(t *testing.T, newClient newClientFunc) {
+		NewTestRepo(t)
 
-	env, err := nolibgit.LoadEnvironment()
-	require.NoError(t, err)
+		env, err := nolibgit.LoadEnvironment()
+		require.NoError(t, err)
 
-	gs, err := NewClient(env)
-	require.NoError(t, err)
+		gs, err := newClient(env)
+		require.NoError(t, err)
 
-	sb := &strings.Builder{}
+		sb := &strings.Builder{}
 
-	err = gs.Exec(`what`).WithStderr(sb).Run()
-	assert.Error(t, err)
+		err = gs.Exec(`what`).WithStderr(sb).Run()
+		assert.Error(t, err)
 
-	assert.Equal(t, "git: 'what' is not a git command. See 'git --help'.\n\nThe most similar command is\n\tmktag\n", sb.String())
+		assert.Equal(t, "git: 'what' is not a git command. See 'git --help'.\n\nThe most similar command is\n\tmktag\n", sb.String())
+	})
+}
+
+// hangCommits makes commits wait for a long time in a hook, which creates the started file first.
+func hangCommits(t *testing.T, r testRepo) (started string) {
+	started = filepath.Join(r.path, `started`)
+	hook := "#!/bin/sh\ntouch '" + started + "'\nexec sleep 30 >/dev/null 2>&1\n"
+	require.NoError(t, os.WriteFile(filepath.Join(r.path, `.git`, `hooks`, `pre-commit`), []byte(hook), 0o755))
+	return started
+}
+
+func TestExecErrors(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, newClient newClientFunc) {
+		r := NewTestRepo(t)
+		hangCommits(t, r)
+
+		gs, err := newClient(r.env)
+		require.NoError(t, err)
+
+		err = gs.Exec(`what`).Run()
+		var cmdErr *CommandError
+		require.ErrorAs(t, err, &cmdErr)
+		assert.Equal(t, []string{`what`}, cmdErr.Args)
+
+		err = gs.Exec(`commit`).WithArgs(`--allow-empty`, `-m`, `abc`).WithTimeout(100 * time.Millisecond).Run()
+		assert.ErrorIs(t, err, ErrTimeout)
+		assert.Contains(t, err.Error(), `after 100ms`)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		err = gs.Exec(`status`).RunContext(ctx)
+		assert.ErrorIs(t, err, ErrCanceled)
+	})
+}
+
+func TestCancelCommands(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, newClient newClientFunc) {
+		r := NewTestRepo(t)
+		started := hangCommits(t, r)
+		r.MakeFile(t, `a.txt`).AddLine(`abc`).ShouldStage().Build()
+
+		gs, err := newClient(r.env)
+		require.NoError(t, err)
+
+		errs := make(chan error)
+		go func() {
+			errs <- gs.Commit(`abc`)
+		}()
+
+		require.Eventually(t, func() bool {
+			_, err := os.Stat(started)
+			return err == nil
+		}, 10*time.Second, 10*time.Millisecond)
+		gs.CancelCommands()
+
+		select {
+		case err := <-errs:
+			assert.ErrorIs(t, err, ErrCanceled)
+			assert.False(t, errors.Is(err, ErrTimeout))
+		case <-time.After(10 * time.Second):
+			t.Fatal(`the commit wasn't canceled`)
+		}
+
+		// Later commands aren't canceled.
+		require.NoError(t, gs.Exec(`status`).Run())
+	})
 }
@@ -0,0 +1,461 @@
+package git
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/cszczepaniak/go-istage/nolibgit"
+)
+
+// ExecClient gets everything from the git executable, so that it works without libgit2. It reports the same files and
+// changes as Client: untracked files are part of the unstaged changes, and renames are found among them too.
+type ExecClient struct {
+	commands
+}
+
+func NewExecClient(env nolibgit.Environment) (*ExecClient, error) {
+	c := &ExecClient{}
+	c.commands = commands{
+		env:    env,
+		update: c.UpdateRepository,
+	}
+
+	// Fail early outside of a repository, like opening it with libgit2 would.
+	err := c.Exec(`rev-parse`).WithArgs(`--git-dir`).SkipUpdate().Run()
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// UpdateRepository does nothing: every question is answered by running git, so there is nothing to reload.
+func (c *ExecClient) UpdateRepository() error {
+	return nil
+}
+
+// output runs a git command that doesn't change the repository and returns what it prints.
+func (c *ExecClient) output(eb *GitExecBuilder) ([]byte, error) {
+	var out bytes.Buffer
+	err := eb.WithStdout(&out).SkipUpdate().Run()
+	if err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+func (c *ExecClient) WriteBlob(data []byte) (string, error) {
+	out, err := c.output(c.Exec(`hash-object`).WithArgs(`-w`, `--stdin`).WithStdin(bytes.NewReader(data)))
+	if err != nil {
+		return ``, err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func (c *ExecClient) ReadBlob(id string) ([]byte, error) {
+	return c.output(c.Exec(`cat-file`).WithArgs(`blob`, id))
+}
+
+func (c *ExecClient) UnstagedFiles() ([]File, error) {
+	var res []File
+	err := c.withUntracked(func(indexVar string, untracked map[string]struct{}) error {
+		out, err := c.output(c.diff(indexVar).WithArgs(`--name-status`, `-z`, `--`).WithArgs(c.pathspec...))
+		if err != nil {
+			return err
+		}
+
+		res, err = parseNameStatus(out)
+		if err != nil {
+			return err
+		}
+		for i, f := range res {
+			if _, ok := untracked[f.Path]; ok && f.Status == FileStatusAdded {
+				res[i].Status = FileStatusUntracked
+			}
+		}
+		return nil
+	})
+	return res, err
+}
+
+func (c *ExecClient) StagedFiles() ([]File, error) {
+	out, err := c.output(c.diff(``).WithArgs(`--cached`, `--name-status`, `-z`, `--`).WithArgs(c.pathspec...))
+	if err != nil {
+		return nil, err
+	}
+	return parseNameStatus(out)
+}
+
+func (c *ExecClient) UnstagedChanges(o DiffOptions) ([]string, error) {
+	var res []string
+	err := c.withUntracked(func(indexVar string, _ map[string]struct{}) error {
+		out, err := c.output(c.diff(indexVar).WithArgs(diffArgs(o)...).WithArgs(`--`).WithArgs(c.pathspec...))
+		if err != nil {
+			return err
+		}
+		res = splitPatches(string(out))
+		return nil
+	})
+	return res, err
+}
+
+func (c *ExecClient) StagedChanges(o DiffOptions) ([]string, error) {
+	out, err := c.output(c.diff(``).WithArgs(`--cached`).WithArgs(diffArgs(o)...).WithArgs(`--`).WithArgs(c.pathspec...))
+	if err != nil {
+		return nil, err
+	}
+	return splitPatches(string(out)), nil
+}
+
+func (c *ExecClient) StagedStats(o DiffOptions) (DiffStats, error) {
+	out, err := c.output(c.diff(``).WithArgs(`--cached`, `--numstat`, `-z`).WithArgs(statArgs(o)...).
+		WithArgs(`--`).WithArgs(c.pathspec...))
+	if err != nil {
+		return DiffStats{}, err
+	}
+
+	stats, _, err := parseNumstat(out)
+	return stats, err
+}
+
+// UnstagedStats counts the unstaged changes without the copy of the index UnstagedChanges needs for untracked files:
+// it counts their lines itself. The copy is only needed when a deleted file could be found renamed to one of them.
+func (c *ExecClient) UnstagedStats(o DiffOptions) (DiffStats, error) {
+	untracked, err := c.untrackedFiles()
+	if err != nil {
+		return DiffStats{}, err
+	}
+
+	out, err := c.output(c.diff(``).WithArgs(`--numstat`, `-z`).WithArgs(statArgs(o)...).WithArgs(`--`).
+		WithArgs(c.pathspec...))
+	if err != nil {
+		return DiffStats{}, err
+	}
+	stats, paths, err := parseNumstat(out)
+	if err != nil {
+		return DiffStats{}, err
+	}
+	if len(untracked) == 0 {
+		return stats, nil
+	}
+
+	for _, p := range paths {
+		_, err := os.Lstat(filepath.Join(c.env.WorkingDir, p))
+		if errors.Is(err, os.ErrNotExist) {
+			return c.unstagedStatsWithRenames(o)
+		}
+	}
+
+	for _, p := range untracked {
+		n, err := countLines(filepath.Join(c.env.WorkingDir, p))
+		if err != nil {
+			return DiffStats{}, err
+		}
+		stats.Files++
+		stats.Additions += n
+	}
+	return stats, nil
+}
+
+func (c *ExecClient) unstagedStatsWithRenames(o DiffOptions) (DiffStats, error) {
+	var stats DiffStats
+	err := c.withUntracked(func(indexVar string, _ map[string]struct{}) error {
+		out, err := c.output(c.diff(indexVar).WithArgs(`--numstat`, `-z`).WithArgs(statArgs(o)...).WithArgs(`--`).
+			WithArgs(c.pathspec...))
+		if err != nil {
+			return err
+		}
+		stats, _, err = parseNumstat(out)
+		return err
+	})
+	return stats, err
+}
+
+// countLines counts the lines git diff shows for a new file: none for binary files, and a single one for links and
+// nested repositories.
+func countLines(path string) (int, error) {
+	fi, err := os.Lstat(path)
+	if err != nil {
+		return 0, err
+	}
+	if !fi.Mode().IsRegular() {
+		return 1, nil
+	}
+
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	// git takes files with a NUL byte near the start for binary.
+	head := bs
+	if len(head) > 8000 {
+		head = head[:8000]
+	}
+	if bytes.IndexByte(head, 0) >= 0 {
+		return 0, nil
+	}
+
+	n := bytes.Count(bs, []byte("\n"))
+	if len(bs) > 0 && bs[len(bs)-1] != '\n' {
+		n++
+	}
+	return n, nil
+}
+
+// parseNumstat parses the output of git diff --numstat -z: the lines added and removed, followed by the path, or by an
+// empty path and then the old and the new path for renames. Binary files have no lines. It returns the paths too, the
+// old ones for renames.
+func parseNumstat(out []byte) (DiffStats, []string, error) {
+	fields := splitNul(out)
+
+	var stats DiffStats
+	var paths []string
+	for i := 0; i < len(fields); i++ {
+		counts := strings.SplitN(fields[i], "\t", 3)
+		if len(counts) != 3 {
+			return DiffStats{}, nil, fmt.Errorf(`unexpected %q in git diff output`, fields[i])
+		}
+
+		path := counts[2]
+		if path == `` {
+			i += 2
+			if i >= len(fields) {
+				return DiffStats{}, nil, errors.New(`truncated git diff output`)
+			}
+			path = fields[i-1]
+		}
+
+		stats.Files++
+		if counts[0] != `-` {
+			added, err := strconv.Atoi(counts[0])
+			if err != nil {
+				return DiffStats{}, nil, fmt.Errorf(`unexpected %q in git diff output`, fields[i])
+			}
+			removed, err := strconv.Atoi(counts[1])
+			if err != nil {
+				return DiffStats{}, nil, fmt.Errorf(`unexpected %q in git diff output`, fields[i])
+			}
+			stats.Additions += added
+			stats.Removals += removed
+		}
+		paths = append(paths, path)
+	}
+	return stats, paths, nil
+}
+
+// diff starts a git diff whose output doesn't depend on the user's configuration, with renames found like libgit2
+// finds them. The content is diffed as it is stored, without textconv, so that patches apply back to the index, and
+// with the algorithm and the order of files libgit2 uses. indexVar, if given, points git at another index.
+func (c *ExecClient) diff(indexVar string) *GitExecBuilder {
+	eb := c.Exec(`diff`).WithArgs(
+		`--no-color`,
+		`--no-ext-diff`,
+		`--no-textconv`,
+		`--diff-algorithm=myers`,
+		`--no-indent-heuristic`,
+		`-O/dev/null`,
+		`--no-relative`,
+		`--src-prefix=a/`,
+		`--dst-prefix=b/`,
+		`--abbrev=7`,
+		`--find-renames`,
+	)
+	if indexVar != `` {
+		eb.WithEnv(indexVar)
+	}
+	return eb
+}
+
+var whitespaceArgs = map[Whitespace]string{
+	IgnoreWhitespaceAtEOL:  `--ignore-space-at-eol`,
+	IgnoreWhitespaceChange: `--ignore-space-change`,
+	IgnoreAllWhitespace:    `--ignore-all-space`,
+}
+
+func diffArgs(o DiffOptions) []string {
+	args := []string{
+		`--unified=` + strconv.Itoa(o.ContextLines),
+		`--inter-hunk-context=` + strconv.Itoa(o.InterhunkLines),
+	}
+	return append(args, statArgs(o)...)
+}
+
+// statArgs are the arguments of diffArgs that change what git diff --numstat counts. The others would make it print
+// the patch as well.
+func statArgs(o DiffOptions) []string {
+	if arg, ok := whitespaceArgs[o.Whitespace]; ok {
+		return []string{arg}
+	}
+	return nil
+}
+
+// withUntracked calls f with a copy of the index in which the untracked files are added with intent to add. Diffs of
+// the working tree against that index show untracked files as new files, and a deleted file and an untracked one with
+// the same content as a rename. indexVar is the environment variable that points git at the copy.
+func (c *ExecClient) withUntracked(f func(indexVar string, untracked map[string]struct{}) error) error {
+	paths, err := c.untrackedFiles()
+	if err != nil {
+		return err
+	}
+
+	untracked := map[string]struct{}{}
+	for _, p := range paths {
+		untracked[p] = struct{}{}
+	}
+	if len(paths) == 0 {
+		return f(``, untracked)
+	}
+
+	dir, err := os.MkdirTemp(``, `istage-index`)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	index := filepath.Join(dir, `index`)
+	err = copyFile(filepath.Join(c.env.RepoDir, `index`), index)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	indexVar := `GIT_INDEX_FILE=` + index
+	err = c.Exec(`add`).WithArgs(`--intent-to-add`, `--`).WithArgs(paths...).WithEnv(indexVar).SkipUpdate().Run()
+	if err != nil {
+		return err
+	}
+
+	return f(indexVar, untracked)
+}
+
+func (c *ExecClient) untrackedFiles() ([]string, error) {
+	out, err := c.output(c.Exec(`ls-files`).WithArgs(`--others`, `--exclude-standard`, `-z`, `--`).WithArgs(c.pathspec...))
+	if err != nil {
+		return nil, err
+	}
+	return splitNul(out), nil
+}
+
+func copyFile(from, to string) error {
+	src, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.Create(to)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	_, err = io.Copy(dst, src)
+	return err
+}
+
+func splitNul(out []byte) []string {
+	fields := strings.Split(string(out), "\x00")
+	if len(fields) > 0 && fields[len(fields)-1] == `` {
+		fields = fields[:len(fields)-1]
+	}
+	return fields
+}
+
+var nameStatuses = map[byte]FileStatus{
+	'A': FileStatusAdded,
+	'C': FileStatusCopied,
+	'D': FileStatusDeleted,
+	'M': FileStatusModified,
+	'R': FileStatusRenamed,
+	'T': FileStatusTypeChange,
+	'U': FileStatusConflicted,
+	'X': FileStatusUnreadable,
+}
+
+// parseNameStatus parses the output of git diff --name-status -z: a status, followed by the path, or by the old and the
+// new path for renames and copies.
+func parseNameStatus(out []byte) ([]File, error) {
+	fields := splitNul(out)
+
+	var res []File
+	for i := 0; i < len(fields); i++ {
+		if fields[i] == `` {
+			return nil, errors.New(`empty status in git diff output`)
+		}
+		status, ok := nameStatuses[fields[i][0]]
+		if !ok {
+			return nil, fmt.Errorf(`unknown status %q in git diff output`, fields[i])
+		}
+
+		if status == FileStatusRenamed || status == FileStatusCopied {
+			// Skip the old path.
+			i++
+		}
+		i++
+		if i >= len(fields) {
+			return nil, errors.New(`truncated git diff output`)
+		}
+
+		res = append(res, File{
+			Path:   fields[i],
+			Status: status,
+		})
+	}
+	return res, nil
+}
+
+// splitPatches cuts the output of git diff into the patches of each file.
+func splitPatches(out string) []string {
+	var res []string
+	for out != `` {
+		next := strings.Index(out, "\ndiff --git ")
+		if next < 0 {
+			res = append(res, out)
+			break
+		}
+		res = append(res, out[:next+1])
+		out = out[next+1:]
+	}
+	return res
+}
+
+func (c *ExecClient) Branch() (BranchInfo, error) {
+	out, err := c.output(c.Exec(`status`).
+		WithArgs(`--porcelain=v2`, `--branch`, `--untracked-files=no`, `--ignore-submodules`, `-z`).
+		WithEnv(`GIT_OPTIONAL_LOCKS=0`))
+	if err != nil {
+		return BranchInfo{}, err
+	}
+
+	var info BranchInfo
+	for _, field := range splitNul(out) {
+		header, ok := strings.CutPrefix(field, `# branch.`)
+		if !ok {
+			continue
+		}
+		key, value, _ := strings.Cut(header, ` `)
+
+		switch key {
+		case `oid`:
+			if value != `(initial)` {
+				info.Commit = value[:7]
+			}
+		case `head`:
+			if value != `(detached)` {
+				info.Name = value
+			}
+		case `upstream`:
+			info.Upstream = value
+		case `ab`:
+			_, err := fmt.Sscanf(value, `+%d -%d`, &info.Ahead, &info.Behind)
+			if err != nil {
+				return BranchInfo{}, fmt.Errorf(`failed to parse ahead and behind counts %q: %w`, value, err)
+			}
+		}
+	}
+	return info, nil
+}
@@ -0,0 +1,526 @@
+// Package gitfake has a git.Backend that keeps a repository in memory, for testing the services and the UI without a
+// real repository.
+package gitfake
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/cszczepaniak/go-istage/git"
+	"github.com/cszczepaniak/go-istage/patch"
+)
+
+// Patch is a patch that was applied to the repository, or unapplied if Reverted is set.
+type Patch struct {
+	Contents  string
+	Direction patch.Direction
+	Reverted  bool
+}
+
+// Repo is a repository held in memory. Its files and changes are whatever the test sets. Staging and unstaging files
+// move them from one side to the other, committing clears the staged side, and patches are only recorded. The index of
+// a file is its staged file and change, which saving and restoring the index keeps.
+type Repo struct {
+	mu sync.Mutex
+
+	root     string
+	branch   git.BranchInfo
+	pathspec []string
+
+	unstagedFiles   []git.File
+	stagedFiles     []git.File
+	unstagedChanges []string
+	stagedChanges   []string
+
+	diffOptions git.DiffOptions
+	patches     []Patch
+	commits     []string
+	blobs       map[string][]byte
+	kept        map[string][]string
+	indexed     map[string]staged
+	cancels     int
+
+	err error
+}
+
+func New(root string) *Repo {
+	return &Repo{
+		root: root,
+		branch: git.BranchInfo{
+			Name:   `master`,
+			Commit: `0000000`,
+		},
+		blobs:   map[string][]byte{},
+		kept:    map[string][]string{},
+		indexed: map[string]staged{},
+	}
+}
+
+// staged is a file on the staged side, with its change.
+type staged struct {
+	file   git.File
+	change string
+}
+
+// SetUnstaged sets the unstaged files and their changes, one patch per file like git.Backend returns them.
+func (r *Repo) SetUnstaged(files []git.File, changes ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.unstagedFiles = files
+	r.unstagedChanges = changes
+}
+
+// SetStaged sets the staged files and their changes, one patch per file like git.Backend returns them.
+func (r *Repo) SetStaged(files []git.File, changes ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.stagedFiles = files
+	r.stagedChanges = changes
+}
+
+func (r *Repo) SetBranch(bi git.BranchInfo) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.branch = bi
+}
+
+// Fail makes every call that can fail return err, until it's called again with nil.
+func (r *Repo) Fail(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.err = err
+}
+
+// Patches returns the patches applied and unapplied so far, in order.
+func (r *Repo) Patches() []Patch {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]Patch(nil), r.patches...)
+}
+
+// Commits returns the messages of the commits made so far, in order.
+func (r *Repo) Commits() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]string(nil), r.commits...)
+}
+
+// DiffOptions returns the options of the last request for changes.
+func (r *Repo) DiffOptions() git.DiffOptions {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.diffOptions
+}
+
+// Kept returns the ids of the blobs kept by the given ref, in the order they were kept.
+func (r *Repo) Kept(ref string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]string(nil), r.kept[ref]...)
+}
+
+// Cancels returns how many times CancelCommands was called.
+func (r *Repo) Cancels() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.cancels
+}
+
+// CancelCommands only counts the calls, since the fake has no commands that take time.
+func (r *Repo) CancelCommands() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.cancels++
+}
+
+func (r *Repo) Root() string {
+	return r.root
+}
+
+func (r *Repo) Branch() (git.BranchInfo, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.branch, r.err
+}
+
+func (r *Repo) LimitToPaths(pathspec []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.pathspec = pathspec
+}
+
+func (r *Repo) UnstagedFiles() ([]git.File, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.err != nil {
+		return nil, r.err
+	}
+	return r.filterFiles(r.unstagedFiles), nil
+}
+
+func (r *Repo) StagedFiles() ([]git.File, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.err != nil {
+		return nil, r.err
+	}
+	return r.filterFiles(r.stagedFiles), nil
+}
+
+func (r *Repo) UnstagedChanges(opts git.DiffOptions) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.diffOptions = opts
+	if r.err != nil {
+		return nil, r.err
+	}
+	return r.filterChanges(r.unstagedChanges), nil
+}
+
+func (r *Repo) StagedChanges(opts git.DiffOptions) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.diffOptions = opts
+	if r.err != nil {
+		return nil, r.err
+	}
+	return r.filterChanges(r.stagedChanges), nil
+}
+
+func (r *Repo) UnstagedStats(opts git.DiffOptions) (git.DiffStats, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.diffOptions = opts
+	if r.err != nil {
+		return git.DiffStats{}, r.err
+	}
+	return r.stats(r.unstagedFiles, r.unstagedChanges), nil
+}
+
+func (r *Repo) StagedStats(opts git.DiffOptions) (git.DiffStats, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.diffOptions = opts
+	if r.err != nil {
+		return git.DiffStats{}, r.err
+	}
+	return r.stats(r.stagedFiles, r.stagedChanges), nil
+}
+
+// stats counts the files and the lines of the changes that were set.
+func (r *Repo) stats(files []git.File, changes []string) git.DiffStats {
+	stats := git.DiffStats{
+		Files: len(r.filterFiles(files)),
+	}
+	for _, l := range patch.ParseDocument(r.filterChanges(changes)).Lines {
+		switch l.Kind {
+		case patch.AdditionLine:
+			stats.Additions++
+		case patch.RemovalLine:
+			stats.Removals++
+		}
+	}
+	return stats
+}
+
+func (r *Repo) ApplyPatch(patchContents string, dir patch.Direction) error {
+	return r.recordPatch(Patch{
+		Contents:  patchContents,
+		Direction: dir,
+	})
+}
+
+func (r *Repo) UnapplyPatch(patchContents string, dir patch.Direction) error {
+	return r.recordPatch(Patch{
+		Contents:  patchContents,
+		Direction: dir,
+		Reverted:  true,
+	})
+}
+
+func (r *Repo) recordPatch(p Patch) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.err != nil {
+		return r.err
+	}
+	r.patches = append(r.patches, p)
+	return nil
+}
+
+func (r *Repo) StageFiles(files []git.File) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.err != nil {
+		return r.err
+	}
+	r.unstagedFiles, r.stagedFiles = moveFiles(files, r.unstagedFiles, r.stagedFiles)
+	return nil
+}
+
+// IndexEntries returns an entry for each of the files that are staged, named after their change.
+func (r *Repo) IndexEntries(paths []string) ([]git.IndexEntry, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	var res []git.IndexEntry
+	for _, p := range paths {
+		s, ok := r.stagedFile(p)
+		if !ok {
+			continue
+		}
+
+		sum := sha1.Sum([]byte(s.change))
+		id := hex.EncodeToString(sum[:])
+		r.indexed[id] = s
+		res = append(res, git.IndexEntry{Path: p, Mode: `100644`, ID: id})
+	}
+	return res, nil
+}
+
+// RestoreIndex unstages the files and stages the ones with entries again as they were when the entries were saved.
+func (r *Repo) RestoreIndex(paths []string, entries []git.IndexEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.err != nil {
+		return r.err
+	}
+
+	var files []git.File
+	for _, p := range paths {
+		files = append(files, git.File{Path: p})
+	}
+	r.stagedFiles, r.unstagedFiles = moveFiles(files, r.stagedFiles, r.unstagedFiles)
+	r.stagedChanges = r.removeChanges(paths, r.stagedChanges)
+
+	for _, e := range entries {
+		s, ok := r.indexed[e.ID]
+		if !ok {
+			return fmt.Errorf(`index entry %s not found`, e.ID)
+		}
+		r.stagedFiles = append(r.stagedFiles, s.file)
+		if s.change != `` {
+			r.stagedChanges = append(r.stagedChanges, s.change)
+		}
+	}
+	return nil
+}
+
+// stagedFile returns the staged file with the given path and its change, if it has one.
+func (r *Repo) stagedFile(path string) (staged, bool) {
+	for _, f := range r.stagedFiles {
+		if f.Path != path {
+			continue
+		}
+
+		s := staged{file: f}
+		for _, c := range r.stagedChanges {
+			if changePath(c) == path {
+				s.change = c
+			}
+		}
+		return s, true
+	}
+	return staged{}, false
+}
+
+func (r *Repo) removeChanges(paths []string, changes []string) []string {
+	var res []string
+	for _, c := range changes {
+		keep := true
+		for _, p := range paths {
+			if changePath(c) == p {
+				keep = false
+			}
+		}
+		if keep {
+			res = append(res, c)
+		}
+	}
+	return res
+}
+
+// changePath returns the path of the file a change is to.
+func changePath(change string) string {
+	doc := patch.ParseDocument([]string{change})
+	if len(doc.Entries) == 0 {
+		return ``
+	}
+	ch := doc.Entries[0].Changes
+	if ch.Path == `` {
+		return ch.OldPath
+	}
+	return ch.Path
+}
+
+func (r *Repo) UnstageFiles(files []git.File) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.err != nil {
+		return r.err
+	}
+	r.stagedFiles, r.unstagedFiles = moveFiles(files, r.stagedFiles, r.unstagedFiles)
+	return nil
+}
+
+// moveFiles moves the files with the same paths as the given ones from one side to the other, where partially staged
+// files already are.
+func moveFiles(files, from, to []git.File) ([]git.File, []git.File) {
+	paths := map[string]struct{}{}
+	for _, f := range files {
+		paths[f.Path] = struct{}{}
+	}
+	onTo := map[string]struct{}{}
+	for _, f := range to {
+		onTo[f.Path] = struct{}{}
+	}
+
+	var rest []git.File
+	for _, f := range from {
+		_, move := paths[f.Path]
+		_, present := onTo[f.Path]
+		switch {
+		case move && !present:
+			to = append(to, f)
+		case !move:
+			rest = append(rest, f)
+		}
+	}
+	return rest, to
+}
+
+func (r *Repo) Commit(msg string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.err != nil {
+		return r.err
+	}
+	if len(r.stagedFiles) == 0 {
+		return errors.New(`nothing to commit`)
+	}
+
+	r.commits = append(r.commits, msg)
+	r.stagedFiles = nil
+	r.stagedChanges = nil
+	return nil
+}
+
+func (r *Repo) WriteBlob(data []byte) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.err != nil {
+		return ``, r.err
+	}
+
+	// The same id as git's, so that tests can compare them.
+	sum := sha1.Sum(append([]byte(fmt.Sprintf("blob %d\x00", len(data))), data...))
+	id := hex.EncodeToString(sum[:])
+	r.blobs[id] = append([]byte(nil), data...)
+	return id, nil
+}
+
+func (r *Repo) ReadBlob(id string) ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	data, ok := r.blobs[id]
+	if !ok {
+		return nil, fmt.Errorf(`blob %s not found`, id)
+	}
+	return data, nil
+}
+
+func (r *Repo) KeepBlob(ref, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.err != nil {
+		return r.err
+	}
+	if _, ok := r.blobs[id]; !ok {
+		return fmt.Errorf(`blob %s not found`, id)
+	}
+
+	for _, k := range r.kept[ref] {
+		if k == id {
+			return nil
+		}
+	}
+	r.kept[ref] = append(r.kept[ref], id)
+	return nil
+}
+
+// matches returns whether the path is one of the pathspecs or beneath one of them. Patterns aren't supported.
+func (r *Repo) matches(path string) bool {
+	if len(r.pathspec) == 0 {
+		return true
+	}
+	for _, p := range r.pathspec {
+		if path == p || strings.HasPrefix(path, strings.TrimSuffix(p, `/`)+`/`) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Repo) filterFiles(files []git.File) []git.File {
+	var res []git.File
+	for _, f := range files {
+		if r.matches(f.Path) {
+			res = append(res, f)
+		}
+	}
+	return res
+}
+
+func (r *Repo) filterChanges(changes []string) []string {
+	var res []string
+	for _, c := range changes {
+		doc := patch.ParseDocument([]string{c})
+		if len(doc.Entries) == 0 {
+			continue
+		}
+
+		ch := doc.Entries[0].Changes
+		if r.matches(ch.Path) || ch.Path == `` && r.matches(ch.OldPath) {
+			res = append(res, c)
+		}
+	}
+	return res
+}
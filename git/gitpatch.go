@@ -0,0 +1,164 @@
+package git
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// gitPatch gives a patch computed by the patch package the headers of git's own diffs, which libgit2 needs to parse
+// it. libgit2 can only apply patches forwards, so it also reverses the patch if asked, like git apply --reverse.
+func gitPatch(patchContents string, reverse bool) (string, error) {
+	lines := strings.SplitAfter(patchContents, "\n")
+
+	var sb strings.Builder
+	var f patchFile
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		switch {
+		case line == ``:
+		case strings.HasPrefix(line, `new file mode `):
+			f.mode = strings.TrimSpace(strings.TrimPrefix(line, `new file mode `))
+		case strings.HasPrefix(line, `--- `):
+			f.oldPath = strings.TrimRight(strings.TrimPrefix(line, `--- `), "\r\n")
+		case strings.HasPrefix(line, `+++ `):
+			f.newPath = strings.TrimRight(strings.TrimPrefix(line, `+++ `), "\r\n")
+			if reverse {
+				f = f.reversed()
+			}
+			f.writeHeader(&sb)
+			f = patchFile{}
+		case strings.HasPrefix(line, `@@ `):
+			n, err := writeGitHunk(&sb, lines[i:], reverse)
+			if err != nil {
+				return ``, err
+			}
+			i += n - 1
+		default:
+			return ``, fmt.Errorf(`unexpected line in patch: %q`, line)
+		}
+	}
+
+	return sb.String(), nil
+}
+
+// patchFile is the header of the changes to one file: its paths with their a/ and b/ prefixes, or /dev/null for the
+// side where it doesn't exist, which then has the file's mode.
+type patchFile struct {
+	oldPath string
+	newPath string
+	mode    string
+	deleted bool
+}
+
+const devNull = `/dev/null`
+
+func (f patchFile) reversed() patchFile {
+	return patchFile{
+		oldPath: swapPrefix(f.newPath, `b/`, `a/`),
+		newPath: swapPrefix(f.oldPath, `a/`, `b/`),
+		mode:    f.mode,
+		deleted: f.mode != ``,
+	}
+}
+
+func swapPrefix(path, from, to string) string {
+	if path == devNull {
+		return path
+	}
+	return to + strings.TrimPrefix(path, from)
+}
+
+func (f patchFile) writeHeader(sb *strings.Builder) {
+	oldPath, newPath := f.oldPath, f.newPath
+	if oldPath == devNull {
+		oldPath = swapPrefix(newPath, `b/`, `a/`)
+	}
+	if newPath == devNull {
+		newPath = swapPrefix(oldPath, `a/`, `b/`)
+	}
+
+	fmt.Fprintf(sb, "diff --git %s %s\n", quotePath(oldPath), quotePath(newPath))
+	switch {
+	case f.deleted:
+		fmt.Fprintf(sb, "deleted file mode %s\n", f.mode)
+	case f.mode != ``:
+		fmt.Fprintf(sb, "new file mode %s\n", f.mode)
+	case strings.TrimPrefix(oldPath, `a/`) != strings.TrimPrefix(newPath, `b/`):
+		fmt.Fprintf(sb, "rename from %s\n", quotePath(strings.TrimPrefix(oldPath, `a/`)))
+		fmt.Fprintf(sb, "rename to %s\n", quotePath(strings.TrimPrefix(newPath, `b/`)))
+	}
+	fmt.Fprintf(sb, "--- %s\n", f.oldPath)
+	fmt.Fprintf(sb, "+++ %s\n", f.newPath)
+}
+
+// quotePath quotes a path of the diff --git line like git does, since its two paths are only separated by a space.
+func quotePath(path string) string {
+	if !strings.ContainsAny(path, " \t\n\"\\") {
+		return path
+	}
+	return strconv.Quote(path)
+}
+
+// writeGitHunk writes the hunk at the start of lines, reversed if asked, and returns how many lines it took up. The
+// lengths in the hunk header tell where it ends, since its lines may look like anything.
+func writeGitHunk(sb *strings.Builder, lines []string, reverse bool) (int, error) {
+	header := lines[0]
+	fields := strings.Fields(header)
+	if len(fields) < 4 || fields[3] != `@@` {
+		return 0, fmt.Errorf(`invalid hunk header %q`, header)
+	}
+
+	oldLength, err := rangeLength(fields[1])
+	if err != nil {
+		return 0, err
+	}
+	newLength, err := rangeLength(fields[2])
+	if err != nil {
+		return 0, err
+	}
+
+	if reverse {
+		header = fmt.Sprintf("@@ -%s +%s @@%s", fields[2][1:], fields[1][1:], header[strings.Index(header[2:], `@@`)+4:])
+	}
+	sb.WriteString(header)
+
+	// The no newline marker after the last line still belongs to the hunk.
+	n := 1
+	for ; n < len(lines) && lines[n] != `` && (oldLength > 0 || newLength > 0 || lines[n][0] == '\\'); n++ {
+		line := lines[n]
+		switch line[0] {
+		case ' ':
+			oldLength--
+			newLength--
+		case '-':
+			oldLength--
+		case '+':
+			newLength--
+		case '\\':
+		default:
+			return 0, fmt.Errorf(`unexpected line in hunk: %q`, line)
+		}
+
+		if reverse && line[0] == '-' {
+			line = `+` + line[1:]
+		} else if reverse && line[0] == '+' {
+			line = `-` + line[1:]
+		}
+		sb.WriteString(line)
+	}
+
+	if oldLength != 0 || newLength != 0 {
+		return 0, fmt.Errorf(`hunk %q doesn't match its lines`, strings.TrimSpace(lines[0]))
+	}
+	return n, nil
+}
+
+// rangeLength returns the number of lines of a range of a hunk header, like -3,2 or +4.
+func rangeLength(r string) (int, error) {
+	_, length, ok := strings.Cut(r, `,`)
+	if !ok {
+		return 1, nil
+	}
+	return strconv.Atoi(length)
+}
@@ -0,0 +1,77 @@
+package git
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// IndexEntry is a file as the index has it: the blob staged for it, or one of the sides of a conflict.
+type IndexEntry struct {
+	Path  string
+	Mode  string
+	ID    string
+	Stage int
+}
+
+// IndexEntries returns the entries the index has for the given files. Files that aren't in the index have none.
+func (c *commands) IndexEntries(paths []string) ([]IndexEntry, error) {
+	if len(paths) == 0 {
+		return nil, nil
+	}
+
+	var out strings.Builder
+	err := c.Exec(`ls-files`).
+		WithArgs(append([]string{`--stage`, `-z`, `--`}, paths...)...).
+		WithStdout(&out).
+		SkipUpdate().
+		Run()
+	if err != nil {
+		return nil, err
+	}
+
+	var res []IndexEntry
+	for _, rec := range strings.Split(out.String(), "\x00") {
+		if rec == `` {
+			continue
+		}
+
+		// Each entry is `<mode> <id> <stage>\t<path>`.
+		info, path, ok := strings.Cut(rec, "\t")
+		fields := strings.Fields(info)
+		if !ok || len(fields) != 3 {
+			return nil, fmt.Errorf(`unexpected index entry %q`, rec)
+		}
+		stage, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return nil, fmt.Errorf(`unexpected index entry %q`, rec)
+		}
+
+		res = append(res, IndexEntry{
+			Path:  path,
+			Mode:  fields[0],
+			ID:    fields[1],
+			Stage: stage,
+		})
+	}
+	return res, nil
+}
+
+// RestoreIndex makes the index have exactly the given entries for the given files, like IndexEntries returned them.
+// Files without entries are removed from the index.
+func (c *commands) RestoreIndex(paths []string, entries []IndexEntry) error {
+	if len(paths) == 0 {
+		return nil
+	}
+
+	err := c.Exec(`update-index`).WithArgs(append([]string{`--force-remove`, `--`}, paths...)...).Run()
+	if err != nil || len(entries) == 0 {
+		return err
+	}
+
+	var info strings.Builder
+	for _, e := range entries {
+		fmt.Fprintf(&info, "%s %s %d\t%s\x00", e.Mode, e.ID, e.Stage, e.Path)
+	}
+	return c.Exec(`update-index`).WithArgs(`-z`, `--index-info`).WithStdin(strings.NewReader(info.String())).Run()
+}
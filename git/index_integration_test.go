@@ -0,0 +1,49 @@
+package git
+
+import (
+	"testing"
+
+	"github.com/cszczepaniak/go-istage/patch"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRestoreIndex(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, newClient newClientFunc) {
+		r := NewTestRepo(t)
+		f := r.MakeFile(t, `a.txt`).Add("1\n2\n3\n").ShouldCommit(`abc`).Build()
+		f.Replace("one\n2\nthree\n")
+		r.MakeFile(t, `b.txt`).AddLine(`x`).Build()
+
+		gc, err := newClient(r.env)
+		require.NoError(t, err)
+
+		unstaged, err := gc.UnstagedChanges(DefaultDiffOptions())
+		require.NoError(t, err)
+		stage := computePatch(t, unstaged, patch.Stage, `-1`, `+one`)
+		require.NoError(t, gc.ApplyPatch(stage, patch.Stage))
+
+		paths := []string{`a.txt`, `b.txt`}
+		entries, err := gc.IndexEntries(paths)
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		assert.Equal(t, `a.txt`, entries[0].Path)
+		assert.Equal(t, `100644`, entries[0].Mode)
+
+		require.NoError(t, gc.StageFiles([]File{{Path: `a.txt`}, {Path: `b.txt`}}))
+		require.NoError(t, gc.RestoreIndex(paths, entries))
+
+		staged, err := gc.StagedChanges(DefaultDiffOptions())
+		require.NoError(t, err)
+		require.Len(t, staged, 1)
+		assert.Contains(t, staged[0], "-1\n+one\n")
+		assert.NotContains(t, staged[0], `three`)
+
+		files, err := gc.UnstagedFiles()
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []File{
+			{Path: `a.txt`, Status: FileStatusModified},
+			{Path: `b.txt`, Status: FileStatusUntracked},
+		}, files)
+	})
+}
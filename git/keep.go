@@ -0,0 +1,40 @@
+package git
+
+import (
+	"fmt"
+	"strings"
+)
+
+// KeepBlob makes a blob reachable from the given ref, so that git gc doesn't prune it. The ref points to a tree that
+// has every blob kept this way, each named after its id.
+func (c *commands) KeepBlob(ref, id string) error {
+	var old strings.Builder
+	err := c.Exec(`for-each-ref`).WithArgs(`--format=%(objectname)`, ref).WithStdout(&old).SkipUpdate().Run()
+	if err != nil {
+		return err
+	}
+	oldTree := strings.TrimSpace(old.String())
+
+	var entries strings.Builder
+	if oldTree != `` {
+		err = c.Exec(`ls-tree`).WithArgs(`-z`, oldTree).WithStdout(&entries).SkipUpdate().Run()
+		if err != nil {
+			return err
+		}
+		for _, rec := range strings.Split(entries.String(), "\x00") {
+			if _, name, _ := strings.Cut(rec, "\t"); name == id {
+				return nil
+			}
+		}
+	}
+	fmt.Fprintf(&entries, "100644 blob %s\t%s\x00", id, id)
+
+	var tree strings.Builder
+	err = c.Exec(`mktree`).WithArgs(`-z`).WithStdin(strings.NewReader(entries.String())).WithStdout(&tree).SkipUpdate().Run()
+	if err != nil {
+		return err
+	}
+
+	// Passing the old tree, or nothing when there was none, fails if someone else kept a blob in the meantime.
+	return c.Exec(`update-ref`).WithArgs(ref, strings.TrimSpace(tree.String()), oldTree).SkipUpdate().Run()
+}
@@ -0,0 +1,425 @@
+//go:build !nolibgit
+
+package git
+
+import (
+	"strings"
+
+	"github.com/cszczepaniak/go-istage/nolibgit"
+	git "github.com/libgit2/git2go/v34"
+)
+
+const hasLibGit2 = true
+
+// Client reads the repository with libgit2.
+type Client struct {
+	commands
+
+	session *session
+	// inProcessApply applies patches with libgit2 rather than with git apply.
+	inProcessApply bool
+}
+
+func NewClient(env nolibgit.Environment) (*Client, error) {
+	s, err := openSession(env.RepoDir)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{session: s}
+	c.commands = commands{
+		env:    env,
+		update: c.UpdateRepository,
+	}
+	return c, nil
+}
+
+func newLibGit2Backend(env nolibgit.Environment, opts Options) (Backend, error) {
+	c, err := NewClient(env)
+	if err != nil {
+		return nil, err
+	}
+	c.inProcessApply = opts.ApplyInProcess
+	c.timeouts = opts.Timeouts
+	return c, nil
+}
+
+// UpdateRepository reloads what a command changed in the repository.
+func (c *Client) UpdateRepository() error {
+	return c.session.refresh()
+}
+
+func (c *Client) WriteBlob(data []byte) (string, error) {
+	s, err := c.session.lock()
+	if err != nil {
+		return ``, err
+	}
+	defer s.unlock()
+
+	oid, err := s.repo.CreateBlobFromBuffer(data)
+	if err != nil {
+		return ``, err
+	}
+	return oid.String(), nil
+}
+
+func (c *Client) ReadBlob(id string) ([]byte, error) {
+	s, err := c.session.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer s.unlock()
+
+	oid, err := git.NewOid(id)
+	if err != nil {
+		return nil, err
+	}
+
+	blob, err := s.repo.LookupBlob(oid)
+	if err != nil {
+		return nil, err
+	}
+	defer blob.Free()
+
+	return blob.Contents(), nil
+}
+
+func (c *Client) UnstagedFiles() ([]File, error) {
+	s, err := c.session.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer s.unlock()
+
+	opts := &git.StatusOptions{
+		Show:     git.StatusShowWorkdirOnly,
+		Flags:    git.StatusOptIncludeUntracked | git.StatusOptRecurseUntrackedDirs | git.StatusOptRenamesIndexToWorkdir,
+		Pathspec: c.pathspec,
+	}
+	sl, err := s.repo.StatusList(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := sl.EntryCount()
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]File, 0, n)
+	for i := 0; i < n; i++ {
+		e, err := sl.ByIndex(i)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, File{
+			Path:   e.IndexToWorkdir.NewFile.Path,
+			Status: fileStatusFromGitDelta(e.IndexToWorkdir.Status),
+		})
+	}
+
+	return res, nil
+}
+
+func (c *Client) StagedFiles() ([]File, error) {
+	s, err := c.session.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer s.unlock()
+
+	opts := &git.StatusOptions{
+		Show:     git.StatusShowIndexOnly,
+		Flags:    git.StatusOptIncludeUntracked | git.StatusOptRecurseUntrackedDirs | git.StatusOptRenamesHeadToIndex,
+		Pathspec: c.pathspec,
+	}
+	sl, err := s.repo.StatusList(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := sl.EntryCount()
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]File, 0, n)
+	for i := 0; i < n; i++ {
+		e, err := sl.ByIndex(i)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, File{
+			Path:   e.HeadToIndex.NewFile.Path,
+			Status: fileStatusFromGitDelta(e.HeadToIndex.Status),
+		})
+	}
+
+	return res, nil
+}
+
+var whitespaceFlags = map[Whitespace]git.DiffOptionsFlag{
+	IgnoreWhitespaceAtEOL:  git.DiffIgnoreWhitespaceEOL,
+	IgnoreWhitespaceChange: git.DiffIgnoreWhitespaceChange,
+	IgnoreAllWhitespace:    git.DiffIgnoreWhitespace,
+}
+
+func (c *Client) diffOptions(o DiffOptions) (git.DiffOptions, error) {
+	opts, err := git.DefaultDiffOptions()
+	if err != nil {
+		return git.DiffOptions{}, err
+	}
+	opts.ContextLines = uint32(o.ContextLines)
+	opts.InterhunkLines = uint32(o.InterhunkLines)
+	opts.Flags |= whitespaceFlags[o.Whitespace]
+	opts.Pathspec = c.pathspec
+	return opts, nil
+}
+
+func (c *Client) UnstagedChanges(o DiffOptions) ([]string, error) {
+	s, err := c.session.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer s.unlock()
+
+	diff, err := c.unstagedDiff(s, o)
+	if err != nil {
+		return nil, err
+	}
+	defer diff.Free()
+
+	return patchesFromDiff(diff)
+}
+
+func (c *Client) StagedChanges(o DiffOptions) ([]string, error) {
+	s, err := c.session.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer s.unlock()
+
+	diff, err := c.stagedDiff(s, o)
+	if err != nil {
+		return nil, err
+	}
+	defer diff.Free()
+
+	return patchesFromDiff(diff)
+}
+
+func (c *Client) UnstagedStats(o DiffOptions) (DiffStats, error) {
+	s, err := c.session.lock()
+	if err != nil {
+		return DiffStats{}, err
+	}
+	defer s.unlock()
+
+	diff, err := c.unstagedDiff(s, withoutContext(o))
+	if err != nil {
+		return DiffStats{}, err
+	}
+	defer diff.Free()
+
+	return statsFromDiff(diff)
+}
+
+func (c *Client) StagedStats(o DiffOptions) (DiffStats, error) {
+	s, err := c.session.lock()
+	if err != nil {
+		return DiffStats{}, err
+	}
+	defer s.unlock()
+
+	diff, err := c.stagedDiff(s, withoutContext(o))
+	if err != nil {
+		return DiffStats{}, err
+	}
+	defer diff.Free()
+
+	return statsFromDiff(diff)
+}
+
+func (c *Client) unstagedDiff(s *session, o DiffOptions) (*git.Diff, error) {
+	opts, err := c.diffOptions(o)
+	if err != nil {
+		return nil, err
+	}
+	opts.Flags |= git.DiffShowUntrackedContent
+	opts.Flags |= git.DiffRecurseUntracked
+
+	diff, err := s.repo.DiffIndexToWorkdir(s.index, &opts)
+	if err != nil {
+		return nil, err
+	}
+
+	err = handleRenames(diff)
+	if err != nil {
+		diff.Free()
+		return nil, err
+	}
+	return diff, nil
+}
+
+func (c *Client) stagedDiff(s *session, o DiffOptions) (*git.Diff, error) {
+	opts, err := c.diffOptions(o)
+	if err != nil {
+		return nil, err
+	}
+
+	diff, err := s.repo.DiffTreeToIndex(s.headTree, s.index, &opts)
+	if err != nil {
+		return nil, err
+	}
+
+	err = handleRenames(diff)
+	if err != nil {
+		diff.Free()
+		return nil, err
+	}
+	return diff, nil
+}
+
+// withoutContext drops the unchanged lines of a diff, which its stats don't count anyway.
+func withoutContext(o DiffOptions) DiffOptions {
+	o.ContextLines = 0
+	o.InterhunkLines = 0
+	return o
+}
+
+func statsFromDiff(diff *git.Diff) (DiffStats, error) {
+	stats, err := diff.Stats()
+	if err != nil {
+		return DiffStats{}, err
+	}
+	defer stats.Free()
+
+	return DiffStats{
+		Files:     stats.FilesChanged(),
+		Additions: stats.Insertions(),
+		Removals:  stats.Deletions(),
+	}, nil
+}
+
+func patchesFromDiff(diff *git.Diff) ([]string, error) {
+	ndl, err := diff.NumDeltas()
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]string, 0, ndl)
+	for i := 0; i < ndl; i++ {
+		p, err := diff.Patch(i)
+		if err != nil {
+			return nil, err
+		}
+
+		txt, err := p.String()
+		if err != nil {
+			return nil, err
+		}
+
+		if txt != `` {
+			res = append(res, txt)
+		}
+	}
+
+	return res, nil
+}
+
+func handleRenames(diff *git.Diff) error {
+	findOpts, err := git.DefaultDiffFindOptions()
+	if err != nil {
+		return err
+	}
+	findOpts.Flags |= git.DiffFindRenames
+	findOpts.Flags |= git.DiffFindForUntracked
+
+	return diff.FindSimilar(&findOpts)
+}
+
+func (c *Client) Branch() (BranchInfo, error) {
+	s, err := c.session.lock()
+	if err != nil {
+		return BranchInfo{}, err
+	}
+	defer s.unlock()
+
+	unborn, err := s.repo.IsHeadUnborn()
+	if err != nil {
+		return BranchInfo{}, err
+	}
+	if unborn {
+		// There are no commits yet, but HEAD still names the branch they will go on.
+		head, err := s.repo.References.Lookup(`HEAD`)
+		if err != nil {
+			return BranchInfo{}, err
+		}
+		defer head.Free()
+
+		return BranchInfo{
+			Name: strings.TrimPrefix(head.SymbolicTarget(), `refs/heads/`),
+		}, nil
+	}
+
+	head, err := s.repo.Head()
+	if err != nil {
+		return BranchInfo{}, err
+	}
+	defer head.Free()
+
+	info := BranchInfo{
+		Commit: head.Target().String()[:7],
+	}
+
+	if !head.IsBranch() {
+		return info, nil
+	}
+	info.Name = head.Shorthand()
+
+	upstream, err := head.Branch().Upstream()
+	if git.IsErrorCode(err, git.ErrorCodeNotFound) {
+		return info, nil
+	}
+	if err != nil {
+		return BranchInfo{}, err
+	}
+	defer upstream.Free()
+
+	info.Upstream = upstream.Shorthand()
+	info.Ahead, info.Behind, err = s.repo.AheadBehind(head.Target(), upstream.Target())
+	if err != nil {
+		return BranchInfo{}, err
+	}
+
+	return info, nil
+}
+
+func fileStatusFromGitDelta(d git.Delta) FileStatus {
+	switch d {
+	case git.DeltaUnmodified:
+		return FileStatusUnmodified
+	case git.DeltaAdded:
+		return FileStatusAdded
+	case git.DeltaDeleted:
+		return FileStatusDeleted
+	case git.DeltaModified:
+		return FileStatusModified
+	case git.DeltaRenamed:
+		return FileStatusRenamed
+	case git.DeltaCopied:
+		return FileStatusCopied
+	case git.DeltaIgnored:
+		return FileStatusIgnored
+	case git.DeltaUntracked:
+		return FileStatusUntracked
+	case git.DeltaTypeChange:
+		return FileStatusTypeChange
+	case git.DeltaUnreadable:
+		return FileStatusUnreadable
+	case git.DeltaConflicted:
+		return FileStatusConflicted
+	}
+
+	panic(`unreachable`)
+}
@@ -0,0 +1,49 @@
+//go:build !nolibgit
+
+package git
+
+import (
+	"github.com/cszczepaniak/go-istage/patch"
+	git "github.com/libgit2/git2go/v34"
+)
+
+func (c *Client) ApplyPatch(patchContents string, dir patch.Direction) error {
+	if !c.inProcessApply {
+		return c.commands.ApplyPatch(patchContents, dir)
+	}
+	return c.applyInProcess(patchContents, dir, dir.IsUndo())
+}
+
+func (c *Client) UnapplyPatch(patchContents string, dir patch.Direction) error {
+	if !c.inProcessApply {
+		return c.commands.UnapplyPatch(patchContents, dir)
+	}
+	return c.applyInProcess(patchContents, dir, !dir.IsUndo())
+}
+
+// applyInProcess applies a patch like applyPatch does, to the index or to the working tree for a reset, but with
+// libgit2, which writes the index itself.
+func (c *Client) applyInProcess(patchContents string, dir patch.Direction, reverse bool) error {
+	contents, err := gitPatch(patchContents, reverse)
+	if err != nil {
+		return err
+	}
+
+	s, err := c.session.lock()
+	if err != nil {
+		return err
+	}
+	defer s.unlock()
+
+	diff, err := git.DiffFromBuffer([]byte(contents), s.repo)
+	if err != nil {
+		return err
+	}
+	defer diff.Free()
+
+	location := git.ApplyLocationIndex
+	if dir == patch.Reset {
+		location = git.ApplyLocationWorkdir
+	}
+	return s.repo.ApplyDiff(diff, location, nil)
+}
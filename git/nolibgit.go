@@ -0,0 +1,15 @@
+//go:build nolibgit
+
+package git
+
+import (
+	"errors"
+
+	"github.com/cszczepaniak/go-istage/nolibgit"
+)
+
+const hasLibGit2 = false
+
+func newLibGit2Backend(nolibgit.Environment, Options) (Backend, error) {
+	return nil, errors.New(`go-istage was built without libgit2`)
+}
@@ -0,0 +1,191 @@
+//go:build !nolibgit
+
+package git
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	git "github.com/libgit2/git2go/v34"
+)
+
+// session keeps a single handle on the repository for the life of a client, and makes it safe to share between the
+// goroutines of the UI, which load documents while commands run. Rather than reopening the repository after every
+// command, it checks whether the index or HEAD changed and only reloads what did.
+type session struct {
+	mu sync.Mutex
+
+	repo   *git.Repository
+	state  repoState
+	loaded bool
+
+	// index and headTree are what diffs are computed from, loaded for the current state.
+	index    *git.Index
+	headTree *git.Tree
+}
+
+// repoState tells whether the repository changed since it was last loaded.
+type repoState struct {
+	index indexStamp
+	// head is the commit HEAD points at, or empty before the first commit.
+	head string
+}
+
+// indexStamp identifies a version of the index file, which git rewrites whenever the index changes.
+type indexStamp struct {
+	modTime int64
+	size    int64
+	// checksum is the end of the file, where git writes the checksum of the rest of it. It catches changes that keep
+	// the size and happen within the resolution of the modification time.
+	checksum [32]byte
+}
+
+func openSession(repoDir string) (*session, error) {
+	repo, err := git.OpenRepository(repoDir)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &session{repo: repo}
+	err = s.refreshLocked()
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// lock gives the repository, up to date, to a single goroutine until it calls unlock.
+func (s *session) lock() (*session, error) {
+	s.mu.Lock()
+
+	err := s.refreshLocked()
+	if err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *session) unlock() {
+	s.mu.Unlock()
+}
+
+// refresh reloads what changed in the repository, after a command or anything else changed it.
+func (s *session) refresh() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.refreshLocked()
+}
+
+func (s *session) refreshLocked() error {
+	indexPath := filepath.Join(s.repo.Path(), `index`)
+	stamp, err := stampIndex(indexPath)
+	if err != nil {
+		return err
+	}
+	head, err := s.headCommit()
+	if err != nil {
+		return err
+	}
+
+	if !s.loaded || stamp != s.state.index {
+		index, err := git.OpenIndex(indexPath)
+		if err != nil {
+			return err
+		}
+		if s.index != nil {
+			s.index.Free()
+		}
+		s.index = index
+		s.state.index = stamp
+	}
+
+	if !s.loaded || head != s.state.head {
+		tree, err := s.lookupTree(head)
+		if err != nil {
+			return err
+		}
+		if s.headTree != nil {
+			s.headTree.Free()
+		}
+		s.headTree = tree
+		s.state.head = head
+	}
+
+	s.loaded = true
+	return nil
+}
+
+// stampIndex returns the stamp of the index file, or the zero stamp if there is no index yet.
+func stampIndex(path string) (indexStamp, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return indexStamp{}, nil
+	}
+	if err != nil {
+		return indexStamp{}, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return indexStamp{}, err
+	}
+
+	st := indexStamp{
+		modTime: fi.ModTime().UnixNano(),
+		size:    fi.Size(),
+	}
+
+	n := int64(len(st.checksum))
+	if n > st.size {
+		n = st.size
+	}
+	_, err = f.ReadAt(st.checksum[:n], st.size-n)
+	if err != nil && err != io.EOF {
+		return indexStamp{}, err
+	}
+
+	return st, nil
+}
+
+func (s *session) headCommit() (string, error) {
+	unborn, err := s.repo.IsHeadUnborn()
+	if err != nil {
+		return ``, err
+	}
+	if unborn {
+		return ``, nil
+	}
+
+	head, err := s.repo.Head()
+	if err != nil {
+		return ``, err
+	}
+	defer head.Free()
+
+	return head.Target().String(), nil
+}
+
+// lookupTree returns the tree of the given commit, or nil for no commit, which diffs take as an empty tree.
+func (s *session) lookupTree(commitID string) (*git.Tree, error) {
+	if commitID == `` {
+		return nil, nil
+	}
+
+	oid, err := git.NewOid(commitID)
+	if err != nil {
+		return nil, err
+	}
+	commit, err := s.repo.LookupCommit(oid)
+	if err != nil {
+		return nil, err
+	}
+	defer commit.Free()
+
+	return commit.Tree()
+}
@@ -0,0 +1,56 @@
+//go:build !nolibgit
+
+package git
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionReloadsOnlyWhatChanged(t *testing.T) {
+	r := NewTestRepo(t)
+	f := r.MakeFile(t, `a.txt`).AddLine(`abc`).ShouldCommit(`abc`).Build()
+	f.Append("def\n")
+
+	gc, err := NewClient(r.env)
+	require.NoError(t, err)
+	s := gc.session
+
+	index, tree := s.index, s.headTree
+	_, err = gc.UnstagedChanges(DefaultDiffOptions())
+	require.NoError(t, err)
+	require.NoError(t, gc.UpdateRepository())
+	assert.Same(t, index, s.index)
+	assert.Same(t, tree, s.headTree)
+
+	// Changes made behind the client's back are picked up too.
+	r.Add(`a.txt`)
+	staged, err := gc.StagedChanges(DefaultDiffOptions())
+	require.NoError(t, err)
+	assert.Len(t, staged, 1)
+	assert.NotSame(t, index, s.index)
+	assert.Same(t, tree, s.headTree)
+
+	require.NoError(t, gc.Commit(`def`))
+	assert.NotSame(t, tree, s.headTree)
+	staged, err = gc.StagedChanges(DefaultDiffOptions())
+	require.NoError(t, err)
+	assert.Empty(t, staged)
+}
+
+func TestSessionBeforeFirstCommit(t *testing.T) {
+	r := NewTestRepo(t)
+	require.NoError(t, Exec(r.env, `update-ref`).WithArgs(`-d`, `HEAD`).Run())
+	r.MakeFile(t, `a.txt`).AddLine(`abc`).ShouldStage().Build()
+
+	gc, err := NewClient(r.env)
+	require.NoError(t, err)
+	assert.Nil(t, gc.session.headTree)
+
+	staged, err := gc.StagedChanges(DefaultDiffOptions())
+	require.NoError(t, err)
+	require.Len(t, staged, 1)
+	assert.Contains(t, staged[0], "+abc\n")
+}
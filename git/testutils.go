@@ -10,7 +10,6 @@ import (
 	"testing"
 
 	"github.com/cszczepaniak/go-istage/nolibgit"
-	git "github.com/libgit2/git2go/v34"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -18,7 +17,6 @@ import (
 type testRepo struct {
 	t    testing.TB
 	env  nolibgit.Environment
-	repo *git.Repository
 	path string
 }
 
@@ -50,19 +48,66 @@ func NewTestRepo(t testing.TB) testRepo {
 	env, err := nolibgit.LoadEnvironment()
 	require.NoError(t, err, `failed to init git environment`)
 
-	repo, err := git.OpenRepository(env.RepoDir)
-	require.NoError(t, err, `failed to open git repository`)
-
 	return testRepo{
 		t:    t,
 		env:  env,
-		repo: repo,
 		path: tempDir,
 	}
 }
 
+// testClient is a backend, along with what tests need to change the repository through it.
+type testClient interface {
+	Backend
+	Exec(name string) *GitExecBuilder
+	UpdateRepository() error
+}
+
+type newClientFunc func(env nolibgit.Environment) (testClient, error)
+
+// testBackend is a backend that tests run with: one of the backends that were built in, with some options.
+type testBackend struct {
+	name string
+	opts Options
+}
+
+func (tb testBackend) String() string {
+	if tb.opts.ApplyInProcess {
+		return tb.name + `-apply-in-process`
+	}
+	return tb.name
+}
+
+func (tb testBackend) newClient(env nolibgit.Environment) (testClient, error) {
+	b, err := NewBackend(tb.name, env, tb.opts)
+	if err != nil {
+		return nil, err
+	}
+	return b.(testClient), nil
+}
+
+func testBackends() []testBackend {
+	var res []testBackend
+	for _, name := range Backends() {
+		res = append(res, testBackend{name: name})
+		if name == LibGit2Backend {
+			res = append(res, testBackend{name: name, opts: Options{ApplyInProcess: true}})
+		}
+	}
+	return res
+}
+
+// forEachBackend runs a test with every backend that was built in, since they must all behave the same way.
+func forEachBackend(t *testing.T, test func(t *testing.T, newClient newClientFunc)) {
+	for _, tb := range testBackends() {
+		tb := tb
+		t.Run(tb.String(), func(t *testing.T) {
+			test(t, tb.newClient)
+		})
+	}
+}
+
 func (tr testRepo) Add(path string) {
-	err := Exec(tr.env, tr.repo, `add`).WithArgs(path).Run()
+	err := Exec(tr.env, `add`).WithArgs(path).Run()
 	require.NoError(tr.t, err)
 }
 
@@ -71,12 +116,12 @@ func (tr testRepo) AddAll() {
 }
 
 func (tr testRepo) ClearUnstagedChanges() {
-	err := Exec(tr.env, tr.repo, `checkout`).WithArgs(`.`).Run()
+	err := Exec(tr.env, `checkout`).WithArgs(`.`).Run()
 	require.NoError(tr.t, err)
 }
 
 func (tr testRepo) Commit(msg string) {
-	err := Exec(tr.env, tr.repo, `commit`).WithArgs(`-m`, msg).Run()
+	err := Exec(tr.env, `commit`).WithArgs(`-m`, msg).Run()
 	require.NoError(tr.t, err)
 }
 
@@ -0,0 +1,65 @@
+package git
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Timeouts are how long git commands may run before they are stopped, by command name like `apply` or `commit`.
+// Commands without a timeout of their own get the one of the empty name, and a zero timeout means none.
+type Timeouts map[string]time.Duration
+
+func DefaultTimeouts() Timeouts {
+	return Timeouts{
+		``: time.Minute,
+		// Commit hooks can take a while, like ones that run tests.
+		`commit`: 10 * time.Minute,
+	}
+}
+
+// For returns the timeout of the given command.
+func (t Timeouts) For(name string) time.Duration {
+	if d, ok := t[name]; ok {
+		return d
+	}
+	return t[``]
+}
+
+// Set changes a timeout from a flag value: `30s` for every command, or `apply=30s` for a single one.
+func (t Timeouts) Set(s string) error {
+	name, value, ok := strings.Cut(s, `=`)
+	if !ok {
+		name, value = ``, s
+	}
+
+	d, err := time.ParseDuration(strings.TrimSpace(value))
+	if err != nil {
+		return err
+	}
+	if d < 0 {
+		return fmt.Errorf(`negative timeout %s`, d)
+	}
+
+	t[strings.TrimSpace(name)] = d
+	return nil
+}
+
+func (t Timeouts) String() string {
+	names := make([]string, 0, len(t))
+	for name := range t {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var parts []string
+	for _, name := range names {
+		if name == `` {
+			parts = append(parts, t[name].String())
+		} else {
+			parts = append(parts, name+`=`+t[name].String())
+		}
+	}
+	return strings.Join(parts, `,`)
+}
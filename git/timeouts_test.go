@@ -0,0 +1,24 @@
+package git
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimeouts(t *testing.T) {
+	ts := DefaultTimeouts()
+	require.NoError(t, ts.Set(`30s`))
+	require.NoError(t, ts.Set(`apply = 2m`))
+	require.NoError(t, ts.Set(`commit=0`))
+
+	assert.Equal(t, 30*time.Second, ts.For(`diff`))
+	assert.Equal(t, 2*time.Minute, ts.For(`apply`))
+	assert.Zero(t, ts.For(`commit`))
+	assert.Equal(t, `30s,apply=2m0s,commit=0s`, ts.String())
+
+	assert.Error(t, ts.Set(`apply=soon`))
+	assert.Error(t, ts.Set(`-1s`))
+}
@@ -0,0 +1,194 @@
+package history
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/cszczepaniak/go-istage/git"
+	"github.com/cszczepaniak/go-istage/patch"
+)
+
+var (
+	ErrNothingToUndo = errors.New(`nothing to undo`)
+	ErrNothingToRedo = errors.New(`nothing to redo`)
+)
+
+// maxOperations bounds the size of the journal on disk; the oldest operations are forgotten first.
+const maxOperations = 500
+
+type OperationKind int
+
+const (
+	PatchOperation OperationKind = iota
+	FileOperation
+)
+
+// Operation is a single change made to the index or the working tree. Patch operations hold the exact patch that was
+// applied, so resets keep a copy of the content they discarded. File operations hold the file they staged or
+// unstaged, or all of them in Files when there were several, and in Index how the index had them before, which is
+// what undoing them puts back.
+type Operation struct {
+	Kind      OperationKind    `json:"kind"`
+	Direction patch.Direction  `json:"direction"`
+	Patch     string           `json:"patch,omitempty"`
+	File      git.File         `json:"file"`
+	Files     []git.File       `json:"files,omitempty"`
+	Index     []git.IndexEntry `json:"index"`
+	Time      time.Time        `json:"time"`
+}
+
+// AllFiles returns the files a file operation staged or unstaged.
+func (o Operation) AllFiles() []git.File {
+	if len(o.Files) > 0 {
+		return o.Files
+	}
+	return []git.File{o.File}
+}
+
+// Paths returns the paths of the files a file operation staged or unstaged.
+func (o Operation) Paths() []string {
+	var res []string
+	for _, f := range o.AllFiles() {
+		res = append(res, f.Path)
+	}
+	return res
+}
+
+type journalFile struct {
+	Operations []Operation `json:"operations"`
+	Applied    int         `json:"applied"`
+}
+
+// Journal is a persistent undo/redo history. The first applied operations have been applied to the repository; the
+// ones after that have been undone and can be redone until a new operation is recorded.
+type Journal struct {
+	mu sync.Mutex
+
+	path       string
+	operations []Operation
+	applied    int
+}
+
+func Open(path string) (*Journal, error) {
+	j := &Journal{
+		path: path,
+	}
+
+	bs, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return j, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var jf journalFile
+	err = json.Unmarshal(bs, &jf)
+	if err != nil {
+		return nil, err
+	}
+
+	j.operations = jf.Operations
+	j.applied = jf.Applied
+	if j.applied < 0 || j.applied > len(j.operations) {
+		j.applied = len(j.operations)
+	}
+
+	return j, nil
+}
+
+func (j *Journal) Record(op Operation) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if op.Time.IsZero() {
+		op.Time = time.Now()
+	}
+
+	j.operations = append(j.operations[:j.applied], op)
+	if len(j.operations) > maxOperations {
+		j.operations = j.operations[len(j.operations)-maxOperations:]
+	}
+	j.applied = len(j.operations)
+
+	return j.save()
+}
+
+// Drop forgets the most recently recorded operation. It is used when an operation recorded ahead of time could not be
+// applied.
+func (j *Journal) Drop() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.applied == 0 {
+		return nil
+	}
+
+	j.operations = j.operations[:j.applied-1]
+	j.applied = len(j.operations)
+
+	return j.save()
+}
+
+// Undo calls revert with the most recently applied operation and marks it as undone if revert succeeds.
+func (j *Journal) Undo(revert func(Operation) error) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.applied == 0 {
+		return ErrNothingToUndo
+	}
+
+	err := revert(j.operations[j.applied-1])
+	if err != nil {
+		return err
+	}
+
+	j.applied--
+	return j.save()
+}
+
+// Redo calls apply with the most recently undone operation and marks it as applied if apply succeeds.
+func (j *Journal) Redo(apply func(Operation) error) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.applied == len(j.operations) {
+		return ErrNothingToRedo
+	}
+
+	err := apply(j.operations[j.applied])
+	if err != nil {
+		return err
+	}
+
+	j.applied++
+	return j.save()
+}
+
+func (j *Journal) save() error {
+	bs, err := json.Marshal(journalFile{
+		Operations: j.operations,
+		Applied:    j.applied,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(j.path), 0o755)
+	if err != nil {
+		return err
+	}
+
+	tmp := j.path + `.tmp`
+	err = os.WriteFile(tmp, bs, 0o644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, j.path)
+}
@@ -0,0 +1,129 @@
+package history
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/cszczepaniak/go-istage/git"
+	"github.com/cszczepaniak/go-istage/patch"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func patchOp(p string) Operation {
+	return Operation{
+		Kind:      PatchOperation,
+		Direction: patch.Stage,
+		Patch:     p,
+	}
+}
+
+func collect(into *[]string) func(Operation) error {
+	return func(op Operation) error {
+		*into = append(*into, op.Patch)
+		return nil
+	}
+}
+
+func TestUndoAndRedo(t *testing.T) {
+	j, err := Open(filepath.Join(t.TempDir(), `istage`, `history.json`))
+	require.NoError(t, err)
+
+	var calls []string
+	assert.ErrorIs(t, j.Undo(collect(&calls)), ErrNothingToUndo)
+	assert.ErrorIs(t, j.Redo(collect(&calls)), ErrNothingToRedo)
+
+	require.NoError(t, j.Record(patchOp(`a`)))
+	require.NoError(t, j.Record(patchOp(`b`)))
+	require.NoError(t, j.Record(patchOp(`c`)))
+
+	require.NoError(t, j.Undo(collect(&calls)))
+	require.NoError(t, j.Undo(collect(&calls)))
+	assert.Equal(t, []string{`c`, `b`}, calls)
+
+	calls = nil
+	require.NoError(t, j.Redo(collect(&calls)))
+	assert.Equal(t, []string{`b`}, calls)
+
+	// Recording a new operation forgets everything that could have been redone.
+	require.NoError(t, j.Record(patchOp(`d`)))
+	assert.ErrorIs(t, j.Redo(collect(&calls)), ErrNothingToRedo)
+
+	calls = nil
+	for {
+		err := j.Undo(collect(&calls))
+		if errors.Is(err, ErrNothingToUndo) {
+			break
+		}
+		require.NoError(t, err)
+	}
+	assert.Equal(t, []string{`d`, `b`, `a`}, calls)
+}
+
+func TestFailedUndoKeepsOperation(t *testing.T) {
+	j, err := Open(filepath.Join(t.TempDir(), `history.json`))
+	require.NoError(t, err)
+
+	require.NoError(t, j.Record(patchOp(`a`)))
+
+	err = j.Undo(func(Operation) error {
+		return errors.New(`patch does not apply`)
+	})
+	assert.EqualError(t, err, `patch does not apply`)
+
+	var calls []string
+	require.NoError(t, j.Undo(collect(&calls)))
+	assert.Equal(t, []string{`a`}, calls)
+}
+
+func TestDrop(t *testing.T) {
+	j, err := Open(filepath.Join(t.TempDir(), `history.json`))
+	require.NoError(t, err)
+
+	require.NoError(t, j.Record(patchOp(`a`)))
+	require.NoError(t, j.Record(patchOp(`b`)))
+	require.NoError(t, j.Drop())
+
+	var calls []string
+	require.NoError(t, j.Undo(collect(&calls)))
+	assert.ErrorIs(t, j.Undo(collect(&calls)), ErrNothingToUndo)
+	assert.Equal(t, []string{`a`}, calls)
+}
+
+func TestPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), `history.json`)
+
+	j, err := Open(path)
+	require.NoError(t, err)
+
+	require.NoError(t, j.Record(patchOp(`a`)))
+	require.NoError(t, j.Record(Operation{
+		Kind:      FileOperation,
+		Direction: patch.Unstage,
+		File: git.File{
+			Path:   `b.txt`,
+			Status: git.FileStatusDeleted,
+		},
+	}))
+	require.NoError(t, j.Undo(func(Operation) error { return nil }))
+
+	j, err = Open(path)
+	require.NoError(t, err)
+
+	var redone []Operation
+	require.NoError(t, j.Redo(func(op Operation) error {
+		redone = append(redone, op)
+		return nil
+	}))
+	require.Len(t, redone, 1)
+	assert.Equal(t, FileOperation, redone[0].Kind)
+	assert.Equal(t, patch.Unstage, redone[0].Direction)
+	assert.Equal(t, git.File{Path: `b.txt`, Status: git.FileStatusDeleted}, redone[0].File)
+	assert.Equal(t, []git.File{{Path: `b.txt`, Status: git.FileStatusDeleted}}, redone[0].AllFiles())
+
+	var undone []string
+	require.NoError(t, j.Undo(func(Operation) error { return nil }))
+	require.NoError(t, j.Undo(collect(&undone)))
+	assert.Equal(t, []string{`a`}, undone)
+}
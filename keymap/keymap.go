@@ -0,0 +1,275 @@
+package keymap
+
+import (
+	"fmt"
+	"strings"
+)
+
+type Action string
+
+const (
+	Quit           Action = `quit`
+	Up             Action = `up`
+	Down           Action = `down`
+	ToggleSide     Action = `toggle-staged`
+	ToggleView     Action = `toggle-files`
+	ToggleCombined Action = `toggle-combined`
+	Commit         Action = `commit`
+	Undo           Action = `undo`
+	Redo           Action = `redo`
+
+	PrevHunk       Action = `prev-hunk`
+	NextHunk       Action = `next-hunk`
+	ToggleSplit    Action = `toggle-split`
+	SwitchSide     Action = `switch-side`
+	VisualMode     Action = `visual-mode`
+	ToggleMark     Action = `toggle-mark`
+	ClearSelection Action = `clear-selection`
+	FoldHunk       Action = `fold-hunk`
+	FoldFile       Action = `fold-file`
+	ToggleFullFile Action = `toggle-full-file`
+
+	MoreContext      Action = `more-context`
+	LessContext      Action = `less-context`
+	MoreInterhunk    Action = `more-interhunk`
+	LessInterhunk    Action = `less-interhunk`
+	IgnoreWhitespace Action = `ignore-whitespace`
+
+	StageLine   Action = `stage-line`
+	StageHunk   Action = `stage-hunk`
+	ResetLine   Action = `reset-line`
+	ResetHunk   Action = `reset-hunk`
+	UnstageLine Action = `unstage-line`
+	UnstageHunk Action = `unstage-hunk`
+
+	StageFile   Action = `stage-file`
+	UnstageFile Action = `unstage-file`
+	ToggleDir   Action = `toggle-dir`
+
+	ConfirmCommit Action = `confirm-commit`
+
+	SearchForward  Action = `search-forward`
+	SearchBackward Action = `search-backward`
+	NextMatch      Action = `next-match`
+	PrevMatch      Action = `prev-match`
+
+	FilterFiles Action = `filter-files`
+
+	Help          Action = `help`
+	Dismiss       Action = `dismiss`
+	CancelCommand Action = `cancel-command`
+)
+
+// Context is a screen of the UI. Two actions may only share a key if they are never available on the same screen.
+type Context int
+
+const (
+	UnstagedLines Context = iota
+	StagedLines
+	UnstagedFiles
+	StagedFiles
+	Committing
+	Error
+	Filtering
+	Combined
+
+	// combinedUnstaged and combinedStaged are the panes of the combined view. Each only gets the actions of its own
+	// side, so keys are checked for each of them rather than for the combined view as a whole.
+	combinedUnstaged
+	combinedStaged
+)
+
+var contextNames = map[Context]string{
+	UnstagedLines: `unstaged lines`,
+	StagedLines:   `staged lines`,
+	UnstagedFiles: `unstaged files`,
+	StagedFiles:   `staged files`,
+	Committing:    `commit`,
+	Error:         `error`,
+	Filtering:     `file filter`,
+	Combined:      `combined`,
+
+	combinedUnstaged: `unstaged side of the combined`,
+	combinedStaged:   `staged side of the combined`,
+}
+
+func (c Context) String() string {
+	return contextNames[c]
+}
+
+var (
+	allContexts = []Context{
+		UnstagedLines, StagedLines, UnstagedFiles, StagedFiles, Committing, Error, Filtering, combinedUnstaged,
+		combinedStaged,
+	}
+	browsing = []Context{
+		UnstagedLines, StagedLines, UnstagedFiles, StagedFiles, combinedUnstaged, combinedStaged,
+	}
+	lines         = []Context{UnstagedLines, StagedLines, combinedUnstaged, combinedStaged}
+	unstagedLines = []Context{UnstagedLines, combinedUnstaged}
+	stagedLines   = []Context{StagedLines, combinedStaged}
+	files         = []Context{UnstagedFiles, StagedFiles}
+	anyButCommit  = []Context{
+		UnstagedLines, StagedLines, UnstagedFiles, StagedFiles, Error, combinedUnstaged, combinedStaged,
+	}
+)
+
+type binding struct {
+	action      Action
+	defaultKey  string
+	description string
+	contexts    []Context
+}
+
+// bindings lists every action in the order they should be presented to the user.
+var bindings = []binding{
+	{action: Up, defaultKey: `up`, description: `move up`, contexts: browsing},
+	{action: Down, defaultKey: `down`, description: `move down`, contexts: browsing},
+	{action: PrevHunk, defaultKey: `left`, description: `previous hunk`, contexts: lines},
+	{action: NextHunk, defaultKey: `right`, description: `next hunk`, contexts: lines},
+
+	{action: StageLine, defaultKey: `s`, description: `stage line or selection`, contexts: unstagedLines},
+	{action: StageHunk, defaultKey: `S`, description: `stage hunk`, contexts: unstagedLines},
+	{action: ResetLine, defaultKey: `r`, description: `discard line or selection`, contexts: unstagedLines},
+	{action: ResetHunk, defaultKey: `R`, description: `discard hunk`, contexts: unstagedLines},
+	{action: UnstageLine, defaultKey: `u`, description: `unstage line or selection`, contexts: stagedLines},
+	{action: UnstageHunk, defaultKey: `U`, description: `unstage hunk`, contexts: stagedLines},
+	{action: StageFile, defaultKey: `s`, description: `stage file or directory`, contexts: []Context{UnstagedFiles}},
+	{action: UnstageFile, defaultKey: `u`, description: `unstage file or directory`, contexts: []Context{StagedFiles}},
+	{action: ToggleDir, defaultKey: `enter`, description: `collapse or expand directory`, contexts: files},
+
+	{action: VisualMode, defaultKey: `v`, description: `start or end a range selection`, contexts: lines},
+	{action: ToggleMark, defaultKey: ` `, description: `add or remove line from selection`, contexts: lines},
+	{action: ClearSelection, defaultKey: `esc`, description: `clear selection`, contexts: lines},
+	{action: ToggleSplit, defaultKey: `|`, description: `toggle side-by-side layout`, contexts: lines},
+	{action: SwitchSide, defaultKey: `tab`, description: `switch side in side-by-side layout`, contexts: lines},
+	{action: FoldHunk, defaultKey: `z`, description: `fold or unfold hunk`, contexts: lines},
+	{action: FoldFile, defaultKey: `Z`, description: `fold or unfold file`, contexts: lines},
+	{action: ToggleFullFile, defaultKey: `F`, description: `show whole files or only the changes`, contexts: lines},
+	{action: MoreContext, defaultKey: `]`, description: `show more context around changes`, contexts: lines},
+	{action: LessContext, defaultKey: `[`, description: `show less context around changes`, contexts: lines},
+	{action: MoreInterhunk, defaultKey: `}`, description: `merge hunks further apart`, contexts: lines},
+	{action: LessInterhunk, defaultKey: `{`, description: `merge only closer hunks`, contexts: lines},
+	{action: IgnoreWhitespace, defaultKey: `w`, description: `ignore more or less whitespace`, contexts: lines},
+
+	{action: SearchForward, defaultKey: `/`, description: `search down`, contexts: browsing},
+	{action: SearchBackward, defaultKey: `ctrl+r`, description: `search up`, contexts: browsing},
+	{action: NextMatch, defaultKey: `n`, description: `next match`, contexts: browsing},
+	{action: PrevMatch, defaultKey: `N`, description: `previous match`, contexts: browsing},
+	{action: FilterFiles, defaultKey: `ctrl+p`, description: `limit the diff to some files`, contexts: lines},
+
+	{action: ToggleSide, defaultKey: `t`, description: `switch between staged and unstaged`, contexts: browsing},
+	{action: ToggleView, defaultKey: `f`, description: `switch between lines and files`, contexts: browsing},
+	{action: ToggleCombined, defaultKey: `b`, description: `show staged and unstaged together`, contexts: browsing},
+	{action: Undo, defaultKey: `ctrl+z`, description: `undo`, contexts: browsing},
+	{action: Redo, defaultKey: `ctrl+y`, description: `redo`, contexts: browsing},
+	{action: Commit, defaultKey: `c`, description: `commit staged changes`, contexts: browsing},
+	{action: ConfirmCommit, defaultKey: `ctrl+s`, description: `commit`, contexts: []Context{Committing}},
+	{action: Dismiss, defaultKey: `esc`, description: `go back`, contexts: []Context{Error}},
+	{action: CancelCommand, defaultKey: `ctrl+g`, description: `stop the git command that is running`, contexts: allContexts},
+	{action: Help, defaultKey: `?`, description: `show or hide help`, contexts: anyButCommit},
+	{action: Quit, defaultKey: `q`, description: `quit`, contexts: anyButCommit},
+}
+
+// Keymap maps every action to the key that triggers it, spelled the way bubbletea spells keys (`a`, `A`, `ctrl+a`,
+// `up`, `tab`, ...).
+type Keymap map[Action]string
+
+func Default() Keymap {
+	k := make(Keymap, len(bindings))
+	for _, b := range bindings {
+		k[b.action] = b.defaultKey
+	}
+	return k
+}
+
+// Set binds an action to a key. `space` can be used for the space bar, which bubbletea reports as a literal space.
+func (k Keymap) Set(action, key string) error {
+	a := Action(strings.ToLower(action))
+	if !isKnown(a) {
+		return fmt.Errorf(`unknown action %q`, action)
+	}
+
+	key = strings.TrimSpace(key)
+	switch key {
+	case ``:
+		return fmt.Errorf(`no key given for %q`, action)
+	case `space`:
+		key = ` `
+	}
+
+	k[a] = key
+	return nil
+}
+
+// Validate makes sure that no two actions available on the same screen share a key.
+func (k Keymap) Validate() error {
+	for _, ctx := range allContexts {
+		bound := map[string]Action{}
+		for _, b := range bindings {
+			if !b.availableIn(ctx) {
+				continue
+			}
+
+			key := k[b.action]
+			if other, ok := bound[key]; ok {
+				return fmt.Errorf(`%s and %s are both bound to %q in the %s view`, other, b.action, DisplayKey(key), ctx)
+			}
+			bound[key] = b.action
+		}
+	}
+	return nil
+}
+
+func isKnown(a Action) bool {
+	for _, b := range bindings {
+		if b.action == a {
+			return true
+		}
+	}
+	return false
+}
+
+// availableIn returns whether the action is available in the context. The combined view has the actions of both of
+// its panes.
+func (b binding) availableIn(ctx Context) bool {
+	if ctx == Combined {
+		return b.availableIn(combinedUnstaged) || b.availableIn(combinedStaged)
+	}
+	for _, c := range b.contexts {
+		if c == ctx {
+			return true
+		}
+	}
+	return false
+}
+
+// Binding is an action as it is shown to the user.
+type Binding struct {
+	Action      Action
+	Key         string
+	Description string
+}
+
+// Bindings returns the actions available in the given context, with the keys they are bound to.
+func (k Keymap) Bindings(ctx Context) []Binding {
+	var res []Binding
+	for _, b := range bindings {
+		if b.availableIn(ctx) {
+			res = append(res, Binding{
+				Action:      b.action,
+				Key:         k[b.action],
+				Description: b.description,
+			})
+		}
+	}
+	return res
+}
+
+// DisplayKey returns the name of a key as it should be shown to the user.
+func DisplayKey(key string) string {
+	if key == ` ` {
+		return `space`
+	}
+	return key
+}
@@ -0,0 +1,124 @@
+package keymap
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/cszczepaniak/go-istage/nolibgit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultsAreValid(t *testing.T) {
+	assert.NoError(t, Default().Validate())
+}
+
+func TestSearchBackwardCanTakeHelpKey(t *testing.T) {
+	k := Default()
+	require.NoError(t, k.Set(`search-backward`, `?`))
+	assert.EqualError(t, k.Validate(), `search-backward and help are both bound to "?" in the unstaged lines view`)
+
+	require.NoError(t, k.Set(`help`, `f1`))
+	assert.NoError(t, k.Validate())
+}
+
+func TestSet(t *testing.T) {
+	k := Default()
+
+	require.NoError(t, k.Set(`Stage-Line`, `a`))
+	assert.Equal(t, `a`, k[StageLine])
+
+	require.NoError(t, k.Set(`toggle-mark`, `space`))
+	assert.Equal(t, ` `, k[ToggleMark])
+
+	assert.EqualError(t, k.Set(`stage-everything`, `a`), `unknown action "stage-everything"`)
+	assert.EqualError(t, k.Set(`stage-line`, ``), `no key given for "stage-line"`)
+}
+
+func TestValidate(t *testing.T) {
+	k := Default()
+
+	// The same key can be used on different screens...
+	require.NoError(t, k.Set(`unstage-line`, `x`))
+	require.NoError(t, k.Set(`stage-file`, `x`))
+	assert.NoError(t, k.Validate())
+
+	// Each side of the combined view only gets its own actions, like the views of a single side.
+	require.NoError(t, k.Set(`stage-line`, `x`))
+	require.NoError(t, k.Set(`stage-hunk`, `X`))
+	require.NoError(t, k.Set(`unstage-hunk`, `X`))
+	assert.NoError(t, k.Validate())
+
+	// ...but not twice on the same one.
+	require.NoError(t, k.Set(`down`, `j`))
+	require.NoError(t, k.Set(`up`, `j`))
+	assert.EqualError(t, k.Validate(), `up and down are both bound to "j" in the unstaged lines view`)
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	out, err := exec.Command(`git`, `init`, dir).CombinedOutput()
+	require.NoError(t, err, "failed to init git repo:\n %s\n", out)
+
+	env := nolibgit.Environment{
+		RepoDir:       filepath.Join(dir, `.git`),
+		WorkingDir:    dir,
+		GitExecutable: `git`,
+	}
+
+	configDir := t.TempDir()
+	t.Setenv(`XDG_CONFIG_HOME`, configDir)
+	t.Setenv(`HOME`, t.TempDir())
+
+	require.NoError(t, os.MkdirAll(filepath.Join(configDir, `go-istage`), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(configDir, `go-istage`, `config`), []byte(`[keys]
+	up = k
+	down = j
+	toggle-mark = space
+`), 0o644))
+
+	k, err := Load(env)
+	require.NoError(t, err)
+	assert.Equal(t, `k`, k[Up])
+	assert.Equal(t, `j`, k[Down])
+	assert.Equal(t, ` `, k[ToggleMark])
+	assert.Equal(t, `s`, k[StageLine])
+
+	// The repository configuration wins over the user's.
+	out, err = exec.Command(`git`, `-C`, dir, `config`, `istage.keys.up`, `i`).CombinedOutput()
+	require.NoError(t, err, "failed to set config:\n %s\n", out)
+
+	k, err = Load(env)
+	require.NoError(t, err)
+	assert.Equal(t, `i`, k[Up])
+
+	out, err = exec.Command(`git`, `-C`, dir, `config`, `istage.keys.stage-hunk`, `s`).CombinedOutput()
+	require.NoError(t, err, "failed to set config:\n %s\n", out)
+
+	_, err = Load(env)
+	assert.EqualError(t, err, `stage-line and stage-hunk are both bound to "s" in the unstaged lines view`)
+}
+
+func TestBindings(t *testing.T) {
+	k := Default()
+	require.NoError(t, k.Set(`dismiss`, `x`))
+
+	assert.Equal(t, []Binding{
+		{Action: Dismiss, Key: `x`, Description: `go back`},
+		{Action: CancelCommand, Key: `ctrl+g`, Description: `stop the git command that is running`},
+		{Action: Help, Key: `?`, Description: `show or hide help`},
+		{Action: Quit, Key: `q`, Description: `quit`},
+	}, k.Bindings(Error))
+
+	for _, b := range k.Bindings(StagedFiles) {
+		assert.NotEqual(t, StageFile, b.Action)
+	}
+
+	var combined []Action
+	for _, b := range k.Bindings(Combined) {
+		combined = append(combined, b.Action)
+	}
+	assert.Subset(t, combined, []Action{StageLine, UnstageLine, ToggleSide})
+}
@@ -0,0 +1,84 @@
+package keymap
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/cszczepaniak/go-istage/nolibgit"
+)
+
+// Load reads the key bindings from the configuration, on top of the defaults. Bindings use git config syntax and are
+// read, in increasing order of precedence, from:
+//   - the `keys` section of `$XDG_CONFIG_HOME/go-istage/config`
+//   - `istage.keys.<action>` in git config, which includes the global and the repository configuration
+func Load(env nolibgit.Environment) (Keymap, error) {
+	k := Default()
+
+	if dir, err := os.UserConfigDir(); err == nil {
+		path := filepath.Join(dir, `go-istage`, `config`)
+		if _, err := os.Stat(path); err == nil {
+			out, err := gitConfig(env, `--file`, path, `--get-regexp`, `^keys\.`)
+			if err != nil {
+				return nil, fmt.Errorf(`reading %s: %w`, path, err)
+			}
+			if err := k.apply(out, `keys.`); err != nil {
+				return nil, fmt.Errorf(`%s: %w`, path, err)
+			}
+		}
+	}
+
+	out, err := gitConfig(env, `--get-regexp`, `^istage\.keys\.`)
+	if err != nil {
+		return nil, fmt.Errorf(`reading git config: %w`, err)
+	}
+	if err := k.apply(out, `istage.keys.`); err != nil {
+		return nil, fmt.Errorf(`git config: %w`, err)
+	}
+
+	if err := k.Validate(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// apply sets the bindings in the output of `git config --get-regexp`, which has one `<name> <value>` pair per line.
+func (k Keymap) apply(out, prefix string) error {
+	for _, line := range strings.Split(out, "\n") {
+		if line == `` {
+			continue
+		}
+
+		name, value, _ := strings.Cut(line, ` `)
+		if err := k.Set(strings.TrimPrefix(name, prefix), value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func gitConfig(env nolibgit.Environment, args ...string) (string, error) {
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+
+	cmd := exec.Command(env.GitExecutable, append([]string{`config`}, args...)...)
+	cmd.Dir = env.WorkingDir
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	err := cmd.Run()
+
+	// git config exits with 1 when nothing matches.
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		return ``, nil
+	}
+	if err != nil {
+		return ``, fmt.Errorf(`%w: %s`, err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
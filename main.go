@@ -2,13 +2,20 @@ package main
 
 import (
 	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 
 	"github.com/cszczepaniak/go-istage/git"
+	"github.com/cszczepaniak/go-istage/history"
+	"github.com/cszczepaniak/go-istage/keymap"
 	"github.com/cszczepaniak/go-istage/logging"
 	"github.com/cszczepaniak/go-istage/nolibgit"
+	"github.com/cszczepaniak/go-istage/recovery"
 	"github.com/cszczepaniak/go-istage/services"
+	"github.com/cszczepaniak/go-istage/settings"
 	"github.com/cszczepaniak/go-istage/ui"
 )
 
@@ -19,7 +26,7 @@ func (l *lines) UnmarshalText(bs []byte) error {
 
 	ls := make(lines, 0, len(numStrs))
 	for _, s := range numStrs {
-		n, err := strconv.Atoi(s)
+		n, err := strconv.Atoi(strings.TrimSpace(s))
 		if err != nil {
 			return err
 		}
@@ -44,12 +51,18 @@ func (l *lines) MarshalText() ([]byte, error) {
 	return []byte(res.String()), nil
 }
 
-func main() {
-	linesArg := make(lines, 0)
+var backendName = flag.String(`backend`, git.Backends()[0], `how to read the repository: `+strings.Join(git.Backends(), ` or `))
+var applyInProcess = flag.Bool(`apply-in-process`, false, `apply patches with libgit2 instead of running git apply (libgit2 backend only)`)
 
-	flag.TextVar(&linesArg, `lines`, &lines{}, ``)
+var timeouts = git.DefaultTimeouts()
 
-	flag.Parse()
+func main() {
+	flag.Var(timeouts, `timeout`, "how long git commands may run: a `duration` for every command, or name=duration for\n"+
+		"one, like apply=30s (0 for none, can be repeated)")
+	flag.Usage = usage
+	args, pathspec := splitPathspec(os.Args[1:])
+	// The flag set exits on errors.
+	_ = flag.CommandLine.Parse(args)
 
 	err := logging.Init(logging.Config{
 		OutputPath: `log/debug.log`,
@@ -60,23 +73,122 @@ func main() {
 
 	gitEnv, err := nolibgit.LoadEnvironment()
 	if err != nil {
-		logging.Error(`failed to initialize git env`, `err`, err)
+		fatal(`failed to initialize git env`, err)
+	}
+
+	gs, err := git.NewBackend(*backendName, gitEnv, git.Options{
+		ApplyInProcess: *applyInProcess,
+		Timeouts:       timeouts,
+	})
+	if err != nil {
+		fatal(`failed to initialize git service`, err)
+	}
+
+	if len(pathspec) > 0 {
+		pathspec, err = rootRelative(gitEnv.WorkingDir, pathspec)
+		if err != nil {
+			fatal(`invalid path`, err)
+		}
+		gs.LimitToPaths(pathspec)
+	}
+
+	prefs, err := settings.Open(filepath.Join(gitEnv.RepoDir, `istage`, `settings.json`))
+	if err != nil {
+		fatal(`failed to load settings`, err)
 	}
 
-	gs, err := git.NewClient(gitEnv)
+	ds, err := services.NewDocumentService(gs, prefs)
 	if err != nil {
-		logging.Error(`failed to initialize git service`, `err`, err)
+		fatal(`failed to initialize document service`, err)
 	}
 
-	ds, err := services.NewDocumentService(gs)
+	journal, err := history.Open(filepath.Join(gitEnv.RepoDir, `istage`, `history.json`))
 	if err != nil {
-		logging.Error(`failed to initialize document service`, `err`, err)
+		fatal(`failed to load history`, err)
+	}
+
+	backups := recovery.NewStore(filepath.Join(gitEnv.RepoDir, `istage`, `backups`), gs)
+
+	ps := services.NewPatchingService(gs, journal, backups, ds)
+
+	if flag.NArg() > 0 {
+		os.Exit(runCommand(flag.Args(), ps, ds, gs, backups))
 	}
 
-	ps := services.NewPatchingService(gs)
+	keys, err := keymap.Load(gitEnv)
+	if err != nil {
+		fatal(`failed to load key bindings`, err)
+	}
 
-	err = ui.RunUI(ps, ds, gs, gs)
+	err = ui.RunUI(ps, ds, ps, gs, keys)
 	if err != nil {
 		logging.Error(`error during UI runtime`, `err`, err)
 	}
 }
+
+// splitPathspec separates the pathspecs after `--` from the rest of the arguments.
+func splitPathspec(args []string) ([]string, []string) {
+	for i, a := range args {
+		if a == `--` {
+			return args[:i], args[i+1:]
+		}
+	}
+	return args, nil
+}
+
+// rootRelative turns pathspecs relative to the current directory into pathspecs relative to the root of the working
+// tree. A pathspec for the whole working tree means there is nothing to limit, so it results in no pathspecs at all.
+func rootRelative(root string, pathspec []string) ([]string, error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]string, 0, len(pathspec))
+	for _, p := range pathspec {
+		abs := p
+		if !filepath.IsAbs(p) {
+			abs = filepath.Join(wd, p)
+		}
+
+		rel, err := filepath.Rel(root, abs)
+		if err != nil {
+			return nil, err
+		}
+		if rel == `.` {
+			return nil, nil
+		}
+		if rel == `..` || strings.HasPrefix(rel, `..`+string(filepath.Separator)) {
+			return nil, fmt.Errorf(`%s is outside of the repository`, p)
+		}
+
+		res = append(res, filepath.ToSlash(rel))
+	}
+	return res, nil
+}
+
+func fatal(msg string, err error) {
+	logging.Error(msg, `err`, err)
+	fmt.Fprintf(os.Stderr, "%s: %s\n", msg, err)
+	os.Exit(exitFailure)
+}
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), `Usage:
+  go-istage                            start the interactive UI
+  go-istage stage --lines 12,13,40     stage the given lines of the unstaged changes
+  go-istage unstage --lines 12,13,40   unstage the given lines of the staged changes
+  go-istage reset --lines 12,13,40     discard the given lines of the unstaged changes
+  go-istage dump [--staged] [--pretty] print the unstaged (or staged) changes as JSON
+  go-istage undo                       undo the last stage, unstage or reset
+  go-istage redo                       redo the last undone operation
+  go-istage backups                    list the changes discarded by resets, most recent first
+  go-istage restore [--print] <n>      put the changes of backup n back into the working tree
+  go-istage serve                      serve JSON-RPC requests over stdin and stdout
+
+Any of these can be followed by -- <pathspec>... to only look at the matching paths.
+
+Options:
+`)
+	flag.PrintDefaults()
+}
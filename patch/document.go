@@ -27,3 +27,70 @@ func (d Document) FindEntryIndex(lineIndex int) int {
 	}
 	return -1
 }
+
+// Filter returns a document with only the entries that keep returns true for. Line indices are renumbered, so lines of
+// the filtered document must be patched with the filtered document.
+func (d Document) Filter(keep func(Entry) bool) Document {
+	res := Document{
+		Height: d.Height,
+		Width:  d.Width,
+	}
+
+	for _, e := range d.Entries {
+		if !keep(e) {
+			continue
+		}
+
+		shift := len(res.Lines) - e.Offset
+		res.Lines = append(res.Lines, d.Lines[e.LineStart():e.LineEnd()]...)
+
+		hunks := make([]Hunk, 0, len(e.Hunks))
+		for _, h := range e.Hunks {
+			h.Offset += shift
+			hunks = append(hunks, h)
+		}
+		e.Offset += shift
+		e.Hunks = hunks
+
+		res.Entries = append(res.Entries, e)
+	}
+
+	return res
+}
+
+// LineNumbers returns the numbers the line at index has in the old and the new version of its file. A line that is
+// only in one of them has 0 for the other, and lines outside of hunks have 0 for both.
+func (d Document) LineNumbers(index int) (int, int) {
+	e, ok := d.FindEntry(index)
+	if !ok {
+		return 0, 0
+	}
+	h, ok := e.FindHunk(index)
+	if !ok || index == h.LineStart() {
+		return 0, 0
+	}
+
+	// The numbers in the hunk header are those of the first line after it.
+	oldNum, newNum := h.OldStart, h.NewStart
+	for i := h.LineStart() + 1; i < index; i++ {
+		switch d.Lines[i].Kind {
+		case ContextLine:
+			oldNum++
+			newNum++
+		case RemovalLine:
+			oldNum++
+		case AdditionLine:
+			newNum++
+		}
+	}
+
+	switch d.Lines[index].Kind {
+	case ContextLine:
+		return oldNum, newNum
+	case RemovalLine:
+		return oldNum, 0
+	case AdditionLine:
+		return 0, newNum
+	}
+	return 0, 0
+}
@@ -0,0 +1,70 @@
+package patch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilter(t *testing.T) {
+	a := `diff --git a/a.txt b/a.txt
+index 8baef1b..0c00383 100644
+--- a/a.txt
++++ b/a.txt
+@@ -1,2 +1,2 @@
+ a
+-b
++B
+`
+	b := `diff --git a/b.txt b/b.txt
+index 8baef1b..0c00383 100644
+--- a/b.txt
++++ b/b.txt
+@@ -1,2 +1,2 @@
+ x
+-y
++Y
+@@ -10,2 +10,2 @@
+ j
+-k
++K
+`
+	doc := ParseDocument([]string{a, b})
+
+	filtered := doc.Filter(func(e Entry) bool {
+		return e.Changes.Path == `b.txt`
+	})
+
+	// The filtered document is the same as if only b.txt had changed, so its line indices can be patched directly.
+	assert.Equal(t, ParseDocument([]string{b}), filtered)
+
+	p, err := Compute(filtered, []int{10, 11}, Stage)
+	require.NoError(t, err)
+	assert.Equal(t, `--- a/b.txt
++++ b/b.txt
+@@ -10,2 +10,2 @@
+ j
+-k
++K
+`, p)
+}
+
+func TestLineNumbers(t *testing.T) {
+	doc := ParseDocument([]string{`diff --git a/a.txt b/a.txt
+index 8baef1b..0c00383 100644
+--- a/a.txt
++++ b/a.txt
+@@ -10,4 +20,4 @@
+ j
+-k
++K
++L
+ m
+`})
+
+	for i, exp := range [][2]int{{0, 0}, {0, 0}, {0, 0}, {0, 0}, {0, 0}, {10, 20}, {11, 0}, {0, 21}, {0, 22}, {12, 23}} {
+		oldNum, newNum := doc.LineNumbers(i)
+		assert.Equal(t, exp, [2]int{oldNum, newNum}, `line %d`, i)
+	}
+}
@@ -0,0 +1,186 @@
+package patch
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxIntralineCells bounds the size of the table used to diff a pair of lines, so very long lines are left alone.
+const maxIntralineCells = 250_000
+
+// Span is a range of bytes in the text of a line.
+type Span struct {
+	Start int
+	End   int
+}
+
+// IntralineChanges pairs up each run of removals in a hunk with the run of additions directly after it and diffs the
+// paired lines word by word. The result maps line indices to the spans of their text that differ from the line they
+// were paired with. Lines that have nothing in common with their counterpart are left out, since highlighting all of
+// their text wouldn't tell the reader anything.
+func (d Document) IntralineChanges() map[int][]Span {
+	res := map[int][]Span{}
+
+	for _, e := range d.Entries {
+		for _, h := range e.Hunks {
+			i := h.LineStart()
+			for i < h.LineEnd() {
+				removals := d.linesOfKind(i, h.LineEnd(), RemovalLine)
+				if len(removals) == 0 {
+					i++
+					continue
+				}
+
+				next := removals[len(removals)-1] + 1
+				additions := d.linesOfKind(next, h.LineEnd(), AdditionLine)
+
+				for j := 0; j < len(removals) && j < len(additions); j++ {
+					oldSpans, newSpans, ok := diffWords(d.Lines[removals[j]].Text, d.Lines[additions[j]].Text)
+					if !ok {
+						continue
+					}
+					res[removals[j]] = oldSpans
+					res[additions[j]] = newSpans
+				}
+
+				if len(additions) > 0 {
+					next = additions[len(additions)-1] + 1
+				}
+				i = next
+			}
+		}
+	}
+
+	return res
+}
+
+// linesOfKind returns the indices of the run of lines of the given kind starting at start. "No newline at end of file"
+// markers don't interrupt a run.
+func (d Document) linesOfKind(start, end int, kind LineKind) []int {
+	var res []int
+	for i := start; i < end; i++ {
+		switch d.Lines[i].Kind {
+		case kind:
+			res = append(res, i)
+		case NoEndOfLineLine:
+		default:
+			return res
+		}
+	}
+	return res
+}
+
+type token struct {
+	text  string
+	start int
+}
+
+// tokenize splits the text of a line (after its +/- prefix) into words, runs of whitespace and single punctuation
+// characters.
+func tokenize(text string) []token {
+	var res []token
+
+	class := func(r rune) int {
+		switch {
+		case r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r):
+			return 1
+		case unicode.IsSpace(r):
+			return 2
+		}
+		return 0
+	}
+
+	i := 1
+	for i < len(text) {
+		r, sz := utf8.DecodeRuneInString(text[i:])
+		c := class(r)
+		j := i + sz
+		for c != 0 && j < len(text) {
+			next, nsz := utf8.DecodeRuneInString(text[j:])
+			if class(next) != c {
+				break
+			}
+			j += nsz
+		}
+		res = append(res, token{text: text[i:j], start: i})
+		i = j
+	}
+
+	return res
+}
+
+func diffWords(oldText, newText string) ([]Span, []Span, bool) {
+	oldToks := tokenize(oldText)
+	newToks := tokenize(newText)
+	if len(oldToks) == 0 || len(newToks) == 0 || len(oldToks)*len(newToks) > maxIntralineCells {
+		return nil, nil, false
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of oldToks[i:] and newToks[j:].
+	lcs := make([][]int, len(oldToks)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(newToks)+1)
+	}
+	for i := len(oldToks) - 1; i >= 0; i-- {
+		for j := len(newToks) - 1; j >= 0; j-- {
+			if oldToks[i].text == newToks[j].text {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = lcs[i+1][j]
+				if lcs[i][j+1] > lcs[i][j] {
+					lcs[i][j] = lcs[i][j+1]
+				}
+			}
+		}
+	}
+
+	oldChanged := make([]bool, len(oldToks))
+	newChanged := make([]bool, len(newToks))
+	inCommon := false
+	i, j := 0, 0
+	for i < len(oldToks) && j < len(newToks) {
+		switch {
+		case oldToks[i].text == newToks[j].text:
+			if strings.TrimSpace(oldToks[i].text) != `` {
+				inCommon = true
+			}
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			oldChanged[i] = true
+			i++
+		default:
+			newChanged[j] = true
+			j++
+		}
+	}
+	for ; i < len(oldToks); i++ {
+		oldChanged[i] = true
+	}
+	for ; j < len(newToks); j++ {
+		newChanged[j] = true
+	}
+
+	if !inCommon {
+		return nil, nil, false
+	}
+
+	return toSpans(oldToks, oldChanged), toSpans(newToks, newChanged), true
+}
+
+func toSpans(toks []token, changed []bool) []Span {
+	var res []Span
+	for i, t := range toks {
+		if !changed[i] {
+			continue
+		}
+		end := t.start + len(t.text)
+		if len(res) > 0 && res[len(res)-1].End == t.start {
+			res[len(res)-1].End = end
+		} else {
+			res = append(res, Span{Start: t.start, End: end})
+		}
+	}
+	return res
+}
@@ -0,0 +1,55 @@
+package patch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIntralineChanges(t *testing.T) {
+	doc := ParseDocument([]string{
+		`diff --git a/a.go b/a.go
+index 8baef1b..0c00383 100644
+--- a/a.go
++++ b/a.go
+@@ -1,7 +1,7 @@
+ package a
+-func foo(a int) {
+-	return a + 1
++func fooBar(a int) {
++	return a + 2
++}
+ 
+-something else entirely
++nothing in common
+-x := 1
+\ No newline at end of file
++x := 2
+\ No newline at end of file
+`})
+
+	assert.Equal(t, map[int][]Span{
+		// foo -> fooBar
+		6: {{Start: 6, End: 9}},
+		8: {{Start: 6, End: 12}},
+		// 1 -> 2
+		7: {{Start: 13, End: 14}},
+		9: {{Start: 13, End: 14}},
+		// x := 1 -> x := 2
+		14: {{Start: 6, End: 7}},
+		16: {{Start: 6, End: 7}},
+	}, doc.IntralineChanges())
+}
+
+func TestTokenize(t *testing.T) {
+	assert.Equal(t, []token{
+		{text: `foo_bar1`, start: 1},
+		{text: `  `, start: 9},
+		{text: `(`, start: 11},
+		{text: `(`, start: 12},
+		{text: `héllo`, start: 13},
+		{text: `)`, start: 19},
+	}, tokenize(`+foo_bar1  ((héllo)`))
+
+	assert.Empty(t, tokenize(`+`))
+}
@@ -0,0 +1,190 @@
+package patch
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+func (lk LineKind) MarshalText() ([]byte, error) {
+	return []byte(lk.String()), nil
+}
+
+func (lk *LineKind) UnmarshalText(bs []byte) error {
+	for k := DiffLine; k <= NoEndOfLineLine; k++ {
+		if k.String() == string(bs) {
+			*lk = k
+			return nil
+		}
+	}
+	return fmt.Errorf(`unknown line kind %q`, bs)
+}
+
+func (d Direction) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d *Direction) UnmarshalText(bs []byte) error {
+	for dir := Stage; dir <= Reset; dir++ {
+		if dir.String() == string(bs) {
+			*d = dir
+			return nil
+		}
+	}
+	return fmt.Errorf(`unknown direction %q`, bs)
+}
+
+type jsonDocument struct {
+	Entries []jsonEntry `json:"entries"`
+}
+
+type jsonEntry struct {
+	Offset  int         `json:"offset"`
+	Length  int         `json:"length"`
+	Changes jsonChanges `json:"changes"`
+	Header  []jsonLine  `json:"header"`
+	Hunks   []jsonHunk  `json:"hunks"`
+}
+
+type jsonChanges struct {
+	Path    string `json:"path"`
+	OldPath string `json:"oldPath"`
+	Mode    string `json:"mode"`
+	OldMode string `json:"oldMode"`
+}
+
+type jsonHunk struct {
+	Offset    int        `json:"offset"`
+	Length    int        `json:"length"`
+	OldStart  int        `json:"oldStart"`
+	OldLength int        `json:"oldLength"`
+	NewStart  int        `json:"newStart"`
+	NewLength int        `json:"newLength"`
+	Lines     []jsonLine `json:"lines"`
+}
+
+type jsonLine struct {
+	Index     int      `json:"index"`
+	Kind      LineKind `json:"kind"`
+	Text      string   `json:"text"`
+	LineBreak string   `json:"lineBreak"`
+}
+
+// MarshalJSON encodes the document as a list of entries. The lines of each entry are split between its header and its
+// hunks, and every line carries its absolute index in the document so it can be used to request a patch later.
+func (d Document) MarshalJSON() ([]byte, error) {
+	jd := jsonDocument{
+		Entries: make([]jsonEntry, 0, len(d.Entries)),
+	}
+
+	for _, e := range d.Entries {
+		headerEnd := e.LineEnd()
+		if len(e.Hunks) > 0 {
+			headerEnd = e.Hunks[0].LineStart()
+		}
+
+		je := jsonEntry{
+			Offset: e.Offset,
+			Length: e.Length,
+			Changes: jsonChanges{
+				Path:    e.Changes.Path,
+				OldPath: e.Changes.OldPath,
+				Mode:    e.Changes.Mode,
+				OldMode: e.Changes.OldMode,
+			},
+			Header: d.jsonLines(e.LineStart(), headerEnd),
+			Hunks:  make([]jsonHunk, 0, len(e.Hunks)),
+		}
+
+		for _, h := range e.Hunks {
+			je.Hunks = append(je.Hunks, jsonHunk{
+				Offset:    h.Offset,
+				Length:    h.Length,
+				OldStart:  h.OldStart,
+				OldLength: h.OldLength,
+				NewStart:  h.NewStart,
+				NewLength: h.NewLength,
+				Lines:     d.jsonLines(h.LineStart(), h.LineEnd()),
+			})
+		}
+
+		jd.Entries = append(jd.Entries, je)
+	}
+
+	return json.Marshal(jd)
+}
+
+func (d Document) jsonLines(start, end int) []jsonLine {
+	res := make([]jsonLine, 0, end-start)
+	for i := start; i < end; i++ {
+		l := d.Lines[i]
+		res = append(res, jsonLine{
+			Index:     i,
+			Kind:      l.Kind,
+			Text:      l.Text,
+			LineBreak: l.LineBreak,
+		})
+	}
+	return res
+}
+
+func (d *Document) UnmarshalJSON(bs []byte) error {
+	var jd jsonDocument
+	err := json.Unmarshal(bs, &jd)
+	if err != nil {
+		return err
+	}
+
+	res := Document{}
+	addLines := func(jls []jsonLine) error {
+		for _, jl := range jls {
+			if jl.Index != len(res.Lines) {
+				return fmt.Errorf(`expected line index %d, got %d`, len(res.Lines), jl.Index)
+			}
+			res.Lines = append(res.Lines, Line{
+				Kind:      jl.Kind,
+				Text:      jl.Text,
+				LineBreak: jl.LineBreak,
+			})
+		}
+		return nil
+	}
+
+	for _, je := range jd.Entries {
+		e := Entry{
+			Offset: je.Offset,
+			Length: je.Length,
+			Changes: Changes{
+				Path:    je.Changes.Path,
+				OldPath: je.Changes.OldPath,
+				Mode:    je.Changes.Mode,
+				OldMode: je.Changes.OldMode,
+			},
+		}
+
+		err := addLines(je.Header)
+		if err != nil {
+			return err
+		}
+
+		for _, jh := range je.Hunks {
+			e.Hunks = append(e.Hunks, Hunk{
+				Offset:    jh.Offset,
+				Length:    jh.Length,
+				OldStart:  jh.OldStart,
+				OldLength: jh.OldLength,
+				NewStart:  jh.NewStart,
+				NewLength: jh.NewLength,
+			})
+
+			err := addLines(jh.Lines)
+			if err != nil {
+				return err
+			}
+		}
+
+		res.Entries = append(res.Entries, e)
+	}
+
+	*d = res
+	return nil
+}
@@ -0,0 +1,84 @@
+package patch
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDocumentJSON(t *testing.T) {
+	doc := ParseDocument([]string{
+		`diff --git a/a.txt b/a.txt
+index 8baef1b..0c00383 100644
+--- a/a.txt
++++ b/a.txt
+@@ -1 +1 @@
+-abc
++def
+`})
+
+	bs, err := json.Marshal(doc)
+	require.NoError(t, err)
+
+	assert.JSONEq(t, `{
+	"entries": [{
+		"offset": 0,
+		"length": 7,
+		"changes": {"path": "a.txt", "oldPath": "a.txt", "mode": "", "oldMode": ""},
+		"header": [
+			{"index": 0, "kind": "DiffLine", "text": "diff --git a/a.txt b/a.txt", "lineBreak": "\n"},
+			{"index": 1, "kind": "HeaderLine", "text": "index 8baef1b..0c00383 100644", "lineBreak": "\n"},
+			{"index": 2, "kind": "HeaderLine", "text": "--- a/a.txt", "lineBreak": "\n"},
+			{"index": 3, "kind": "HeaderLine", "text": "+++ b/a.txt", "lineBreak": "\n"}
+		],
+		"hunks": [{
+			"offset": 4,
+			"length": 3,
+			"oldStart": 1,
+			"oldLength": 1,
+			"newStart": 1,
+			"newLength": 1,
+			"lines": [
+				{"index": 4, "kind": "HunkLine", "text": "@@ -1 +1 @@", "lineBreak": "\n"},
+				{"index": 5, "kind": "RemovalLine", "text": "-abc", "lineBreak": "\n"},
+				{"index": 6, "kind": "AdditionLine", "text": "+def", "lineBreak": "\n"}
+			]
+		}]
+	}]
+}`, string(bs))
+
+	var roundTripped Document
+	err = json.Unmarshal(bs, &roundTripped)
+	require.NoError(t, err)
+	assert.Equal(t, doc, roundTripped)
+}
+
+func TestLineKindText(t *testing.T) {
+	for k := DiffLine; k <= NoEndOfLineLine; k++ {
+		bs, err := k.MarshalText()
+		require.NoError(t, err)
+
+		var res LineKind
+		require.NoError(t, res.UnmarshalText(bs))
+		assert.Equal(t, k, res)
+	}
+
+	var res LineKind
+	assert.Error(t, res.UnmarshalText([]byte(`foo`)))
+}
+
+func TestDirectionText(t *testing.T) {
+	for d := Stage; d <= Reset; d++ {
+		bs, err := d.MarshalText()
+		require.NoError(t, err)
+
+		var res Direction
+		require.NoError(t, res.UnmarshalText(bs))
+		assert.Equal(t, d, res)
+	}
+
+	var res Direction
+	assert.Error(t, res.UnmarshalText([]byte(`foo`)))
+}
@@ -1,5 +1,6 @@
 package patch
 
+//go:generate stringer -type=Direction
 type Direction int
 
 func (d Direction) IsUndo() bool {
@@ -2,6 +2,7 @@ package patch
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 )
 
@@ -31,103 +32,235 @@ func Compute(doc Document, lineIndices []int, dir Direction) (string, error) {
 		entryKeyToEntry[k] = e
 	}
 
-	for e, idxs := range linesByEntry {
+	// The selection may span several entries and hunks; write them out in document order so that each file gets a
+	// single header and its hunks apply top to bottom.
+	entryKeys := make([]entryKey, 0, len(linesByEntry))
+	for k := range linesByEntry {
+		entryKeys = append(entryKeys, k)
+	}
+	sort.Slice(entryKeys, func(i, j int) bool {
+		return entryKeys[i].Offset < entryKeys[j].Offset
+	})
+
+	for _, e := range entryKeys {
+		idxs := linesByEntry[e]
 		ent, ok := entryKeyToEntry[e]
 		if !ok {
 			return ``, fmt.Errorf(`dev error: entry not found for entry key %+v`, e)
 		}
 
 		linesByHunk := map[Hunk][]int{}
+		var hunks []Hunk
 		for _, idx := range idxs {
 			h, ok := ent.FindHunk(idx)
 			if !ok {
 				return ``, fmt.Errorf(`dev error: hunk not found for line index %d`, idx)
 			}
 
+			if _, seen := linesByHunk[h]; !seen {
+				hunks = append(hunks, h)
+			}
 			linesByHunk[h] = append(linesByHunk[h], idx)
 		}
+		sort.Slice(hunks, func(i, j int) bool {
+			return hunks[i].Offset < hunks[j].Offset
+		})
 
-		for hunk, lines := range linesByHunk {
-			lineSet := newSet(lines...)
-
-			oldStart := hunk.OldStart
-			newStart := hunk.NewStart
-
-			oldLength := 0
-			for i := hunk.LineStart(); i < hunk.LineEnd(); i++ {
-				line := doc.Lines[i]
-				kind := line.Kind
+		for hi, hunk := range hunks {
+			lines := hunkLines(doc, hunk, newSet(linesByHunk[hunk]...), dir)
 
-				wasPresent := kind == ContextLine ||
-					kind == RemovalLine && (!dir.IsUndo() || lineSet.contains(i)) ||
-					kind == AdditionLine && (dir.IsUndo() && !lineSet.contains(i))
+			changes := ent.Changes
+			oldPath := changes.OldPath
+			path := changes.Path
+			// Lines that aren't selected become context on the old side when undoing, so even a new file can have old
+			// content in the patch. Only a patch that just adds lines relies on the header to say the file is new.
+			oldExists := oldPath != `` || changes.OldMode != `` || anyInOld(lines)
+			if oldPath == `` {
+				oldPath = path
+			}
 
-				if wasPresent {
-					oldLength++
+			if hi == 0 {
+				if oldExists {
+					fmt.Fprintf(newPatch, "--- a/%s\n", oldPath)
+				} else {
+					fmt.Fprintf(newPatch, "new file mode %s\n", changes.Mode)
+					fmt.Fprintf(newPatch, "--- /dev/null\n")
 				}
+
+				fmt.Fprintf(newPatch, "+++ b/%s\n", path)
 			}
 
-			delta := 0
-			for _, l := range lines {
-				ln := doc.Lines[l]
-				if ln.Kind == AdditionLine {
-					delta += 1
-				} else if ln.Kind == RemovalLine {
-					delta -= 1
+			for _, r := range changeRanges(lines, contextLines) {
+				oldStart := firstLine(hunk.OldStart, hunk.OldLength)
+				newStart := firstLine(hunk.NewStart, hunk.NewLength)
+				for _, l := range lines[:r.start] {
+					if l.inOld() {
+						oldStart++
+					}
+					if l.inNew() {
+						newStart++
+					}
 				}
+
+				writeHunk(newPatch, oldStart, newStart, lines[r.start:r.end])
 			}
+		}
+	}
 
-			newLength := oldLength + delta
+	return newPatch.String(), nil
+}
 
-			changes := ent.Changes
-			oldPath := changes.OldPath
-			oldExists := oldLength != 0 || changes.OldMode != ``
-			path := changes.Path
+// contextLines is how many unchanged lines are kept around the changes of a patch, whatever the context of the
+// document it was computed from. Documents with the whole file as context still result in small patches.
+const contextLines = 3
 
-			if oldExists {
-				fmt.Fprintf(newPatch, "--- a/%s\n", oldPath)
-			} else {
-				fmt.Fprintf(newPatch, "new file mode %s\n", changes.Mode)
-				fmt.Fprintf(newPatch, "--- /dev/null\n")
-			}
+// patchLine is a line of a computed hunk: the text of a line of the document, starting with its prefix.
+type patchLine struct {
+	text      string
+	lineBreak string
+}
 
-			fmt.Fprintf(newPatch, "+++ b/%s\n", path)
+func (l patchLine) prefix() byte {
+	if l.text == `` {
+		return ' '
+	}
+	return l.text[0]
+}
 
-			fmt.Fprint(newPatch, `@@ -`)
-			fmt.Fprintf(newPatch, `%d`, oldStart)
-			if oldLength != 1 {
-				fmt.Fprintf(newPatch, `,%d`, oldLength)
-			}
+func (l patchLine) isChange() bool {
+	return l.prefix() == '+' || l.prefix() == '-'
+}
 
-			fmt.Fprintf(newPatch, ` +%d`, newStart)
-			if newLength != 1 {
-				fmt.Fprintf(newPatch, `,%d`, newLength)
-			}
+func (l patchLine) inOld() bool {
+	return l.prefix() == ' ' || l.prefix() == '-'
+}
 
-			fmt.Fprintln(newPatch, ` @@`)
-
-			previousIncluded := false
-			for i := hunk.LineStart(); i < hunk.LineEnd(); i++ {
-				line := doc.Lines[i]
-				kind := line.Kind
-
-				if lineSet.contains(i) || kind == ContextLine || previousIncluded && kind == NoEndOfLineLine {
-					newPatch.WriteString(line.Text)
-					newPatch.WriteString(line.LineBreak)
-					previousIncluded = true
-				} else if !dir.IsUndo() && kind == RemovalLine || dir.IsUndo() && kind == AdditionLine {
-					newPatch.WriteString(` `)
-					newPatch.WriteString(line.Text[1:len(line.Text)])
-					newPatch.WriteString(line.LineBreak)
-					previousIncluded = true
-				} else {
-					previousIncluded = false
-				}
-			}
+func (l patchLine) inNew() bool {
+	return l.prefix() == ' ' || l.prefix() == '+'
+}
+
+func anyInOld(lines []patchLine) bool {
+	for _, l := range lines {
+		if l.inOld() {
+			return true
 		}
 	}
+	return false
+}
 
-	return newPatch.String(), nil
+// hunkLines returns the lines of a hunk as they should be in the patch. Changes that aren't selected either disappear
+// or become context, depending on whether the side the patch is applied to has them.
+func hunkLines(doc Document, hunk Hunk, selected set[int], dir Direction) []patchLine {
+	var res []patchLine
+
+	previousIncluded := false
+	for i := hunk.LineStart(); i < hunk.LineEnd(); i++ {
+		line := doc.Lines[i]
+		kind := line.Kind
+
+		if selected.contains(i) || kind == ContextLine || previousIncluded && kind == NoEndOfLineLine {
+			res = append(res, patchLine{text: line.Text, lineBreak: line.LineBreak})
+			previousIncluded = true
+		} else if !dir.IsUndo() && kind == RemovalLine || dir.IsUndo() && kind == AdditionLine {
+			res = append(res, patchLine{text: ` ` + line.Text[1:], lineBreak: line.LineBreak})
+			previousIncluded = true
+		} else {
+			previousIncluded = false
+		}
+	}
+
+	return res
+}
+
+// firstLine returns the number of the first line of one side of a hunk. A side without lines is numbered after the
+// line before it, which is where its lines go once a patch gives it some.
+func firstLine(start, length int) int {
+	if length == 0 {
+		return start + 1
+	}
+	return start
+}
+
+type lineRange struct {
+	start int
+	end   int
+}
+
+// changeRanges returns the parts of a hunk's lines that make up a minimal patch: every change with up to context
+// unchanged lines around it. Changes closer together than that share a hunk, like they do in git's own diffs.
+func changeRanges(lines []patchLine, context int) []lineRange {
+	var res []lineRange
+	for i, l := range lines {
+		if !l.isChange() {
+			continue
+		}
+
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+		end := i + context + 1
+		if end > len(lines) {
+			end = len(lines)
+		}
+
+		if n := len(res); n > 0 && start <= res[n-1].end {
+			res[n-1].end = end
+		} else {
+			res = append(res, lineRange{start: start, end: end})
+		}
+	}
+
+	// The no newline marker belongs with the line before it.
+	for i, r := range res {
+		if r.start < len(lines) && lines[r.start].prefix() == '\\' {
+			res[i].start++
+		}
+		if r.end < len(lines) && lines[r.end].prefix() == '\\' {
+			res[i].end++
+		}
+	}
+
+	return res
+}
+
+func writeHunk(sb *strings.Builder, oldStart, newStart int, lines []patchLine) {
+	oldLength := 0
+	newLength := 0
+	for _, l := range lines {
+		if l.inOld() {
+			oldLength++
+		}
+		if l.inNew() {
+			newLength++
+		}
+	}
+
+	// Empty sides are numbered after the line before them again, which git needs when there is no context.
+	if oldLength == 0 {
+		oldStart--
+	}
+	if newLength == 0 {
+		newStart--
+	}
+
+	fmt.Fprint(sb, `@@ -`)
+	fmt.Fprintf(sb, `%d`, oldStart)
+	if oldLength != 1 {
+		fmt.Fprintf(sb, `,%d`, oldLength)
+	}
+
+	fmt.Fprintf(sb, ` +%d`, newStart)
+	if newLength != 1 {
+		fmt.Fprintf(sb, `,%d`, newLength)
+	}
+
+	fmt.Fprintln(sb, ` @@`)
+
+	for _, l := range lines {
+		sb.WriteString(l.text)
+		sb.WriteString(l.lineBreak)
+	}
 }
 
 type set[K comparable] map[K]struct{}
@@ -0,0 +1,159 @@
+package patch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestComputeAcrossHunksAndEntries(t *testing.T) {
+	doc := ParseDocument([]string{
+		`diff --git a/a.txt b/a.txt
+index 8baef1b..0c00383 100644
+--- a/a.txt
++++ b/a.txt
+@@ -1,3 +1,3 @@
+ a
+-b
++B
+ c
+@@ -10,3 +10,3 @@
+ j
+-k
++K
+ l
+`,
+		`diff --git a/b.txt b/b.txt
+index 8baef1b..0c00383 100644
+--- a/b.txt
++++ b/b.txt
+@@ -1,2 +1,2 @@
+ x
+-y
++Y
+`})
+
+	// Out of order on purpose: the patch should come out in document order regardless.
+	p, err := Compute(doc, []int{20, 12, 7}, Stage)
+	require.NoError(t, err)
+	assert.Equal(t, `--- a/a.txt
++++ b/a.txt
+@@ -1,3 +1,4 @@
+ a
+ b
++B
+ c
+@@ -10,3 +10,4 @@
+ j
+ k
++K
+ l
+--- a/b.txt
++++ b/b.txt
+@@ -1,2 +1 @@
+ x
+-y
+`, p)
+}
+
+func TestComputeTrimsContext(t *testing.T) {
+	// A diff with the whole file as context, like the ones of the full file mode.
+	doc := ParseDocument([]string{
+		`diff --git a/a.txt b/a.txt
+index 8baef1b..0c00383 100644
+--- a/a.txt
++++ b/a.txt
+@@ -1,12 +1,12 @@
+ l1
+-l2
++L2
+ l3
+ l4
+ l5
+ l6
+ l7
+ l8
+ l9
+ l10
+-l11
++L11
+ l12
+`})
+
+	p, err := Compute(doc, []int{6, 7}, Stage)
+	require.NoError(t, err)
+	assert.Equal(t, `--- a/a.txt
++++ b/a.txt
+@@ -1,5 +1,5 @@
+ l1
+-l2
++L2
+ l3
+ l4
+ l5
+`, p)
+
+	// Changes too far apart for their context to touch end up in separate hunks.
+	p, err = Compute(doc, []int{6, 7, 16, 17}, Stage)
+	require.NoError(t, err)
+	assert.Equal(t, `--- a/a.txt
++++ b/a.txt
+@@ -1,5 +1,5 @@
+ l1
+-l2
++L2
+ l3
+ l4
+ l5
+@@ -8,5 +8,5 @@
+ l8
+ l9
+ l10
+-l11
++L11
+ l12
+`, p)
+}
+
+func TestComputeWithoutContext(t *testing.T) {
+	// A diff with no context, like the ones shown with the context lines turned all the way down.
+	doc := ParseDocument([]string{
+		`diff --git a/a.txt b/a.txt
+index 8baef1b..0c00383 100644
+--- a/a.txt
++++ b/a.txt
+@@ -2,0 +3,2 @@ l2
++new1
++new2
+@@ -5 +6,0 @@ l4
+-l5
+`})
+
+	p, err := Compute(doc, []int{6}, Stage)
+	require.NoError(t, err)
+	assert.Equal(t, `--- a/a.txt
++++ b/a.txt
+@@ -2,0 +3 @@
++new2
+`, p)
+
+	// Unstaging the second line keeps the first one as context, so the old side isn't empty anymore.
+	p, err = Compute(doc, []int{6}, Unstage)
+	require.NoError(t, err)
+	assert.Equal(t, `--- a/a.txt
++++ b/a.txt
+@@ -3 +3,2 @@
+ new1
++new2
+`, p)
+
+	// The old side is what the patch is applied to, so that's the side the position of the removal comes from.
+	p, err = Compute(doc, []int{8}, Stage)
+	require.NoError(t, err)
+	assert.Equal(t, `--- a/a.txt
++++ b/a.txt
+@@ -5 +6,0 @@
+-l5
+`, p)
+}
@@ -0,0 +1,61 @@
+package patch
+
+// changeKey identifies a change by what it changes rather than by where it is in a document: the file, and the number
+// of the line in the old version of it for a removal or in the new version for an addition. Different diffs of the
+// same files, like one that ignores whitespace and one that doesn't, give the same key to the same change.
+type changeKey struct {
+	path    string
+	oldPath string
+	kind    LineKind
+	num     int
+}
+
+func (d Document) forEachChange(visit func(index int, k changeKey)) {
+	for _, e := range d.Entries {
+		for _, h := range e.Hunks {
+			oldNum, newNum := h.OldStart, h.NewStart
+			for i := h.LineStart() + 1; i < h.LineEnd(); i++ {
+				k := changeKey{
+					path:    e.Changes.Path,
+					oldPath: e.Changes.OldPath,
+					kind:    d.Lines[i].Kind,
+				}
+
+				switch k.kind {
+				case ContextLine:
+					oldNum++
+					newNum++
+				case RemovalLine:
+					k.num = oldNum
+					visit(i, k)
+					oldNum++
+				case AdditionLine:
+					k.num = newNum
+					visit(i, k)
+					newNum++
+				}
+			}
+		}
+	}
+}
+
+// Remap finds the changes at the given lines of one document in another diff of the same files and returns their
+// lines there. It's used to patch with the real diff what was selected in a diff that hides some changes. Lines that
+// aren't changes in both documents are left out.
+func Remap(from, to Document, lines []int) []int {
+	selected := newSet(lines...)
+	want := set[changeKey]{}
+	from.forEachChange(func(index int, k changeKey) {
+		if selected.contains(index) {
+			want[k] = struct{}{}
+		}
+	})
+
+	var res []int
+	to.forEachChange(func(index int, k changeKey) {
+		if want.contains(k) {
+			res = append(res, index)
+		}
+	})
+	return res
+}
@@ -0,0 +1,54 @@
+package patch
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRemap(t *testing.T) {
+	exact := ParseDocument([]string{
+		`diff --git a/a.txt b/a.txt
+index 8baef1b..0c00383 100644
+--- a/a.txt
++++ b/a.txt
+@@ -1,4 +1,5 @@
+ a
+-  b
++b
+ c
+-d e
++d   e
++X
+`})
+	// The same changes with whitespace ignored, which only leaves the added line.
+	shown := ParseDocument([]string{
+		`diff --git a/a.txt b/a.txt
+index 8baef1b..0c00383 100644
+--- a/a.txt
++++ b/a.txt
+@@ -2,3 +2,4 @@ a
+ b
+ c
+ d   e
++X
+`})
+
+	lines := Remap(shown, exact, []int{8})
+	require.Equal(t, []int{11}, lines)
+
+	// The whitespace changes that weren't shown stay out of the patch.
+	p, err := Compute(exact, lines, Stage)
+	require.NoError(t, err)
+	assert.Equal(t, `--- a/a.txt
++++ b/a.txt
+@@ -2,3 +2,4 @@
+   b
+ c
+ d e
++X
+`, p)
+
+	assert.Empty(t, Remap(shown, exact, []int{5, 6}))
+}
@@ -0,0 +1,174 @@
+package recovery
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type blobStore interface {
+	WriteBlob(data []byte) (string, error)
+	ReadBlob(id string) ([]byte, error)
+	KeepBlob(ref, id string) error
+}
+
+// Ref keeps the backup blobs reachable.
+const Ref = `refs/istage/backups`
+
+// Backup is a patch that was reverted from the working tree. The patch itself is stored as a blob in the object
+// database.
+type Backup struct {
+	BlobID string
+	Time   time.Time
+	Paths  []string
+}
+
+// Store keeps the content discarded by resets so it can be restored later. Each backup is a line in an index file,
+// much like a reflog:
+//
+//	<blob id> <unix time>\t<path>\t<path>...
+//
+// git does not know about the index file, so the blobs are also kept reachable from Ref, which stops git gc from pruning
+// them.
+type Store struct {
+	mu sync.Mutex
+
+	indexPath string
+	blobs     blobStore
+}
+
+func NewStore(indexPath string, blobs blobStore) *Store {
+	return &Store{
+		indexPath: indexPath,
+		blobs:     blobs,
+	}
+}
+
+func (s *Store) Save(patchContents string) (Backup, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id, err := s.blobs.WriteBlob([]byte(patchContents))
+	if err != nil {
+		return Backup{}, fmt.Errorf(`failed to write backup blob: %w`, err)
+	}
+	err = s.blobs.KeepBlob(Ref, id)
+	if err != nil {
+		return Backup{}, fmt.Errorf(`failed to keep backup blob %s: %w`, id, err)
+	}
+
+	b := Backup{
+		BlobID: id,
+		Time:   time.Now(),
+		Paths:  patchPaths(patchContents),
+	}
+
+	err = os.MkdirAll(filepath.Dir(s.indexPath), 0o755)
+	if err != nil {
+		return Backup{}, err
+	}
+
+	f, err := os.OpenFile(s.indexPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return Backup{}, err
+	}
+	defer f.Close()
+
+	_, err = fmt.Fprintf(f, "%s %d\t%s\n", b.BlobID, b.Time.Unix(), strings.Join(b.Paths, "\t"))
+	if err != nil {
+		return Backup{}, err
+	}
+
+	return b, nil
+}
+
+// List returns all backups, most recent first.
+func (s *Store) List() ([]Backup, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.Open(s.indexPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var res []Backup
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		b, err := parseIndexLine(sc.Text())
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, b)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	// The index is written in chronological order.
+	for i, j := 0, len(res)-1; i < j; i, j = i+1, j-1 {
+		res[i], res[j] = res[j], res[i]
+	}
+
+	return res, nil
+}
+
+func (s *Store) Load(b Backup) (string, error) {
+	bs, err := s.blobs.ReadBlob(b.BlobID)
+	if err != nil {
+		return ``, fmt.Errorf(`failed to read backup blob %s: %w`, b.BlobID, err)
+	}
+	return string(bs), nil
+}
+
+func parseIndexLine(line string) (Backup, error) {
+	header, paths, _ := strings.Cut(line, "\t")
+
+	id, ts, ok := strings.Cut(header, ` `)
+	if !ok {
+		return Backup{}, fmt.Errorf(`malformed backup index line %q`, line)
+	}
+
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return Backup{}, fmt.Errorf(`malformed backup index line %q: %w`, line, err)
+	}
+
+	b := Backup{
+		BlobID: id,
+		Time:   time.Unix(unix, 0),
+	}
+	if paths != `` {
+		b.Paths = strings.Split(paths, "\t")
+	}
+
+	return b, nil
+}
+
+// patchPaths returns the files a patch changes. Both sides are read, since deleted files only have the old one.
+func patchPaths(patchContents string) []string {
+	var res []string
+	seen := map[string]bool{}
+	for _, l := range strings.Split(patchContents, "\n") {
+		l = strings.TrimSuffix(l, "\r")
+		p, ok := strings.CutPrefix(l, `--- a/`)
+		if !ok {
+			p, ok = strings.CutPrefix(l, `+++ b/`)
+		}
+		if ok && p != `` && !seen[p] {
+			seen[p] = true
+			res = append(res, p)
+		}
+	}
+	return res
+}
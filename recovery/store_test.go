@@ -0,0 +1,121 @@
+package recovery
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testBlobs struct {
+	blobs map[string][]byte
+	kept  map[string]string
+}
+
+func newTestBlobs() *testBlobs {
+	return &testBlobs{
+		blobs: map[string][]byte{},
+		kept:  map[string]string{},
+	}
+}
+
+func (tb *testBlobs) WriteBlob(data []byte) (string, error) {
+	sum := sha1.Sum(data)
+	id := hex.EncodeToString(sum[:])
+	tb.blobs[id] = data
+	return id, nil
+}
+
+func (tb *testBlobs) ReadBlob(id string) ([]byte, error) {
+	bs, ok := tb.blobs[id]
+	if !ok {
+		return nil, errors.New(`not found`)
+	}
+	return bs, nil
+}
+
+func (tb *testBlobs) KeepBlob(ref, id string) error {
+	tb.kept[id] = ref
+	return nil
+}
+
+const patchA = `--- a/a.txt
++++ b/a.txt
+@@ -1 +1,2 @@
+ abc
++def
+`
+
+const patchB = `--- a/b.txt
++++ b/b.txt
+@@ -1 +1,2 @@
+ abc
++def
+--- a/dir/c d.txt
++++ b/dir/c d.txt
+@@ -1 +1,2 @@
+ abc
++def
+`
+
+func TestSaveListAndLoad(t *testing.T) {
+	blobs := newTestBlobs()
+	s := NewStore(filepath.Join(t.TempDir(), `istage`, `backups`), blobs)
+
+	bs, err := s.List()
+	require.NoError(t, err)
+	assert.Empty(t, bs)
+
+	a, err := s.Save(patchA)
+	require.NoError(t, err)
+	assert.Equal(t, []string{`a.txt`}, a.Paths)
+
+	b, err := s.Save(patchB)
+	require.NoError(t, err)
+	assert.Equal(t, []string{`b.txt`, `dir/c d.txt`}, b.Paths)
+
+	bs, err = s.List()
+	require.NoError(t, err)
+	require.Len(t, bs, 2)
+
+	assert.Equal(t, b.BlobID, bs[0].BlobID)
+	assert.Equal(t, b.Paths, bs[0].Paths)
+	assert.Equal(t, b.Time.Unix(), bs[0].Time.Unix())
+	assert.Equal(t, a.BlobID, bs[1].BlobID)
+	assert.Equal(t, a.Paths, bs[1].Paths)
+
+	content, err := s.Load(bs[0])
+	require.NoError(t, err)
+	assert.Equal(t, patchB, content)
+
+	assert.Equal(t, map[string]string{a.BlobID: Ref, b.BlobID: Ref}, blobs.kept)
+
+	delete(blobs.blobs, a.BlobID)
+	_, err = s.Load(bs[1])
+	assert.Error(t, err)
+}
+
+func TestPatchPaths(t *testing.T) {
+	const deleted = `diff --git a/a.txt b/a.txt
+deleted file mode 100644
+--- a/a.txt
++++ /dev/null
+@@ -1 +0,0 @@
+-abc
+`
+	const added = `diff --git a/b.txt b/b.txt
+new file mode 100644
+--- /dev/null
++++ b/b.txt
+@@ -0,0 +1 @@
++abc
+`
+	assert.Equal(t, []string{`a.txt`}, patchPaths(deleted))
+	assert.Equal(t, []string{`b.txt`}, patchPaths(added))
+	assert.Equal(t, []string{`a.txt`, `b.txt`}, patchPaths(deleted+added))
+	assert.Equal(t, []string{`b.txt`, `dir/c d.txt`}, patchPaths(patchB))
+}
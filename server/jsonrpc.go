@@ -0,0 +1,102 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+)
+
+const jsonRPCVersion = `2.0`
+
+const (
+	codeParseError     = -32700
+	codeInvalidRequest = -32600
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+	codeInternalError  = -32603
+	codeGitError       = -32000
+)
+
+type request struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+}
+
+func (r request) isNotification() bool {
+	return r.ID == nil
+}
+
+type response struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id"`
+	Result  json.RawMessage  `json:"result,omitempty"`
+	Error   *Error           `json:"error,omitempty"`
+}
+
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf(`jsonrpc error %d: %s`, e.Code, e.Message)
+}
+
+func newError(code int, format string, args ...any) *Error {
+	return &Error{
+		Code:    code,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+// readMessage reads a single message framed the way the language server protocol does it: a set of headers
+// terminated by an empty line, followed by a body of exactly Content-Length bytes.
+func readMessage(r *bufio.Reader) ([]byte, error) {
+	headers, err := textproto.NewReader(r).ReadMIMEHeader()
+	if err != nil {
+		if errors.Is(err, io.EOF) && len(headers) == 0 {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf(`failed to read headers: %w`, err)
+	}
+
+	lengthHeader := headers.Get(`Content-Length`)
+	if lengthHeader == `` {
+		return nil, errors.New(`missing Content-Length header`)
+	}
+
+	length, err := strconv.Atoi(strings.TrimSpace(lengthHeader))
+	if err != nil || length < 0 {
+		return nil, fmt.Errorf(`invalid Content-Length header %q`, lengthHeader)
+	}
+
+	body := make([]byte, length)
+	_, err = io.ReadFull(r, body)
+	if err != nil {
+		return nil, fmt.Errorf(`failed to read body: %w`, err)
+	}
+
+	return body, nil
+}
+
+func writeMessage(w io.Writer, msg any) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "Content-Length: %d\r\n\r\n", len(body))
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(body)
+	return err
+}
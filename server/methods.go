@@ -0,0 +1,201 @@
+package server
+
+import (
+	"encoding/json"
+
+	"github.com/cszczepaniak/go-istage/git"
+	"github.com/cszczepaniak/go-istage/patch"
+)
+
+type fileResult struct {
+	Path   string `json:"path"`
+	Status string `json:"status"`
+}
+
+var fileStatusNames = map[git.FileStatus]string{
+	git.FileStatusUnmodified: `unmodified`,
+	git.FileStatusAdded:      `added`,
+	git.FileStatusDeleted:    `deleted`,
+	git.FileStatusModified:   `modified`,
+	git.FileStatusRenamed:    `renamed`,
+	git.FileStatusCopied:     `copied`,
+	git.FileStatusIgnored:    `ignored`,
+	git.FileStatusUntracked:  `untracked`,
+	git.FileStatusTypeChange: `typechange`,
+	git.FileStatusUnreadable: `unreadable`,
+	git.FileStatusConflicted: `conflicted`,
+}
+
+func toFileResults(files []git.File) []fileResult {
+	res := make([]fileResult, 0, len(files))
+	for _, f := range files {
+		res = append(res, fileResult{
+			Path:   f.Path,
+			Status: fileStatusNames[f.Status],
+		})
+	}
+	return res
+}
+
+func (s *Server) unstagedFiles(json.RawMessage) (any, error) {
+	files, err := s.docs.UnstagedFiles()
+	if err != nil {
+		return nil, err
+	}
+	return toFileResults(files), nil
+}
+
+func (s *Server) stagedFiles(json.RawMessage) (any, error) {
+	files, err := s.docs.StagedFiles()
+	if err != nil {
+		return nil, err
+	}
+	return toFileResults(files), nil
+}
+
+func (s *Server) unstagedDocument(json.RawMessage) (any, error) {
+	return s.loadDocument(false)
+}
+
+func (s *Server) stagedDocument(json.RawMessage) (any, error) {
+	return s.loadDocument(true)
+}
+
+// loadDocument reads the document again, since the repository may have changed outside the server, and keeps it for
+// the line indices of the next patch.
+func (s *Server) loadDocument(staged bool) (patch.Document, error) {
+	last := &s.unstagedDoc
+	getDoc := s.docs.UnstagedChanges
+	if staged {
+		last = &s.stagedDoc
+		getDoc = s.docs.StagedChanges
+	}
+
+	doc, err := getDoc()
+	if err != nil {
+		return patch.Document{}, err
+	}
+
+	*last = &doc
+	return doc, nil
+}
+
+// lastDocument returns the document last returned to the client, which its line indices refer to. Indices into a
+// document the client hasn't seen would point at whatever lines happen to be there, so that is an error.
+func (s *Server) lastDocument(staged bool) (patch.Document, error) {
+	last, name := s.unstagedDoc, `unstaged`
+	if staged {
+		last, name = s.stagedDoc, `staged`
+	}
+
+	if last == nil {
+		return patch.Document{}, newError(codeInvalidParams, `fetch the %s document before applying a patch to it`, name)
+	}
+	return *last, nil
+}
+
+func (s *Server) invalidate() {
+	s.stagedDoc = nil
+	s.unstagedDoc = nil
+}
+
+type applyPatchParams struct {
+	Direction patch.Direction `json:"direction"`
+	Lines     []int           `json:"lines"`
+}
+
+func (s *Server) applyPatch(params json.RawMessage) (any, error) {
+	var p applyPatchParams
+	err := parseParams(params, &p)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unstaging works on the staged changes; staging and resetting work on the unstaged changes.
+	doc, err := s.lastDocument(p.Direction == patch.Unstage)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, l := range p.Lines {
+		if l < 0 || l >= len(doc.Lines) {
+			return nil, newError(codeInvalidParams, `line index %d out of range`, l)
+		}
+	}
+
+	defer s.invalidate()
+	return nil, s.patcher.ApplyPatch(p.Direction, doc, p.Lines)
+}
+
+type fileParams struct {
+	Path string `json:"path"`
+}
+
+func (s *Server) stageFile(params json.RawMessage) (any, error) {
+	f, err := s.findFile(params, s.docs.UnstagedFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	defer s.invalidate()
+	return nil, s.fileStager.StageFile(f)
+}
+
+func (s *Server) unstageFile(params json.RawMessage) (any, error) {
+	f, err := s.findFile(params, s.docs.StagedFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	defer s.invalidate()
+	return nil, s.fileStager.UnstageFile(f)
+}
+
+func (s *Server) findFile(params json.RawMessage, getFiles func() ([]git.File, error)) (git.File, error) {
+	var p fileParams
+	err := parseParams(params, &p)
+	if err != nil {
+		return git.File{}, err
+	}
+
+	files, err := getFiles()
+	if err != nil {
+		return git.File{}, err
+	}
+
+	for _, f := range files {
+		if f.Path == p.Path {
+			return f, nil
+		}
+	}
+
+	return git.File{}, newError(codeInvalidParams, `no changes to %q`, p.Path)
+}
+
+type commitParams struct {
+	Message string `json:"message"`
+}
+
+func (s *Server) commit(params json.RawMessage) (any, error) {
+	var p commitParams
+	err := parseParams(params, &p)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.Message == `` {
+		return nil, newError(codeInvalidParams, `empty commit message`)
+	}
+
+	defer s.invalidate()
+	return nil, s.committer.Commit(p.Message)
+}
+
+func (s *Server) shutdown(json.RawMessage) (any, error) {
+	return nil, nil
+}
+
+func (s *Server) exit(json.RawMessage) (any, error) {
+	s.exited = true
+	return nil, nil
+}
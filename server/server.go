@@ -0,0 +1,169 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+
+	"github.com/cszczepaniak/go-istage/git"
+	"github.com/cszczepaniak/go-istage/logging"
+	"github.com/cszczepaniak/go-istage/patch"
+)
+
+type documentProvider interface {
+	StagedChanges() (patch.Document, error)
+	UnstagedChanges() (patch.Document, error)
+	StagedFiles() ([]git.File, error)
+	UnstagedFiles() ([]git.File, error)
+}
+
+type patcher interface {
+	ApplyPatch(dir patch.Direction, doc patch.Document, selectedLines []int) error
+}
+
+type fileStager interface {
+	StageFile(file git.File) error
+	UnstageFile(file git.File) error
+}
+
+type committer interface {
+	Commit(msg string) error
+}
+
+// Server answers JSON-RPC requests for the staging operations of a single repository. document/staged and
+// document/unstaged always read the repository again, and the documents they return are kept so that their line
+// indices stay valid for patch/apply until the repository is changed through the server.
+type Server struct {
+	docs       documentProvider
+	patcher    patcher
+	fileStager fileStager
+	committer  committer
+
+	stagedDoc   *patch.Document
+	unstagedDoc *patch.Document
+
+	handlers map[string]handlerFunc
+	exited   bool
+}
+
+type handlerFunc func(params json.RawMessage) (any, error)
+
+func New(docs documentProvider, p patcher, fs fileStager, c committer) *Server {
+	s := &Server{
+		docs:       docs,
+		patcher:    p,
+		fileStager: fs,
+		committer:  c,
+	}
+
+	s.handlers = map[string]handlerFunc{
+		`files/unstaged`:    s.unstagedFiles,
+		`files/staged`:      s.stagedFiles,
+		`document/unstaged`: s.unstagedDocument,
+		`document/staged`:   s.stagedDocument,
+		`patch/apply`:       s.applyPatch,
+		`file/stage`:        s.stageFile,
+		`file/unstage`:      s.unstageFile,
+		`commit`:            s.commit,
+		`shutdown`:          s.shutdown,
+		`exit`:              s.exit,
+	}
+
+	return s
+}
+
+// Serve handles requests from r until the client sends the exit notification or closes its end of the stream.
+func (s *Server) Serve(r io.Reader, w io.Writer) error {
+	br := bufio.NewReader(r)
+	for !s.exited {
+		body, err := readMessage(br)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		resp, ok := s.handleMessage(body)
+		if !ok {
+			continue
+		}
+
+		err = writeMessage(w, resp)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Server) handleMessage(body []byte) (response, bool) {
+	var req request
+	err := json.Unmarshal(body, &req)
+	if err != nil {
+		return errorResponse(nil, newError(codeParseError, `invalid JSON: %s`, err)), true
+	}
+
+	if req.JSONRPC != jsonRPCVersion || req.Method == `` {
+		return errorResponse(req.ID, newError(codeInvalidRequest, `invalid request`)), true
+	}
+
+	logging.Info(`handling request`, `method`, req.Method)
+
+	h, ok := s.handlers[req.Method]
+	if !ok {
+		return errorResponse(req.ID, newError(codeMethodNotFound, `method %q not found`, req.Method)), !req.isNotification()
+	}
+
+	res, err := h(req.Params)
+	if req.isNotification() {
+		if err != nil {
+			logging.Error(`error handling notification`, `method`, req.Method, `err`, err)
+		}
+		return response{}, false
+	}
+
+	if err != nil {
+		var rpcErr *Error
+		if !errors.As(err, &rpcErr) {
+			rpcErr = newError(codeGitError, `%s`, err)
+		}
+		return errorResponse(req.ID, rpcErr), true
+	}
+
+	if res == nil {
+		res = struct{}{}
+	}
+
+	bs, err := json.Marshal(res)
+	if err != nil {
+		return errorResponse(req.ID, newError(codeInternalError, `failed to encode result: %s`, err)), true
+	}
+
+	return response{
+		JSONRPC: jsonRPCVersion,
+		ID:      req.ID,
+		Result:  bs,
+	}, true
+}
+
+func errorResponse(id *json.RawMessage, err *Error) response {
+	return response{
+		JSONRPC: jsonRPCVersion,
+		ID:      id,
+		Error:   err,
+	}
+}
+
+func parseParams(raw json.RawMessage, into any) error {
+	if len(raw) == 0 {
+		return newError(codeInvalidParams, `missing params`)
+	}
+
+	err := json.Unmarshal(raw, into)
+	if err != nil {
+		return newError(codeInvalidParams, `invalid params: %s`, err)
+	}
+	return nil
+}
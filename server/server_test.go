@@ -0,0 +1,283 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/cszczepaniak/go-istage/git"
+	"github.com/cszczepaniak/go-istage/logging"
+	"github.com/cszczepaniak/go-istage/patch"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testDocs struct {
+	staged   patch.Document
+	unstaged patch.Document
+	files    []git.File
+
+	docLoads int
+}
+
+func (d *testDocs) StagedChanges() (patch.Document, error) {
+	d.docLoads++
+	return d.staged, nil
+}
+
+func (d *testDocs) UnstagedChanges() (patch.Document, error) {
+	d.docLoads++
+	return d.unstaged, nil
+}
+
+func (d *testDocs) StagedFiles() ([]git.File, error) {
+	return d.files, nil
+}
+
+func (d *testDocs) UnstagedFiles() ([]git.File, error) {
+	return d.files, nil
+}
+
+type patchCall struct {
+	dir   patch.Direction
+	doc   patch.Document
+	lines []int
+}
+
+type testRepo struct {
+	patches  []patchCall
+	staged   []git.File
+	unstaged []git.File
+	commits  []string
+	err      error
+}
+
+func (r *testRepo) ApplyPatch(dir patch.Direction, doc patch.Document, lines []int) error {
+	r.patches = append(r.patches, patchCall{dir: dir, doc: doc, lines: lines})
+	return r.err
+}
+
+func (r *testRepo) StageFile(f git.File) error {
+	r.staged = append(r.staged, f)
+	return r.err
+}
+
+func (r *testRepo) UnstageFile(f git.File) error {
+	r.unstaged = append(r.unstaged, f)
+	return r.err
+}
+
+func (r *testRepo) Commit(msg string) error {
+	r.commits = append(r.commits, msg)
+	return r.err
+}
+
+func frame(t testing.TB, msgs ...string) io.Reader {
+	buf := &bytes.Buffer{}
+	for _, m := range msgs {
+		fmt.Fprintf(buf, "Content-Length: %d\r\n\r\n%s", len(m), m)
+	}
+	return buf
+}
+
+func readResponses(t testing.TB, r io.Reader) []map[string]any {
+	var res []map[string]any
+	br := bufio.NewReader(r)
+	for {
+		body, err := readMessage(br)
+		if errors.Is(err, io.EOF) {
+			return res
+		}
+		require.NoError(t, err)
+
+		var m map[string]any
+		require.NoError(t, json.Unmarshal(body, &m))
+		res = append(res, m)
+	}
+}
+
+var testDoc = patch.ParseDocument([]string{
+	`diff --git a/a.txt b/a.txt
+index 8baef1b..0c00383 100644
+--- a/a.txt
++++ b/a.txt
+@@ -1 +1 @@
+-abc
++def
+`})
+
+func TestReadAndWriteMessages(t *testing.T) {
+	buf := &bytes.Buffer{}
+	require.NoError(t, writeMessage(buf, map[string]int{`a`: 1}))
+	assert.Equal(t, "Content-Length: 7\r\n\r\n{\"a\":1}", buf.String())
+
+	body, err := readMessage(bufio.NewReader(buf))
+	require.NoError(t, err)
+	assert.Equal(t, `{"a":1}`, string(body))
+
+	_, err = readMessage(bufio.NewReader(buf))
+	assert.ErrorIs(t, err, io.EOF)
+
+	_, err = readMessage(bufio.NewReader(bytes.NewBufferString("Foo: bar\r\n\r\n{}")))
+	assert.Error(t, err)
+}
+
+func TestFilesAndDocuments(t *testing.T) {
+	require.NoError(t, logging.Init(logging.Config{}))
+
+	docs := &testDocs{
+		unstaged: testDoc,
+		files: []git.File{{
+			Path:   `a.txt`,
+			Status: git.FileStatusModified,
+		}},
+	}
+	s := New(docs, &testRepo{}, &testRepo{}, &testRepo{})
+
+	out := &bytes.Buffer{}
+	err := s.Serve(frame(t,
+		`{"jsonrpc":"2.0","id":1,"method":"files/unstaged"}`,
+		`{"jsonrpc":"2.0","id":2,"method":"document/unstaged"}`,
+		`{"jsonrpc":"2.0","id":3,"method":"document/unstaged"}`,
+	), out)
+	require.NoError(t, err)
+
+	resps := readResponses(t, out)
+	require.Len(t, resps, 3)
+
+	assert.Equal(t, float64(1), resps[0][`id`])
+	assert.Equal(t, []any{map[string]any{`path`: `a.txt`, `status`: `modified`}}, resps[0][`result`])
+
+	bs, err := json.Marshal(resps[1][`result`])
+	require.NoError(t, err)
+	var doc patch.Document
+	require.NoError(t, json.Unmarshal(bs, &doc))
+	assert.Equal(t, testDoc, doc)
+
+	assert.Equal(t, resps[1][`result`], resps[2][`result`])
+	assert.Equal(t, 2, docs.docLoads, `the document should be reloaded on every request`)
+}
+
+func TestApplyPatch(t *testing.T) {
+	require.NoError(t, logging.Init(logging.Config{}))
+
+	docs := &testDocs{
+		staged:   testDoc,
+		unstaged: testDoc,
+	}
+	repo := &testRepo{}
+	s := New(docs, repo, repo, repo)
+
+	out := &bytes.Buffer{}
+	err := s.Serve(frame(t,
+		`{"jsonrpc":"2.0","id":1,"method":"patch/apply","params":{"direction":"Stage","lines":[5,6]}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"document/unstaged"}`,
+		`{"jsonrpc":"2.0","id":3,"method":"patch/apply","params":{"direction":"Stage","lines":[5,6]}}`,
+		`{"jsonrpc":"2.0","id":4,"method":"document/staged"}`,
+		`{"jsonrpc":"2.0","id":5,"method":"patch/apply","params":{"direction":"Unstage","lines":[6]}}`,
+		`{"jsonrpc":"2.0","id":6,"method":"patch/apply","params":{"direction":"Unstage","lines":[6]}}`,
+		`{"jsonrpc":"2.0","id":7,"method":"document/unstaged"}`,
+		`{"jsonrpc":"2.0","id":8,"method":"patch/apply","params":{"direction":"Reset","lines":[100]}}`,
+		`{"jsonrpc":"2.0","id":9,"method":"patch/apply","params":{"direction":"Sideways","lines":[6]}}`,
+	), out)
+	require.NoError(t, err)
+
+	resps := readResponses(t, out)
+	require.Len(t, resps, 9)
+
+	// Line indices only mean something in a document the client has, so it must fetch one first, and again after
+	// every change.
+	assert.Equal(t, float64(codeInvalidParams), resps[0][`error`].(map[string]any)[`code`])
+	assert.Contains(t, resps[0][`error`].(map[string]any)[`message`], `fetch the unstaged document`)
+	assert.Equal(t, map[string]any{}, resps[2][`result`])
+	assert.Equal(t, map[string]any{}, resps[4][`result`])
+	assert.Equal(t, float64(codeInvalidParams), resps[5][`error`].(map[string]any)[`code`])
+	assert.Contains(t, resps[5][`error`].(map[string]any)[`message`], `fetch the staged document`)
+	assert.Equal(t, float64(codeInvalidParams), resps[7][`error`].(map[string]any)[`code`])
+	assert.Equal(t, float64(codeInvalidParams), resps[8][`error`].(map[string]any)[`code`])
+
+	assert.Equal(t, []patchCall{{
+		dir:   patch.Stage,
+		doc:   testDoc,
+		lines: []int{5, 6},
+	}, {
+		dir:   patch.Unstage,
+		doc:   testDoc,
+		lines: []int{6},
+	}}, repo.patches)
+
+	assert.Equal(t, 3, docs.docLoads, `only fetching a document should load it`)
+}
+
+func TestStageUnstageAndCommit(t *testing.T) {
+	require.NoError(t, logging.Init(logging.Config{}))
+
+	f := git.File{
+		Path:   `a.txt`,
+		Status: git.FileStatusDeleted,
+	}
+	docs := &testDocs{
+		files: []git.File{f},
+	}
+	repo := &testRepo{}
+	s := New(docs, repo, repo, repo)
+
+	out := &bytes.Buffer{}
+	err := s.Serve(frame(t,
+		`{"jsonrpc":"2.0","id":1,"method":"file/stage","params":{"path":"a.txt"}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"file/unstage","params":{"path":"a.txt"}}`,
+		`{"jsonrpc":"2.0","id":3,"method":"file/stage","params":{"path":"b.txt"}}`,
+		`{"jsonrpc":"2.0","id":4,"method":"commit","params":{"message":"hello"}}`,
+		`{"jsonrpc":"2.0","id":5,"method":"commit"}`,
+	), out)
+	require.NoError(t, err)
+
+	resps := readResponses(t, out)
+	require.Len(t, resps, 5)
+
+	assert.Equal(t, []git.File{f}, repo.staged)
+	assert.Equal(t, []git.File{f}, repo.unstaged)
+	assert.Equal(t, []string{`hello`}, repo.commits)
+
+	assert.Nil(t, resps[0][`error`])
+	assert.Nil(t, resps[1][`error`])
+	assert.Equal(t, float64(codeInvalidParams), resps[2][`error`].(map[string]any)[`code`])
+	assert.Nil(t, resps[3][`error`])
+	assert.Equal(t, float64(codeInvalidParams), resps[4][`error`].(map[string]any)[`code`])
+}
+
+func TestErrors(t *testing.T) {
+	require.NoError(t, logging.Init(logging.Config{}))
+
+	repo := &testRepo{
+		err: errors.New(`git exploded`),
+	}
+	s := New(&testDocs{}, repo, repo, repo)
+
+	out := &bytes.Buffer{}
+	err := s.Serve(frame(t,
+		`not json`,
+		`{"id":1,"method":"commit"}`,
+		`{"jsonrpc":"2.0","id":2,"method":"foo"}`,
+		`{"jsonrpc":"2.0","method":"foo"}`,
+		`{"jsonrpc":"2.0","id":3,"method":"commit","params":{"message":"hello"}}`,
+		`{"jsonrpc":"2.0","method":"exit"}`,
+		`{"jsonrpc":"2.0","id":4,"method":"shutdown"}`,
+	), out)
+	require.NoError(t, err)
+
+	resps := readResponses(t, out)
+	require.Len(t, resps, 4)
+
+	assert.Equal(t, float64(codeParseError), resps[0][`error`].(map[string]any)[`code`])
+	assert.Equal(t, float64(codeInvalidRequest), resps[1][`error`].(map[string]any)[`code`])
+	assert.Equal(t, float64(codeMethodNotFound), resps[2][`error`].(map[string]any)[`code`])
+	assert.Equal(t, map[string]any{
+		`code`:    float64(codeGitError),
+		`message`: `git exploded`,
+	}, resps[3][`error`])
+}
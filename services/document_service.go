@@ -1,36 +1,135 @@
 package services
 
 import (
+	"sync/atomic"
+
 	"github.com/cszczepaniak/go-istage/git"
 	"github.com/cszczepaniak/go-istage/patch"
+	"github.com/cszczepaniak/go-istage/settings"
 )
 
-type gitClient interface {
-	StagedChanges() ([]string, error)
-	UnstagedChanges() ([]string, error)
-	StagedFiles() ([]git.File, error)
-	UnstagedFiles() ([]git.File, error)
+type settingsStore interface {
+	Get() settings.Settings
+	Update(change func(*settings.Settings)) error
 }
 
 type DocumentService struct {
-	gc gitClient
+	gc       git.Backend
+	settings settingsStore
+
+	viewFiles bool
+	viewStage bool
 
-	viewFiles    bool
-	viewStage    bool
-	fullFileDiff bool
+	// fullFileDiff is toggled by the UI while documents are being loaded in the background.
+	fullFileDiff atomic.Bool
 }
 
-func NewDocumentService(gc gitClient) (*DocumentService, error) {
+func NewDocumentService(gc git.Backend, settings settingsStore) (*DocumentService, error) {
 	ds := &DocumentService{
-		gc:           gc,
-		viewFiles:    false, // TODO support these
-		viewStage:    false,
-		fullFileDiff: false, // TODO support these
+		gc:        gc,
+		settings:  settings,
+		viewFiles: false, // TODO support this
+		viewStage: false,
 	}
 
 	return ds, nil
 }
 
+// ToggleFullFile switches between showing a few lines of context around changes and showing whole files. It returns
+// whether whole files are now shown.
+func (ds *DocumentService) ToggleFullFile() bool {
+	full := !ds.fullFileDiff.Load()
+	ds.fullFileDiff.Store(full)
+	return full
+}
+
+func (ds *DocumentService) FullFile() bool {
+	return ds.fullFileDiff.Load()
+}
+
+// ChangeContext adds delta to the number of context lines, which can't go below zero, and returns the new settings.
+// Fewer lines of context split hunks into smaller ones.
+func (ds *DocumentService) ChangeContext(delta int) (settings.Settings, error) {
+	return ds.update(func(s *settings.Settings) {
+		s.ContextLines = max(s.ContextLines+delta, 0)
+	})
+}
+
+// ChangeInterhunk adds delta to the number of unchanged lines up to which hunks are merged, which can't go below zero,
+// and returns the new settings.
+func (ds *DocumentService) ChangeInterhunk(delta int) (settings.Settings, error) {
+	return ds.update(func(s *settings.Settings) {
+		s.InterhunkLines = max(s.InterhunkLines+delta, 0)
+	})
+}
+
+// CycleWhitespace switches to the next way of hiding changes of whitespace and returns the new settings.
+func (ds *DocumentService) CycleWhitespace() (settings.Settings, error) {
+	return ds.update(func(s *settings.Settings) {
+		s.Whitespace = s.Whitespace.Next()
+	})
+}
+
+// IgnoresWhitespace returns whether documents hide some changes of whitespace, in which case they can't be patched
+// directly: see ExactChanges.
+func (ds *DocumentService) IgnoresWhitespace() bool {
+	return ds.settings.Get().Whitespace != settings.ExactWhitespace
+}
+
+// ExactChanges returns the changes a patch in the given direction applies to, whitespace included.
+func (ds *DocumentService) ExactChanges(dir patch.Direction) (patch.Document, error) {
+	opts := ds.diffOptions()
+	opts.Whitespace = git.ExactWhitespace
+
+	get := ds.gc.UnstagedChanges
+	if dir == patch.Unstage {
+		get = ds.gc.StagedChanges
+	}
+
+	changes, err := get(opts)
+	if err != nil {
+		return patch.Document{}, err
+	}
+
+	return patch.ParseDocument(changes), nil
+}
+
+func (ds *DocumentService) DiffSettings() settings.Settings {
+	return ds.settings.Get()
+}
+
+func (ds *DocumentService) update(change func(*settings.Settings)) (settings.Settings, error) {
+	err := ds.settings.Update(change)
+	return ds.settings.Get(), err
+}
+
+func (ds *DocumentService) diffOptions() git.DiffOptions {
+	s := ds.settings.Get()
+	opts := git.DiffOptions{
+		ContextLines:   s.ContextLines,
+		InterhunkLines: s.InterhunkLines,
+		Whitespace:     whitespaceModes[s.Whitespace],
+	}
+	if ds.fullFileDiff.Load() {
+		opts.ContextLines = git.FullContext
+	}
+	return opts
+}
+
+var whitespaceModes = map[settings.Whitespace]git.Whitespace{
+	settings.ExactWhitespace:        git.ExactWhitespace,
+	settings.IgnoreWhitespaceAtEOL:  git.IgnoreWhitespaceAtEOL,
+	settings.IgnoreWhitespaceChange: git.IgnoreWhitespaceChange,
+	settings.IgnoreAllWhitespace:    git.IgnoreAllWhitespace,
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
 func (ds *DocumentService) ToggleView() {
 	ds.viewStage = !ds.viewStage
 }
@@ -40,7 +139,7 @@ func (ds *DocumentService) ViewStage() bool {
 }
 
 func (ds *DocumentService) StagedChanges() (patch.Document, error) {
-	changes, err := ds.gc.StagedChanges()
+	changes, err := ds.gc.StagedChanges(ds.diffOptions())
 	if err != nil {
 		return patch.Document{}, err
 	}
@@ -49,7 +148,7 @@ func (ds *DocumentService) StagedChanges() (patch.Document, error) {
 }
 
 func (ds *DocumentService) UnstagedChanges() (patch.Document, error) {
-	changes, err := ds.gc.UnstagedChanges()
+	changes, err := ds.gc.UnstagedChanges(ds.diffOptions())
 	if err != nil {
 		return patch.Document{}, err
 	}
@@ -57,6 +156,15 @@ func (ds *DocumentService) UnstagedChanges() (patch.Document, error) {
 	return patch.ParseDocument(changes), nil
 }
 
+// UnstagedStats and StagedStats count the changes the documents would have, without computing them.
+func (ds *DocumentService) UnstagedStats() (git.DiffStats, error) {
+	return ds.gc.UnstagedStats(ds.diffOptions())
+}
+
+func (ds *DocumentService) StagedStats() (git.DiffStats, error) {
+	return ds.gc.StagedStats(ds.diffOptions())
+}
+
 func (ds *DocumentService) UnstagedFiles() ([]git.File, error) {
 	return ds.gc.UnstagedFiles()
 }
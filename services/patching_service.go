@@ -1,26 +1,57 @@
 package services
 
 import (
+	"errors"
+	"fmt"
+
+	"github.com/cszczepaniak/go-istage/git"
+	"github.com/cszczepaniak/go-istage/history"
 	"github.com/cszczepaniak/go-istage/patch"
+	"github.com/cszczepaniak/go-istage/recovery"
 )
 
-type patchClient interface {
-	ApplyPatch(string, patch.Direction) error
+// ErrNotUndoable is returned when a change was made but couldn't be recorded in the history.
+var ErrNotUndoable = errors.New(`applied, but it can't be undone`)
+
+type journal interface {
+	Record(history.Operation) error
+	Drop() error
+	Undo(func(history.Operation) error) error
+	Redo(func(history.Operation) error) error
+}
+
+type backupStore interface {
+	Save(patchContents string) (recovery.Backup, error)
+}
+
+// exactDiffer gives the real changes behind documents that hide some of them.
+type exactDiffer interface {
+	IgnoresWhitespace() bool
+	ExactChanges(dir patch.Direction) (patch.Document, error)
 }
 
 type PatchingService struct {
-	pc patchClient
+	pc      git.Backend
+	journal journal
+	backups backupStore
+	exact   exactDiffer
 }
 
-func NewPatchingService(pc patchClient) *PatchingService {
+func NewPatchingService(pc git.Backend, j journal, backups backupStore, exact exactDiffer) *PatchingService {
 	return &PatchingService{
-		pc: pc,
+		pc:      pc,
+		journal: j,
+		backups: backups,
+		exact:   exact,
 	}
 }
 
 func (ps *PatchingService) ApplyPatch(dir patch.Direction, doc patch.Document, selectedLines []int) error {
 	var lines []int
 	for _, l := range selectedLines {
+		if l < 0 || l >= len(doc.Lines) {
+			return fmt.Errorf(`line index %d out of range`, l)
+		}
 		if doc.Lines[l].Kind.IsAdditionOrRemoval() {
 			lines = append(lines, l)
 		}
@@ -30,10 +61,143 @@ func (ps *PatchingService) ApplyPatch(dir patch.Direction, doc patch.Document, s
 		return nil
 	}
 
+	if ps.exact.IgnoresWhitespace() {
+		// A patch of a document without some whitespace changes wouldn't apply, since the index and the working tree
+		// still have them. Patch the same changes in the real diff instead, where the hidden ones are left alone.
+		exact, err := ps.exact.ExactChanges(dir)
+		if err != nil {
+			return err
+		}
+
+		lines = patch.Remap(doc, exact, lines)
+		doc = exact
+		if len(lines) == 0 {
+			return nil
+		}
+	}
+
 	patch, err := patch.Compute(doc, lines, dir)
 	if err != nil {
 		return err
 	}
 
-	return ps.pc.ApplyPatch(patch, dir)
+	op := history.Operation{
+		Kind:      history.PatchOperation,
+		Direction: dir,
+		Patch:     patch,
+	}
+
+	return ps.apply(op)
+}
+
+func (ps *PatchingService) StageFile(file git.File) error {
+	return ps.StageFiles([]git.File{file})
+}
+
+func (ps *PatchingService) UnstageFile(file git.File) error {
+	return ps.UnstageFiles([]git.File{file})
+}
+
+// StageFiles stages several files as a single operation, so that they are undone together.
+func (ps *PatchingService) StageFiles(files []git.File) error {
+	return ps.applyFiles(patch.Stage, files)
+}
+
+func (ps *PatchingService) UnstageFiles(files []git.File) error {
+	return ps.applyFiles(patch.Unstage, files)
+}
+
+// applyFiles stages or unstages whole files. Staging them again isn't the opposite of unstaging them, or the other
+// way around, when only some of their changes were staged, so the index is saved first for undoing it.
+func (ps *PatchingService) applyFiles(dir patch.Direction, files []git.File) error {
+	op := history.Operation{
+		Kind:      history.FileOperation,
+		Direction: dir,
+	}
+	if len(files) == 1 {
+		op.File = files[0]
+	} else {
+		op.Files = files
+	}
+
+	index, err := ps.pc.IndexEntries(op.Paths())
+	if err != nil {
+		return fmt.Errorf(`failed to save the index: %w`, err)
+	}
+	op.Index = index
+
+	return ps.apply(op)
+}
+
+func (ps *PatchingService) Undo() error {
+	return ps.journal.Undo(ps.revertOperation)
+}
+
+func (ps *PatchingService) Redo() error {
+	return ps.journal.Redo(ps.applyOperation)
+}
+
+// Restore puts the content discarded by a reset back into the working tree.
+func (ps *PatchingService) Restore(patchContents string) error {
+	return ps.pc.UnapplyPatch(patchContents, patch.Reset)
+}
+
+func (ps *PatchingService) apply(op history.Operation) error {
+	if op.Direction == patch.Reset {
+		// Resets can't be recovered from the repository, so the discarded content must be backed up and in the journal
+		// before we touch the working tree.
+		_, err := ps.backups.Save(op.Patch)
+		if err != nil {
+			return fmt.Errorf(`failed to back up changes before resetting: %w`, err)
+		}
+
+		err = ps.journal.Record(op)
+		if err != nil {
+			return err
+		}
+
+		err = ps.applyOperation(op)
+		if err != nil {
+			if dropErr := ps.journal.Drop(); dropErr != nil {
+				return fmt.Errorf(`%w (and failed to update history: %s)`, err, dropErr)
+			}
+			return err
+		}
+
+		return nil
+	}
+
+	err := ps.applyOperation(op)
+	if err != nil {
+		return err
+	}
+
+	err = ps.journal.Record(op)
+	if err != nil {
+		return fmt.Errorf(`%w: %s`, ErrNotUndoable, err)
+	}
+	return nil
+}
+
+func (ps *PatchingService) applyOperation(op history.Operation) error {
+	switch op.Kind {
+	case history.PatchOperation:
+		return ps.pc.ApplyPatch(op.Patch, op.Direction)
+	case history.FileOperation:
+		if op.Direction == patch.Unstage {
+			return ps.pc.UnstageFiles(op.AllFiles())
+		}
+		return ps.pc.StageFiles(op.AllFiles())
+	}
+	return fmt.Errorf(`unknown operation kind %d`, op.Kind)
+}
+
+func (ps *PatchingService) revertOperation(op history.Operation) error {
+	switch op.Kind {
+	case history.PatchOperation:
+		return ps.pc.UnapplyPatch(op.Patch, op.Direction)
+	case history.FileOperation:
+		return ps.pc.RestoreIndex(op.Paths(), op.Index)
+	}
+	return fmt.Errorf(`unknown operation kind %d`, op.Kind)
 }
@@ -0,0 +1,179 @@
+package services
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/cszczepaniak/go-istage/git"
+	"github.com/cszczepaniak/go-istage/git/gitfake"
+	"github.com/cszczepaniak/go-istage/history"
+	"github.com/cszczepaniak/go-istage/patch"
+	"github.com/cszczepaniak/go-istage/recovery"
+	"github.com/cszczepaniak/go-istage/settings"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testChange = `diff --git a/a.txt b/a.txt
+index 8baef1b..0c00383 100644
+--- a/a.txt
++++ b/a.txt
+@@ -1,2 +1,2 @@
+ a
+-b
++c
+`
+
+func newTestServices(t *testing.T, repo *gitfake.Repo) (*DocumentService, *PatchingService, *recovery.Store) {
+	dir := t.TempDir()
+
+	st, err := settings.Open(filepath.Join(dir, `settings.json`))
+	require.NoError(t, err)
+	ds, err := NewDocumentService(repo, st)
+	require.NoError(t, err)
+
+	j, err := history.Open(filepath.Join(dir, `history.json`))
+	require.NoError(t, err)
+	backups := recovery.NewStore(filepath.Join(dir, `backups`), repo)
+
+	return ds, NewPatchingService(repo, j, backups, ds), backups
+}
+
+func TestPatchingServiceUndoRedoFiles(t *testing.T) {
+	repo := gitfake.New(`/repo`)
+	files := []git.File{{Path: `a.txt`}, {Path: `b.txt`}}
+	repo.SetUnstaged(files)
+	ds, ps, _ := newTestServices(t, repo)
+
+	require.NoError(t, ps.StageFiles(files))
+	staged, err := ds.StagedFiles()
+	require.NoError(t, err)
+	assert.Equal(t, files, staged)
+
+	require.NoError(t, ps.Undo())
+	staged, err = ds.StagedFiles()
+	require.NoError(t, err)
+	assert.Empty(t, staged)
+
+	require.NoError(t, ps.Redo())
+	staged, err = ds.StagedFiles()
+	require.NoError(t, err)
+	assert.Equal(t, files, staged)
+}
+
+func TestPatchingServiceUndoStagePartiallyStagedFile(t *testing.T) {
+	repo := gitfake.New(`/repo`)
+	files := []git.File{{Path: `a.txt`}}
+	repo.SetUnstaged(files, testChange)
+	repo.SetStaged(files, testChange)
+	ds, ps, _ := newTestServices(t, repo)
+
+	require.NoError(t, ps.StageFile(files[0]))
+	unstaged, err := ds.UnstagedFiles()
+	require.NoError(t, err)
+	assert.Empty(t, unstaged)
+
+	// Undoing puts back the changes that were staged before, rather than unstaging the file.
+	require.NoError(t, ps.Undo())
+	unstaged, err = ds.UnstagedFiles()
+	require.NoError(t, err)
+	assert.Equal(t, files, unstaged)
+	staged, err := ds.StagedChanges()
+	require.NoError(t, err)
+	assert.Equal(t, patch.ParseDocument([]string{testChange}), staged)
+}
+
+func TestPatchingServiceResetIsBackedUp(t *testing.T) {
+	repo := gitfake.New(`/repo`)
+	repo.SetUnstaged([]git.File{{Path: `a.txt`}}, testChange)
+	ds, ps, backups := newTestServices(t, repo)
+
+	doc, err := ds.UnstagedChanges()
+	require.NoError(t, err)
+	require.NoError(t, ps.ApplyPatch(patch.Reset, doc, []int{6, 7}))
+
+	patches := repo.Patches()
+	require.Len(t, patches, 1)
+	assert.Equal(t, patch.Reset, patches[0].Direction)
+
+	list, err := backups.List()
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	backup, err := backups.Load(list[0])
+	require.NoError(t, err)
+	assert.Equal(t, patches[0].Contents, backup)
+	assert.Equal(t, []string{list[0].BlobID}, repo.Kept(recovery.Ref))
+
+	require.NoError(t, ps.Undo())
+	patches = repo.Patches()
+	require.Len(t, patches, 2)
+	assert.True(t, patches[1].Reverted)
+}
+
+func TestPatchingServiceFailedResetIsNotRecorded(t *testing.T) {
+	repo := gitfake.New(`/repo`)
+	repo.SetUnstaged([]git.File{{Path: `a.txt`}}, testChange)
+	ds, ps, _ := newTestServices(t, repo)
+
+	doc, err := ds.UnstagedChanges()
+	require.NoError(t, err)
+
+	repo.Fail(assert.AnError)
+	assert.ErrorIs(t, ps.ApplyPatch(patch.Reset, doc, []int{6, 7}), assert.AnError)
+	repo.Fail(nil)
+
+	assert.Empty(t, repo.Patches())
+	assert.Error(t, ps.Undo())
+}
+
+func TestDocumentServiceDiffOptions(t *testing.T) {
+	repo := gitfake.New(`/repo`)
+	ds, _, _ := newTestServices(t, repo)
+
+	_, err := ds.ChangeContext(-1)
+	require.NoError(t, err)
+	_, err = ds.ChangeInterhunk(2)
+	require.NoError(t, err)
+	_, err = ds.CycleWhitespace()
+	require.NoError(t, err)
+
+	_, err = ds.UnstagedChanges()
+	require.NoError(t, err)
+	assert.Equal(t, git.DiffOptions{
+		ContextLines:   2,
+		InterhunkLines: 2,
+		Whitespace:     git.IgnoreWhitespaceAtEOL,
+	}, repo.DiffOptions())
+
+	ds.ToggleFullFile()
+	_, err = ds.StagedChanges()
+	require.NoError(t, err)
+	assert.Equal(t, git.FullContext, repo.DiffOptions().ContextLines)
+}
+
+type failingJournal struct {
+	*history.Journal
+}
+
+func (failingJournal) Record(history.Operation) error {
+	return assert.AnError
+}
+
+func TestPatchingServiceUnrecordedChangeIsApplied(t *testing.T) {
+	repo := gitfake.New(`/repo`)
+	repo.SetUnstaged([]git.File{{Path: `a.txt`}}, testChange)
+	ds, ps, _ := newTestServices(t, repo)
+	ps.journal = failingJournal{Journal: ps.journal.(*history.Journal)}
+
+	doc, err := ds.UnstagedChanges()
+	require.NoError(t, err)
+
+	err = ps.ApplyPatch(patch.Stage, doc, []int{6, 7})
+	assert.ErrorIs(t, err, ErrNotUndoable)
+	assert.ErrorContains(t, err, assert.AnError.Error())
+	require.Len(t, repo.Patches(), 1)
+
+	err = ps.StageFiles([]git.File{{Path: `a.txt`}})
+	assert.ErrorIs(t, err, ErrNotUndoable)
+	assert.ErrorIs(t, ps.Undo(), history.ErrNothingToUndo)
+}
@@ -0,0 +1,115 @@
+package settings
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Settings are the preferences changed from the UI that are kept from one run to the next, separately for each
+// repository.
+type Settings struct {
+	// ContextLines is the number of unchanged lines shown around changes.
+	ContextLines int `json:"contextLines"`
+	// InterhunkLines is the number of unchanged lines up to which two hunks are merged into one.
+	InterhunkLines int `json:"interhunkLines"`
+	// Whitespace is which changes of whitespace are hidden.
+	Whitespace Whitespace `json:"whitespace,omitempty"`
+}
+
+// Whitespace is a way of comparing lines that hides some changes of whitespace.
+type Whitespace string
+
+const (
+	ExactWhitespace        Whitespace = ``
+	IgnoreWhitespaceAtEOL  Whitespace = `eol`
+	IgnoreWhitespaceChange Whitespace = `change`
+	IgnoreAllWhitespace    Whitespace = `all`
+)
+
+var whitespaceOrder = []Whitespace{ExactWhitespace, IgnoreWhitespaceAtEOL, IgnoreWhitespaceChange, IgnoreAllWhitespace}
+
+// Next returns the whitespace mode that hides a little more than this one, going back to exact comparisons after the
+// one that ignores all whitespace.
+func (w Whitespace) Next() Whitespace {
+	for i, o := range whitespaceOrder {
+		if o == w {
+			return whitespaceOrder[(i+1)%len(whitespaceOrder)]
+		}
+	}
+	return ExactWhitespace
+}
+
+func Default() Settings {
+	return Settings{
+		ContextLines: 3,
+	}
+}
+
+// Store keeps the settings in a JSON file. Settings missing from the file keep their default value.
+type Store struct {
+	mu sync.Mutex
+
+	path     string
+	settings Settings
+}
+
+func Open(path string) (*Store, error) {
+	s := &Store{
+		path:     path,
+		settings: Default(),
+	}
+
+	bs, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(bs, &s.settings)
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *Store) Get() Settings {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.settings
+}
+
+// Update changes the settings with the given function and saves them.
+func (s *Store) Update(change func(*Settings)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	change(&s.settings)
+	return s.save()
+}
+
+func (s *Store) save() error {
+	bs, err := json.MarshalIndent(s.settings, ``, `  `)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(s.path), 0o755)
+	if err != nil {
+		return err
+	}
+
+	tmp := s.path + `.tmp`
+	err = os.WriteFile(tmp, bs, 0o644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, s.path)
+}
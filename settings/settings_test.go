@@ -0,0 +1,46 @@
+package settings
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), `istage`, `settings.json`)
+
+	s, err := Open(path)
+	require.NoError(t, err)
+	assert.Equal(t, Default(), s.Get())
+
+	require.NoError(t, s.Update(func(st *Settings) {
+		st.ContextLines = 1
+		st.InterhunkLines = 4
+	}))
+
+	s, err = Open(path)
+	require.NoError(t, err)
+	assert.Equal(t, Settings{ContextLines: 1, InterhunkLines: 4}, s.Get())
+}
+
+func TestStoreKeepsDefaultsForMissingSettings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), `settings.json`)
+	require.NoError(t, os.WriteFile(path, []byte(`{"interhunkLines": 2}`), 0o644))
+
+	s, err := Open(path)
+	require.NoError(t, err)
+	assert.Equal(t, Settings{ContextLines: 3, InterhunkLines: 2}, s.Get())
+}
+
+func TestWhitespaceNext(t *testing.T) {
+	w := ExactWhitespace
+	var seen []Whitespace
+	for i := 0; i < 4; i++ {
+		w = w.Next()
+		seen = append(seen, w)
+	}
+	assert.Equal(t, []Whitespace{IgnoreWhitespaceAtEOL, IgnoreWhitespaceChange, IgnoreAllWhitespace, ExactWhitespace}, seen)
+}
@@ -2,14 +2,45 @@ package ui
 
 import (
 	"errors"
-	"strings"
 
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/cszczepaniak/go-istage/history"
 	"github.com/cszczepaniak/go-istage/patch"
 	"github.com/cszczepaniak/go-istage/ui/files"
 	"github.com/cszczepaniak/go-istage/ui/lines"
+	"github.com/cszczepaniak/go-istage/ui/status"
 )
 
+// run runs a command that may take a while, like one that runs git. Until it's done, a spinner shows what it's doing
+// and the git commands can be canceled.
+func (v view) run(label string, cmd tea.Cmd) (tea.Model, tea.Cmd) {
+	v.running++
+
+	var tick tea.Cmd
+	v.commandView, tick = v.commandView.Start(label)
+	return v, tea.Batch(tick, func() tea.Msg {
+		return commandDoneMsg{msg: cmd()}
+	})
+}
+
+func (v view) commandDone(msg commandDoneMsg) (tea.Model, tea.Cmd) {
+	v.running--
+	if v.running == 0 {
+		v.commandView = v.commandView.Stop()
+	}
+
+	if msg.msg == nil {
+		return v, nil
+	}
+	return v.Update(msg.msg)
+}
+
+var directionLabels = map[patch.Direction]string{
+	patch.Stage:   `Staging`,
+	patch.Unstage: `Unstaging`,
+	patch.Reset:   `Discarding`,
+}
+
 func (v view) handlePatch(msg lines.PatchMsg) tea.Cmd {
 	return func() tea.Msg {
 		err := v.patcher.ApplyPatch(msg.Direction, msg.Doc, msg.Lines)
@@ -35,9 +66,9 @@ func (v view) handleFile(msg files.HandleFileMsg) tea.Cmd {
 		var err error
 		switch msg.Direction {
 		case patch.Stage:
-			err = v.fileStager.StageFile(msg.File)
+			err = v.fileStager.StageFiles(msg.Files)
 		case patch.Unstage:
-			err = v.fileStager.UnstageFile(msg.File)
+			err = v.fileStager.UnstageFiles(msg.Files)
 		default:
 			err = errors.New(`unimplemented`)
 		}
@@ -48,13 +79,35 @@ func (v view) handleFile(msg files.HandleFileMsg) tea.Cmd {
 	}
 }
 
+func (v view) undo() tea.Cmd {
+	return func() tea.Msg {
+		err := v.patcher.Undo()
+		if errors.Is(err, history.ErrNothingToUndo) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return refreshMsg{}
+	}
+}
+
+func (v view) redo() tea.Cmd {
+	return func() tea.Msg {
+		err := v.patcher.Redo()
+		if errors.Is(err, history.ErrNothingToRedo) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return refreshMsg{}
+	}
+}
+
 func (v view) commit(msg string) tea.Cmd {
 	return func() tea.Msg {
-		err := v.gitExecer.
-			Exec(`commit`).
-			WithArgs(`-F`, `-`).
-			WithStdin(strings.NewReader(msg)).
-			Run()
+		err := v.backend.Commit(msg)
 		if err != nil {
 			return err
 		}
@@ -64,3 +117,32 @@ func (v view) commit(msg string) tea.Cmd {
 		}
 	}
 }
+
+func (v view) goToPrevState() tea.Msg {
+	return goToStateMsg{
+		state: v.prevState,
+	}
+}
+
+func (v view) updateStatus() tea.Msg {
+	branch, err := v.backend.Branch()
+	if err != nil {
+		return err
+	}
+
+	unstaged, err := v.updater.UnstagedStats()
+	if err != nil {
+		return err
+	}
+	staged, err := v.updater.StagedStats()
+	if err != nil {
+		return err
+	}
+
+	return status.InfoMsg{
+		Root:     v.backend.Root(),
+		Branch:   branch,
+		Unstaged: unstaged,
+		Staged:   staged,
+	}
+}
@@ -0,0 +1,153 @@
+package combined
+
+import (
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// pane is a lines view shown in one half of the screen.
+type pane interface {
+	tea.Model
+	CapturesInput() bool
+	UpdateDoc() tea.Msg
+	SetFilter(paths []string)
+}
+
+type KeyConfig struct {
+	SwitchFocusKey string
+}
+
+// UI shows the unstaged changes over the staged ones. Keys go to the focused half, and both halves are refreshed
+// whenever either of them stages or unstages something.
+type UI struct {
+	panes  [2]pane
+	titles [2]string
+	focus  int
+
+	keyCfg KeyConfig
+
+	w, h int
+}
+
+func New(unstaged, staged pane, keyCfg KeyConfig) *UI {
+	return &UI{
+		panes:  [2]pane{unstaged, staged},
+		titles: [2]string{`Unstaged`, `Staged`},
+		keyCfg: keyCfg,
+	}
+}
+
+func (u *UI) Init() tea.Cmd {
+	return nil
+}
+
+// OnEnter reloads both halves.
+func (u *UI) OnEnter() tea.Cmd {
+	return tea.Batch(u.panes[0].UpdateDoc, u.panes[1].UpdateDoc)
+}
+
+// CapturesInput returns whether the focused half needs every key.
+func (u *UI) CapturesInput() bool {
+	return u.panes[u.focus].CapturesInput()
+}
+
+// SetFilter limits both halves to the files with the given paths.
+func (u *UI) SetFilter(paths []string) {
+	for _, p := range u.panes {
+		p.SetFilter(paths)
+	}
+}
+
+func (u *UI) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		u.w = msg.Width
+		u.h = msg.Height
+		return u, u.resize()
+	case tea.KeyMsg:
+		if !u.CapturesInput() && msg.String() == u.keyCfg.SwitchFocusKey {
+			u.focus = 1 - u.focus
+			return u, nil
+		}
+
+		_, cmd := u.panes[u.focus].Update(msg)
+		return u, cmd
+	}
+
+	// Everything else, like new documents and refreshes, concerns both halves.
+	var cmds []tea.Cmd
+	for _, p := range u.panes {
+		_, cmd := p.Update(msg)
+		cmds = append(cmds, cmd)
+	}
+	return u, tea.Batch(cmds...)
+}
+
+// heights returns how many rows each half gets, leaving a row for the title of each.
+func (u *UI) heights() [2]int {
+	// Like the full screen lines views, leave the last row empty.
+	rows := u.h - 1 - len(u.panes)
+	if rows < 0 {
+		rows = 0
+	}
+	return [2]int{rows / 2, rows - rows/2}
+}
+
+func (u *UI) resize() tea.Cmd {
+	var cmds []tea.Cmd
+	for i, h := range u.heights() {
+		// The lines views keep their last row empty, so they're told they have one more than they should fill.
+		_, cmd := u.panes[i].Update(tea.WindowSizeMsg{
+			Width:  u.w,
+			Height: h + 1,
+		})
+		cmds = append(cmds, cmd)
+	}
+	return tea.Batch(cmds...)
+}
+
+var (
+	titleStyle        = lipgloss.NewStyle().Foreground(lipgloss.Color(`#888888`))
+	focusedTitleStyle = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color(`#FFFFFF`)).Background(lipgloss.Color(`#303060`))
+)
+
+func (u *UI) View() string {
+	sb := &strings.Builder{}
+	for i, h := range u.heights() {
+		style := titleStyle
+		if i == u.focus {
+			style = focusedTitleStyle
+		}
+
+		title := ` ` + u.titles[i] + ` `
+		if pad := u.w - lipgloss.Width(title); pad > 0 {
+			title += strings.Repeat(`─`, pad)
+		}
+		sb.WriteString(style.Render(title))
+		sb.WriteString("\n")
+		sb.WriteString(fit(u.panes[i].View(), h))
+	}
+	return sb.String()
+}
+
+// fit cuts or pads the view of a half to exactly the given number of rows, so that the other half stays in place.
+func fit(view string, rows int) string {
+	lines := strings.Split(strings.TrimSuffix(view, "\n"), "\n")
+	if view == `` {
+		lines = nil
+	}
+	if len(lines) > rows {
+		lines = lines[:rows]
+	}
+
+	sb := &strings.Builder{}
+	for i := 0; i < rows; i++ {
+		if i < len(lines) {
+			sb.WriteString(lines[i])
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
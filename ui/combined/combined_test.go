@@ -0,0 +1,87 @@
+package combined
+
+import (
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/cszczepaniak/go-istage/ui/testutils"
+	"github.com/stretchr/testify/assert"
+)
+
+type testPane struct {
+	name   string
+	height int
+	keys   []string
+	msgs   []tea.Msg
+	filter []string
+}
+
+func (p *testPane) Init() tea.Cmd {
+	return nil
+}
+
+func (p *testPane) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		p.height = msg.Height
+	case tea.KeyMsg:
+		p.keys = append(p.keys, msg.String())
+	default:
+		p.msgs = append(p.msgs, msg)
+	}
+	return p, nil
+}
+
+func (p *testPane) View() string {
+	return strings.Repeat(p.name+"\n", 100)
+}
+
+func (p *testPane) CapturesInput() bool {
+	return false
+}
+
+func (p *testPane) UpdateDoc() tea.Msg {
+	return nil
+}
+
+func (p *testPane) SetFilter(paths []string) {
+	p.filter = paths
+}
+
+type refresh struct{}
+
+func TestCombined(t *testing.T) {
+	unstaged := &testPane{name: `unstaged`}
+	staged := &testPane{name: `staged`}
+
+	u := New(unstaged, staged, KeyConfig{SwitchFocusKey: `t`})
+	u = testutils.InitializeModel(t, u)
+
+	// 40 rows, less the two titles and the empty last row.
+	assert.Equal(t, 18, unstaged.height-1)
+	assert.Equal(t, 19, staged.height-1)
+
+	rows := strings.Split(u.View(), "\n")
+	assert.Len(t, rows, 40)
+	assert.Contains(t, rows[0], `Unstaged`)
+	assert.Equal(t, `unstaged`, rows[18])
+	assert.Contains(t, rows[19], `Staged`)
+	assert.Equal(t, `staged`, rows[38])
+
+	// Keys go to the focused half only.
+	u = testutils.ExecKeyPressCycle(u, `s`)
+	u = testutils.ExecKeyPressCycle(u, `t`)
+	u = testutils.ExecKeyPressCycle(u, `u`)
+	assert.Equal(t, []string{`s`}, unstaged.keys)
+	assert.Equal(t, []string{`u`}, staged.keys)
+
+	// Everything else goes to both.
+	u.Update(refresh{})
+	assert.Equal(t, []tea.Msg{refresh{}}, unstaged.msgs)
+	assert.Equal(t, []tea.Msg{refresh{}}, staged.msgs)
+
+	u.SetFilter([]string{`a.txt`})
+	assert.Equal(t, []string{`a.txt`}, unstaged.filter)
+	assert.Equal(t, []string{`a.txt`}, staged.filter)
+}
@@ -7,13 +7,20 @@ import (
 	tea "github.com/charmbracelet/bubbletea"
 )
 
+type KeyConfig struct {
+	CommitKey string
+}
+
 type UI struct {
 	textInput textarea.Model
+
+	keyCfg KeyConfig
 }
 
-func New() *UI {
+func New(keyCfg KeyConfig) *UI {
 	return &UI{
 		textInput: textarea.New(),
+		keyCfg:    keyCfg,
 	}
 }
 
@@ -26,7 +33,7 @@ func (u *UI) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return u, nil
 	case tea.KeyMsg:
 		switch msg.String() {
-		case "ctrl+s":
+		case u.keyCfg.CommitKey:
 			commitMsg := u.textInput.Value()
 			u.textInput.Reset()
 			return u, u.doCommit(commitMsg)
@@ -39,7 +46,11 @@ func (u *UI) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 }
 
 func (u *UI) View() string {
-	return fmt.Sprintf("Enter a commit message:\n\n%s\n\n(ctrl+s to commit, escape to abort)\n", u.textInput.View())
+	return fmt.Sprintf(
+		"Enter a commit message:\n\n%s\n\n(%s to commit, escape to abort)\n",
+		u.textInput.View(),
+		u.keyCfg.CommitKey,
+	)
 }
 
 func (u *UI) OnEnter() tea.Cmd {
@@ -7,12 +7,21 @@ import (
 	"github.com/charmbracelet/lipgloss"
 )
 
+type KeyConfig struct {
+	QuitKey    string
+	DismissKey string
+}
+
 type UI struct {
 	err error
+
+	keyCfg KeyConfig
 }
 
-func New() *UI {
-	return &UI{}
+func New(keyCfg KeyConfig) *UI {
+	return &UI{
+		keyCfg: keyCfg,
+	}
 }
 
 func (*UI) Init() tea.Cmd {
@@ -23,9 +32,9 @@ func (u *UI) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
 		switch msg.String() {
-		case "q":
+		case u.keyCfg.QuitKey:
 			return u, tea.Quit
-		case "esc", "enter":
+		case u.keyCfg.DismissKey, "enter":
 			return u, func() tea.Msg {
 				return ExitMsg{}
 			}
@@ -42,6 +51,6 @@ func (u *UI) View() string {
 	return fmt.Sprintf("%s\n\n%s\n\n%s",
 		"An error occurred:",
 		errMessageStyle.Render(u.err.Error()),
-		"Press enter or escape to continue",
+		fmt.Sprintf("Press enter or %s to continue", u.keyCfg.DismissKey),
 	)
 }
@@ -10,6 +10,7 @@ import (
 	"github.com/cszczepaniak/go-istage/logging"
 	"github.com/cszczepaniak/go-istage/patch"
 	"github.com/cszczepaniak/go-istage/ui/globalstyles"
+	"github.com/cszczepaniak/go-istage/ui/search"
 	"github.com/cszczepaniak/go-istage/window"
 )
 
@@ -25,32 +26,67 @@ type fileGetter interface {
 }
 
 type KeyConfig struct {
+	QuitKey string
+	UpKey   string
+	DownKey string
+
 	HandleFileKey string
+	ToggleDirKey  string
+
+	SearchForwardKey  string
+	SearchBackwardKey string
+	NextMatchKey      string
+	PrevMatchKey      string
+}
+
+// withDefaults fills in the keys for quitting and navigating, which every files view needs.
+func (c KeyConfig) withDefaults() KeyConfig {
+	if c.QuitKey == `` {
+		c.QuitKey = `q`
+	}
+	if c.UpKey == `` {
+		c.UpKey = `up`
+	}
+	if c.DownKey == `` {
+		c.DownKey = `down`
+	}
+	return c
 }
 
 type UI struct {
-	w *window.Window[git.File]
+	w *window.Window[entry]
 
-	files []git.File
-	fg    fileGetter
+	// entries are the rows of the tree built from the files. collapsed holds the paths of the collapsed directories,
+	// which stay collapsed when the files are refreshed.
+	files     []git.File
+	entries   []entry
+	collapsed map[string]struct{}
+	fg        fileGetter
 
 	docType DocType
 
 	keyCfg KeyConfig
 
+	// searchOrigin is the path of the entry the cursor was on when the search started, to go back to if it's
+	// cancelled.
+	search       search.Search
+	searchOrigin string
+
 	h      int
 	cursor int
 }
 
 func NewView(docType DocType, keyCfg KeyConfig, fg fileGetter, windowSize int) *UI {
 	return &UI{
-		w:       window.NewWindow[git.File](nil, windowSize),
-		files:   nil,
-		docType: docType,
-		keyCfg:  keyCfg,
-		fg:      fg,
-		h:       windowSize,
-		cursor:  0,
+		w:         window.NewWindow[entry](nil, windowSize),
+		files:     nil,
+		collapsed: map[string]struct{}{},
+		docType:   docType,
+		keyCfg:    keyCfg.withDefaults(),
+		search:    search.New(),
+		fg:        fg,
+		h:         windowSize,
+		cursor:    0,
 	}
 }
 
@@ -67,15 +103,29 @@ func (u *UI) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		u.h = msg.Height - 1
 		u.resize(u.h)
 	case tea.KeyMsg:
+		if u.search.Typing() {
+			return u, u.updateSearch(msg)
+		}
+
 		switch msg.String() {
-		case "q":
+		case u.keyCfg.QuitKey:
 			return u, tea.Quit
-		case "up":
+		case u.keyCfg.SearchForwardKey:
+			return u, u.startSearch(false)
+		case u.keyCfg.SearchBackwardKey:
+			return u, u.startSearch(true)
+		case u.keyCfg.NextMatchKey:
+			u.nextMatch(false)
+		case u.keyCfg.PrevMatchKey:
+			u.nextMatch(true)
+		case u.keyCfg.UpKey:
 			u.navigate(navigateUp)
-		case "down":
+		case u.keyCfg.DownKey:
 			u.navigate(navigateDown)
 		case u.keyCfg.HandleFileKey:
 			return u, u.handleFile
+		case u.keyCfg.ToggleDirKey:
+			u.toggleDir()
 		}
 	case RefreshMsg:
 		return u, u.UpdateFiles
@@ -123,12 +173,39 @@ func (dv *UI) resize(size int) {
 
 func (dv *UI) setFiles(files []git.File, h int) {
 	dv.files = files
+	dv.setEntries(h)
+}
+
+func (dv *UI) setEntries(h int) {
+	dv.entries = buildTree(dv.files).flatten(0, dv.collapsed)
 	if dv.w == nil {
-		dv.w = window.NewWindow(files, h)
+		dv.w = window.NewWindow(dv.entries, h)
+	} else {
+		dv.w.SetData(dv.entries)
+		dv.w.Resize(h)
+	}
+	if dv.cursor >= dv.w.Size() && dv.w.Size() > 0 {
+		dv.cursor = dv.w.Size() - 1
+	}
+}
+
+// toggleDir collapses or expands the directory under the cursor.
+func (u *UI) toggleDir() {
+	if len(u.entries) == 0 {
+		return
+	}
+
+	e := u.currentEntry()
+	if !e.dir {
+		return
+	}
+
+	if _, ok := u.collapsed[e.path]; ok {
+		delete(u.collapsed, e.path)
 	} else {
-		dv.w.SetData(files)
-		dv.w.Resize(len(files))
+		u.collapsed[e.path] = struct{}{}
 	}
+	u.setEntries(u.h)
 }
 
 var fileStatusToColor = map[git.FileStatus]lipgloss.Style{
@@ -148,9 +225,9 @@ func (dv *UI) View() string {
 
 	viewableLines := dv.w.CurrentValues()
 
-	for i, l := range viewableLines.Values {
+	for i, e := range viewableLines.Values {
 		s := lipgloss.NewStyle()
-		c, ok := fileStatusToColor[l.Status]
+		c, ok := fileStatusToColor[e.status()]
 		if ok {
 			s = s.Inherit(c)
 		}
@@ -158,18 +235,37 @@ func (dv *UI) View() string {
 			s = s.Inherit(globalstyles.SelectedBackground)
 		}
 
-		fmt.Fprintln(sb, s.Render(l.Path))
+		sb.WriteString(strings.Repeat(`  `, e.depth))
+		if !e.dir {
+			fmt.Fprintln(sb, dv.renderPath(e.name, s))
+			continue
+		}
+
+		arrow := `▾ `
+		if _, ok := dv.collapsed[e.path]; ok {
+			arrow = `▸ `
+		}
+		fmt.Fprintln(sb, s.Render(arrow)+dv.renderPath(e.name, s)+e.summary())
+	}
+
+	if dv.search.Typing() {
+		sb.WriteString(dv.search.View())
 	}
 	return sb.String()
 }
 
-func (u *UI) currentFile() git.File {
-	return u.files[u.cursor]
+func (u *UI) currentEntry() entry {
+	return u.entries[u.w.AbsoluteIndex(u.cursor)]
 }
 
+// handleFile stages or unstages the file under the cursor, or every file beneath the directory under the cursor.
 func (u *UI) handleFile() tea.Msg {
+	if len(u.entries) == 0 {
+		return nil
+	}
+
 	msg := HandleFileMsg{
-		File: u.currentFile(),
+		Files: u.currentEntry().files,
 	}
 	msg.Direction = patch.Stage
 	if u.docType == Staged {
@@ -1,6 +1,7 @@
 package files
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/cszczepaniak/go-istage/git"
@@ -73,7 +74,7 @@ func TestHandleFiles(t *testing.T) {
 
 	fv, msg := testutils.ExecKeyPress(fv, `s`)
 	assert.Equal(t, HandleFileMsg{
-		File:      files[0],
+		Files:     []git.File{files[0]},
 		Direction: patch.Stage,
 	}, msg)
 
@@ -81,7 +82,7 @@ func TestHandleFiles(t *testing.T) {
 
 	fv, msg = testutils.ExecKeyPress(fv, `s`)
 	assert.Equal(t, HandleFileMsg{
-		File:      files[1],
+		Files:     []git.File{files[1]},
 		Direction: patch.Stage,
 	}, msg)
 
@@ -89,7 +90,7 @@ func TestHandleFiles(t *testing.T) {
 
 	_, msg = testutils.ExecKeyPress(fv, `s`)
 	assert.Equal(t, HandleFileMsg{
-		File:      files[1],
+		Files:     []git.File{files[1]},
 		Direction: patch.Unstage,
 	}, msg)
 }
@@ -126,3 +127,143 @@ func TestUpdateFiles(t *testing.T) {
 
 	assert.EqualValues(t, files, fv.files)
 }
+
+func TestSearch(t *testing.T) {
+	err := logging.Init(logging.Config{})
+	require.NoError(t, err)
+
+	files := testFileGetter{
+		{Path: `cmd/main.go`},
+		{Path: `api/handler.go`},
+		{Path: `api/handler_test.go`},
+		{Path: `docs/README.md`},
+		{Path: `web/handler.ts`},
+	}
+
+	fv := NewView(Unstaged, KeyConfig{
+		SearchForwardKey:  `/`,
+		SearchBackwardKey: `?`,
+		NextMatchKey:      `n`,
+		PrevMatchKey:      `N`,
+	}, files, 40)
+	fv = testutils.InitializeModel(t, fv)
+
+	fv = testutils.ExecKeyPressCycle(fv, `/`)
+	assert.True(t, fv.CapturesInput())
+	for _, k := range []string{`h`, `a`, `n`, `d`} {
+		fv = testutils.ExecKeyPressCycle(fv, k)
+	}
+	// The search is incremental, so the cursor is already on the first match.
+	assert.Equal(t, files[1], fv.currentEntry().files[0])
+
+	fv = testutils.ExecKeyPressCycle(fv, `enter`)
+	assert.False(t, fv.CapturesInput())
+
+	for _, exp := range []int{2, 4, 1, 2} {
+		fv = testutils.ExecKeyPressCycle(fv, `n`)
+		assert.Equal(t, files[exp], fv.currentEntry().files[0])
+	}
+
+	for _, exp := range []int{1, 4} {
+		fv = testutils.ExecKeyPressCycle(fv, `N`)
+		assert.Equal(t, files[exp], fv.currentEntry().files[0])
+	}
+
+	// Cancelling a search goes back to where it started.
+	fv = testutils.ExecKeyPressCycle(fv, `?`)
+	for _, k := range []string{`R`, `E`} {
+		fv = testutils.ExecKeyPressCycle(fv, k)
+	}
+	assert.Equal(t, files[3], fv.currentEntry().files[0])
+	fv = testutils.ExecKeyPressCycle(fv, `esc`)
+	assert.Equal(t, files[4], fv.currentEntry().files[0])
+}
+
+func TestSearchPaths(t *testing.T) {
+	err := logging.Init(logging.Config{})
+	require.NoError(t, err)
+
+	files := testFileGetter{
+		{Path: `api/handler.go`},
+		{Path: `api/v1/routes.go`},
+		{Path: `cmd/main.go`},
+	}
+
+	fv := NewView(Unstaged, KeyConfig{
+		ToggleDirKey:     `enter`,
+		SearchForwardKey: `/`,
+	}, files, 40)
+	fv = testutils.InitializeModel(t, fv)
+
+	fv = testutils.ExecKeyPressCycle(fv, `enter`)
+	require.Len(t, fv.entries, 3)
+
+	// Queries match whole paths, and matches in collapsed directories are shown.
+	fv = testutils.ExecKeyPressCycle(fv, `/`)
+	for _, k := range []string{`1`, `/`, `r`} {
+		fv = testutils.ExecKeyPressCycle(fv, k)
+	}
+	assert.Equal(t, files[1], fv.currentEntry().files[0])
+	assert.Len(t, fv.entries, 6)
+}
+
+func TestTree(t *testing.T) {
+	err := logging.Init(logging.Config{})
+	require.NoError(t, err)
+
+	files := testFileGetter{
+		{Path: `README.md`, Status: git.FileStatusModified},
+		{Path: `api/handler.go`, Status: git.FileStatusAdded},
+		{Path: `api/v1/routes.go`, Status: git.FileStatusModified},
+		{Path: `cmd/server/main.go`, Status: git.FileStatusDeleted},
+	}
+
+	fv := NewView(Unstaged, KeyConfig{
+		HandleFileKey: `s`,
+		ToggleDirKey:  `enter`,
+	}, files, 40)
+	fv = testutils.InitializeModel(t, fv)
+
+	names := func() []string {
+		var res []string
+		for _, e := range fv.entries {
+			res = append(res, strings.Repeat(`  `, e.depth)+e.name)
+		}
+		return res
+	}
+	assert.Equal(t, []string{
+		`api/`,
+		`  v1/`,
+		`    routes.go`,
+		`  handler.go`,
+		`cmd/server/`,
+		`  main.go`,
+		`README.md`,
+	}, names())
+
+	assert.Equal(t, git.FileStatusModified, fv.entries[0].status())
+	assert.Contains(t, fv.entries[0].summary(), `(2 files: A1 M1)`)
+	assert.Equal(t, git.FileStatusDeleted, fv.entries[4].status())
+
+	// Staging a directory stages everything beneath it.
+	_, msg := testutils.ExecKeyPress(fv, `s`)
+	assert.Equal(t, HandleFileMsg{
+		Files:     []git.File{files[2], files[1]},
+		Direction: patch.Stage,
+	}, msg)
+
+	fv = testutils.ExecKeyPressCycle(fv, `enter`)
+	assert.Equal(t, []string{
+		`api/`,
+		`cmd/server/`,
+		`  main.go`,
+		`README.md`,
+	}, names())
+
+	// Directories stay collapsed when the files are refreshed.
+	fv = testutils.RunUpdateCycle[*UI](fv.Update(RefreshMsg{}))
+	assert.Len(t, fv.entries, 4)
+
+	fv = testutils.ExecKeyPressCycle(fv, `enter`)
+	assert.Len(t, fv.entries, 7)
+}
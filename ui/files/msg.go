@@ -7,8 +7,9 @@ import (
 
 type RefreshMsg struct{}
 
+// HandleFileMsg asks for files to be staged or unstaged. There are several when a directory was picked.
 type HandleFileMsg struct {
-	File      git.File
+	Files     []git.File
 	Direction patch.Direction
 }
 
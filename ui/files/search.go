@@ -0,0 +1,143 @@
+package files
+
+import (
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/cszczepaniak/go-istage/ui/globalstyles"
+	"github.com/cszczepaniak/go-istage/ui/search"
+)
+
+// CapturesInput returns whether every key should go to the view, because a search query is being typed.
+func (u *UI) CapturesInput() bool {
+	return u.search.Typing()
+}
+
+func (u *UI) startSearch(backward bool) tea.Cmd {
+	u.searchOrigin = ``
+	if len(u.entries) > 0 {
+		u.searchOrigin = u.currentEntry().path
+	}
+
+	// The query is typed on the last line of the view.
+	if u.h > 1 {
+		u.w.Resize(u.h - 1)
+	}
+	u.jumpToPath(u.searchOrigin)
+
+	return u.search.Start(backward)
+}
+
+func (u *UI) updateSearch(msg tea.KeyMsg) tea.Cmd {
+	ev, cmd := u.search.Update(msg)
+	switch ev {
+	case search.QueryChanged:
+		if !u.jumpToMatch(u.searchOrigin, 0, false) {
+			u.jumpToPath(u.searchOrigin)
+		}
+	case search.Confirmed:
+		u.w.Resize(u.h)
+	case search.Cancelled:
+		u.w.Resize(u.h)
+		u.jumpToPath(u.searchOrigin)
+	}
+	return cmd
+}
+
+// nextMatch moves to the next match after the cursor, or the previous one if reverse is set.
+func (u *UI) nextMatch(reverse bool) {
+	if len(u.entries) == 0 {
+		return
+	}
+
+	step := 1
+	if u.search.Backward() != reverse {
+		step = -1
+	}
+	u.jumpToMatch(u.currentEntry().path, step, reverse)
+}
+
+// jumpToMatch moves to the first entry that matches the search, starting offset entries after the one with the given
+// path. Entries are matched by their whole path, including the ones in collapsed directories, which are expanded to
+// show the match.
+func (u *UI) jumpToMatch(fromPath string, offset int, reverse bool) bool {
+	all := buildTree(u.files).flatten(0, nil)
+
+	from := 0
+	for i, e := range all {
+		if e.path == fromPath {
+			from = i
+		}
+	}
+
+	i, ok := u.search.Next(len(all), from+offset, reverse, func(i int) bool {
+		return u.search.Match(all[i].path)
+	})
+	if ok {
+		u.reveal(all[i].path)
+		u.jumpToPath(all[i].path)
+	}
+	return ok
+}
+
+// reveal expands the collapsed directories the entry with the given path is in.
+func (u *UI) reveal(p string) {
+	changed := false
+	for dir := range u.collapsed {
+		if strings.HasPrefix(p, dir+`/`) {
+			delete(u.collapsed, dir)
+			changed = true
+		}
+	}
+	if !changed {
+		return
+	}
+
+	size := u.h
+	if u.search.Typing() && u.h > 1 {
+		size--
+	}
+	u.setEntries(size)
+}
+
+func (u *UI) jumpToPath(p string) {
+	for i, e := range u.entries {
+		if e.path == p {
+			u.jumpTo(i)
+			return
+		}
+	}
+}
+
+func (u *UI) jumpTo(index int) {
+	if len(u.entries) == 0 {
+		return
+	}
+
+	relIndex := u.w.RelativeIndex(index)
+	if relIndex < 0 {
+		u.w.JumpTo(index)
+		relIndex = u.w.RelativeIndex(index)
+	}
+	u.cursor = relIndex
+}
+
+func (u *UI) renderPath(path string, s lipgloss.Style) string {
+	found := u.search.Matches(path)
+	if len(found) == 0 {
+		return s.Render(path)
+	}
+
+	matchStyle := globalstyles.SearchMatch.Copy().Inherit(s)
+
+	sb := &strings.Builder{}
+	prev := 0
+	for _, sp := range found {
+		sb.WriteString(s.Render(path[prev:sp.Start]))
+		sb.WriteString(matchStyle.Render(path[sp.Start:sp.End]))
+		prev = sp.End
+	}
+	sb.WriteString(s.Render(path[prev:]))
+	return sb.String()
+}
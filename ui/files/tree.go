@@ -0,0 +1,171 @@
+package files
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/cszczepaniak/go-istage/git"
+)
+
+// entry is a row of the files view: either a file, or a directory standing for every file beneath it.
+type entry struct {
+	// path is the path of the file or directory, and name is what is shown for it. Directories that hold nothing but
+	// another directory are shown as one, so their name can have several path segments.
+	path  string
+	name  string
+	depth int
+	dir   bool
+	files []git.File
+}
+
+type dirNode struct {
+	name  string
+	path  string
+	dirs  map[string]*dirNode
+	files []git.File
+}
+
+func buildTree(files []git.File) *dirNode {
+	root := &dirNode{}
+	for _, f := range files {
+		n := root
+		segments := strings.Split(f.Path, `/`)
+		for _, s := range segments[:len(segments)-1] {
+			n = n.child(s)
+		}
+		n.files = append(n.files, f)
+	}
+	return root
+}
+
+func (n *dirNode) child(name string) *dirNode {
+	if c, ok := n.dirs[name]; ok {
+		return c
+	}
+
+	c := &dirNode{
+		name: name,
+		path: path.Join(n.path, name),
+	}
+	if n.dirs == nil {
+		n.dirs = map[string]*dirNode{}
+	}
+	n.dirs[name] = c
+	return c
+}
+
+func (n *dirNode) sortedDirs() []*dirNode {
+	dirs := make([]*dirNode, 0, len(n.dirs))
+	for _, d := range n.dirs {
+		dirs = append(dirs, d)
+	}
+	sort.Slice(dirs, func(i, j int) bool {
+		return dirs[i].name < dirs[j].name
+	})
+	return dirs
+}
+
+// allFiles returns every file beneath the directory, in the order they are shown.
+func (n *dirNode) allFiles() []git.File {
+	var res []git.File
+	for _, d := range n.sortedDirs() {
+		res = append(res, d.allFiles()...)
+	}
+	return append(res, n.files...)
+}
+
+// flatten lists the rows of the tree below the directory, directories first. The contents of collapsed directories
+// are left out.
+func (n *dirNode) flatten(depth int, collapsed map[string]struct{}) []entry {
+	var res []entry
+	for _, d := range n.sortedDirs() {
+		name := d.name
+		for len(d.files) == 0 && len(d.dirs) == 1 {
+			d = d.sortedDirs()[0]
+			name += `/` + d.name
+		}
+
+		res = append(res, entry{
+			path:  d.path,
+			name:  name + `/`,
+			depth: depth,
+			dir:   true,
+			files: d.allFiles(),
+		})
+		if _, ok := collapsed[d.path]; !ok {
+			res = append(res, d.flatten(depth+1, collapsed)...)
+		}
+	}
+
+	for _, f := range n.files {
+		res = append(res, entry{
+			path:  f.Path,
+			name:  path.Base(f.Path),
+			depth: depth,
+			files: []git.File{f},
+		})
+	}
+	return res
+}
+
+var fileStatusLetters = map[git.FileStatus]string{
+	git.FileStatusAdded:      `A`,
+	git.FileStatusDeleted:    `D`,
+	git.FileStatusModified:   `M`,
+	git.FileStatusRenamed:    `R`,
+	git.FileStatusCopied:     `C`,
+	git.FileStatusUntracked:  `?`,
+	git.FileStatusTypeChange: `T`,
+	git.FileStatusConflicted: `U`,
+}
+
+// statusOrder is the order the statuses of a directory are summed up in.
+var statusOrder = []git.FileStatus{
+	git.FileStatusAdded,
+	git.FileStatusUntracked,
+	git.FileStatusModified,
+	git.FileStatusRenamed,
+	git.FileStatusCopied,
+	git.FileStatusTypeChange,
+	git.FileStatusDeleted,
+	git.FileStatusConflicted,
+}
+
+// status returns the status of a file, or the status of a directory's files if they all share one. A directory with
+// files in different states is shown as modified.
+func (e entry) status() git.FileStatus {
+	s := e.files[0].Status
+	for _, f := range e.files[1:] {
+		if f.Status != s {
+			return git.FileStatusModified
+		}
+	}
+	return s
+}
+
+var summaryStyle = lipgloss.NewStyle().Foreground(lipgloss.Color(`#888888`))
+
+// summary counts the files beneath a directory by status, like `(3 files: A1 M2)`.
+func (e entry) summary() string {
+	counts := map[git.FileStatus]int{}
+	for _, f := range e.files {
+		counts[f.Status]++
+	}
+
+	var parts []string
+	for _, s := range statusOrder {
+		if counts[s] == 0 {
+			continue
+		}
+		parts = append(parts, fmt.Sprintf(`%s%d`, fileStatusLetters[s], counts[s]))
+	}
+
+	noun := `files`
+	if len(e.files) == 1 {
+		noun = `file`
+	}
+	return summaryStyle.Render(fmt.Sprintf(` (%d %s: %s)`, len(e.files), noun, strings.Join(parts, ` `)))
+}
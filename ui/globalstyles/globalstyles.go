@@ -4,6 +4,12 @@ import "github.com/charmbracelet/lipgloss"
 
 var (
 	SelectedBackground = lipgloss.NewStyle().Background(lipgloss.Color(`#555555`))
+	MarkedBackground   = lipgloss.NewStyle().Background(lipgloss.Color(`#303060`))
+	SearchMatch        = lipgloss.NewStyle().Foreground(lipgloss.Color(`#000000`)).Background(lipgloss.Color(`#DAA520`))
 	AdditionColor      = lipgloss.NewStyle().Foreground(lipgloss.Color(`#00FF00`))
 	RemovalColor       = lipgloss.NewStyle().Foreground(lipgloss.Color(`#FF0000`))
+	AdditionBackground = lipgloss.NewStyle().Background(lipgloss.Color(`#002200`))
+	RemovalBackground  = lipgloss.NewStyle().Background(lipgloss.Color(`#220000`))
+	AdditionEmphasis   = lipgloss.NewStyle().Bold(true).Background(lipgloss.Color(`#005F00`))
+	RemovalEmphasis    = lipgloss.NewStyle().Bold(true).Background(lipgloss.Color(`#5F0000`))
 )
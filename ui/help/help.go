@@ -0,0 +1,72 @@
+package help
+
+import (
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/cszczepaniak/go-istage/keymap"
+)
+
+// UI lists the key bindings of the screen it was opened on.
+type UI struct {
+	title    string
+	bindings []keymap.Binding
+
+	w, h int
+}
+
+func New() *UI {
+	return &UI{}
+}
+
+func (u *UI) Init() tea.Cmd {
+	return nil
+}
+
+func (u *UI) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		u.w = msg.Width
+		u.h = msg.Height
+	}
+	return u, nil
+}
+
+func (u *UI) SetBindings(title string, bindings []keymap.Binding) {
+	u.title = title
+	u.bindings = bindings
+}
+
+var (
+	boxStyle = lipgloss.NewStyle().
+			Border(lipgloss.RoundedBorder()).
+			BorderForeground(lipgloss.Color(`#555555`)).
+			Padding(0, 1)
+	titleStyle = lipgloss.NewStyle().Bold(true)
+	keyStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color(`#00FFFF`))
+)
+
+func (u *UI) View() string {
+	keyWidth := 0
+	for _, b := range u.bindings {
+		if w := lipgloss.Width(keymap.DisplayKey(b.Key)); w > keyWidth {
+			keyWidth = w
+		}
+	}
+
+	sb := &strings.Builder{}
+	sb.WriteString(titleStyle.Render(u.title))
+	sb.WriteString("\n")
+	for _, b := range u.bindings {
+		sb.WriteString("\n")
+		sb.WriteString(keyStyle.Copy().Width(keyWidth + 2).Render(keymap.DisplayKey(b.Key)))
+		sb.WriteString(b.Description)
+	}
+
+	box := boxStyle.Render(sb.String())
+	if u.w == 0 || u.h == 0 {
+		return box
+	}
+	return lipgloss.Place(u.w, u.h, lipgloss.Center, lipgloss.Center, box)
+}
@@ -0,0 +1,166 @@
+package highlight
+
+import (
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/cszczepaniak/go-istage/logging"
+	"github.com/cszczepaniak/go-istage/patch"
+)
+
+const styleName = `monokai`
+
+// Span is a range of bytes in the text of a line along with the style it should be rendered with.
+type Span struct {
+	Start int
+	End   int
+	Style lipgloss.Style
+}
+
+// Highlighter colors the content of diff lines based on the language of the file they belong to. Grammars are
+// bundled with chroma, so no network access is needed; files that chroma doesn't recognize aren't highlighted.
+type Highlighter struct {
+	style  *chroma.Style
+	styles map[chroma.TokenType]lipgloss.Style
+}
+
+func New() *Highlighter {
+	return &Highlighter{
+		style:  styles.Get(styleName),
+		styles: make(map[chroma.TokenType]lipgloss.Style),
+	}
+}
+
+// Document returns the highlighted spans of every context, addition and removal line of the document, keyed by line
+// index. The +/- prefix of each line is never part of a span.
+func (h *Highlighter) Document(doc patch.Document) map[int][]Span {
+	res := map[int][]Span{}
+
+	for _, e := range doc.Entries {
+		path := e.Changes.Path
+		if path == `` {
+			path = e.Changes.OldPath
+		}
+
+		lexer := lexers.Match(path)
+		if lexer == nil {
+			continue
+		}
+		lexer = chroma.Coalesce(lexer)
+
+		for _, hunk := range e.Hunks {
+			// Highlighting each side of the hunk as a whole keeps multi-line constructs such as block comments and
+			// strings mostly intact. Context lines are highlighted as part of the new side.
+			var oldSide, newSide []int
+			for i := hunk.LineStart(); i < hunk.LineEnd(); i++ {
+				switch doc.Lines[i].Kind {
+				case patch.ContextLine:
+					oldSide = append(oldSide, i)
+					newSide = append(newSide, i)
+				case patch.RemovalLine:
+					oldSide = append(oldSide, i)
+				case patch.AdditionLine:
+					newSide = append(newSide, i)
+				}
+			}
+
+			h.highlightLines(lexer, doc, oldSide, res, patch.RemovalLine)
+			h.highlightLines(lexer, doc, newSide, res, patch.AdditionLine, patch.ContextLine)
+		}
+	}
+
+	return res
+}
+
+func (h *Highlighter) highlightLines(
+	lexer chroma.Lexer,
+	doc patch.Document,
+	indices []int,
+	into map[int][]Span,
+	keep ...patch.LineKind,
+) {
+	if len(indices) == 0 {
+		return
+	}
+
+	sb := &strings.Builder{}
+	for _, idx := range indices {
+		sb.WriteString(content(doc.Lines[idx].Text))
+		sb.WriteString("\n")
+	}
+
+	it, err := lexer.Tokenise(nil, sb.String())
+	if err != nil {
+		logging.Warn(`failed to tokenise`, `err`, err)
+		return
+	}
+
+	shouldKeep := func(idx int) bool {
+		for _, k := range keep {
+			if doc.Lines[idx].Kind == k {
+				return true
+			}
+		}
+		return false
+	}
+
+	line := 0
+	// Text offsets start after the +/- prefix.
+	offset := 1
+	for tok := it(); tok != chroma.EOF && line < len(indices); tok = it() {
+		parts := strings.Split(tok.Value, "\n")
+		for i, part := range parts {
+			if i > 0 {
+				line++
+				offset = 1
+				if line >= len(indices) {
+					break
+				}
+			}
+			if part == `` {
+				continue
+			}
+
+			idx := indices[line]
+			if shouldKeep(idx) {
+				into[idx] = append(into[idx], Span{
+					Start: offset,
+					End:   offset + len(part),
+					Style: h.tokenStyle(tok.Type),
+				})
+			}
+			offset += len(part)
+		}
+	}
+}
+
+func (h *Highlighter) tokenStyle(tt chroma.TokenType) lipgloss.Style {
+	if s, ok := h.styles[tt]; ok {
+		return s
+	}
+
+	entry := h.style.Get(tt)
+	s := lipgloss.NewStyle()
+	if entry.Colour.IsSet() {
+		s = s.Foreground(lipgloss.Color(entry.Colour.String()))
+	}
+	if entry.Bold == chroma.Yes {
+		s = s.Bold(true)
+	}
+	if entry.Italic == chroma.Yes {
+		s = s.Italic(true)
+	}
+
+	h.styles[tt] = s
+	return s
+}
+
+func content(text string) string {
+	if len(text) == 0 {
+		return ``
+	}
+	return text[1:]
+}
@@ -0,0 +1,54 @@
+package highlight
+
+import (
+	"testing"
+
+	"github.com/cszczepaniak/go-istage/patch"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDocument(t *testing.T) {
+	doc := patch.ParseDocument([]string{
+		`diff --git a/a.go b/a.go
+index 8baef1b..0c00383 100644
+--- a/a.go
++++ b/a.go
+@@ -1,3 +1,3 @@
+ package a
+-func foo() {}
++func bar() {}
+ // done
+`, `diff --git a/a.unknown b/a.unknown
+index 8baef1b..0c00383 100644
+--- a/a.unknown
++++ b/a.unknown
+@@ -1 +1 @@
+-abc
++def
+`})
+
+	h := New()
+	res := h.Document(doc)
+
+	texts := func(idx int) []string {
+		var res []string
+		for _, sp := range h.Document(doc)[idx] {
+			res = append(res, doc.Lines[idx].Text[sp.Start:sp.End])
+		}
+		return res
+	}
+
+	assert.Equal(t, []string{`package`, ` `, `a`}, texts(5))
+	assert.Equal(t, []string{`func`, ` `, `foo`, `()`, ` `, `{}`}, texts(6))
+	assert.Equal(t, []string{`func`, ` `, `bar`, `()`, ` `, `{}`}, texts(7))
+	assert.Equal(t, []string{`// done`}, texts(8))
+
+	require.NotEmpty(t, res[6])
+	assert.Equal(t, res[6][0].Style, res[7][0].Style, `keywords should be styled the same on both sides`)
+	assert.NotEqual(t, res[6][0].Style, res[6][2].Style, `keywords and names should be styled differently`)
+
+	for i := 9; i < len(doc.Lines); i++ {
+		assert.Empty(t, res[i], `lines of unknown file types should not be highlighted`)
+	}
+}
@@ -0,0 +1,144 @@
+package lines
+
+import (
+	"fmt"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/cszczepaniak/go-istage/patch"
+)
+
+// hunkKey identifies a hunk across refreshes of the document.
+type hunkKey struct {
+	path  string
+	start int
+}
+
+func (u *UI) hunkKey(e patch.Entry, h patch.Hunk) hunkKey {
+	// Staging and unstaging change the index, which moves hunks around on that side of the diff. The other side stays
+	// put: the working tree for unstaged changes and HEAD for staged ones.
+	start := h.NewStart
+	if u.docType == Staged {
+		start = h.OldStart
+	}
+	return hunkKey{
+		path:  entryPath(e),
+		start: start,
+	}
+}
+
+// entryPath returns the path of the file an entry changes, which is its old path if the file was deleted.
+func entryPath(e patch.Entry) string {
+	if e.Changes.Path == `` {
+		return e.Changes.OldPath
+	}
+	return e.Changes.Path
+}
+
+// toggleFoldHunk folds or unfolds the hunk under the cursor. On the header of a file, it folds or unfolds the file.
+func (u *UI) toggleFoldHunk() {
+	idx := u.currentLineIndex()
+	e, ok := u.doc.FindEntry(idx)
+	if !ok {
+		return
+	}
+	h, ok := e.FindHunk(idx)
+	if !ok {
+		u.toggleFoldFile()
+		return
+	}
+
+	key := u.hunkKey(e, h)
+	if _, ok := u.foldedHunks[key]; ok {
+		delete(u.foldedHunks, key)
+	} else {
+		u.foldedHunks[key] = struct{}{}
+	}
+	u.refold(h.LineStart())
+}
+
+func (u *UI) toggleFoldFile() {
+	e, ok := u.doc.FindEntry(u.currentLineIndex())
+	if !ok {
+		return
+	}
+
+	path := entryPath(e)
+	if _, ok := u.foldedFiles[path]; ok {
+		delete(u.foldedFiles, path)
+	} else {
+		u.foldedFiles[path] = struct{}{}
+	}
+	u.refold(e.LineStart())
+}
+
+// refold rebuilds the rows after the folds changed and puts the cursor on the header of what was folded or unfolded.
+func (u *UI) refold(header int) {
+	u.setRows()
+	u.side = leftSide
+	u.jumpToLine(header)
+}
+
+// computeFolds maps the first line of every folded file and hunk in the document to the end of the lines it hides.
+func (u *UI) computeFolds() map[int]int {
+	folds := map[int]int{}
+	for _, e := range u.doc.Entries {
+		if _, ok := u.foldedFiles[entryPath(e)]; ok {
+			folds[e.LineStart()] = e.LineEnd()
+			continue
+		}
+
+		for _, h := range e.Hunks {
+			if _, ok := u.foldedHunks[u.hunkKey(e, h)]; ok {
+				folds[h.LineStart()] = h.LineEnd()
+			}
+		}
+	}
+	return folds
+}
+
+// foldRows drops the rows hidden by the folds, keeping the header row of each fold.
+func foldRows(rows []row, folds map[int]int) []row {
+	if len(folds) == 0 {
+		return rows
+	}
+
+	res := make([]row, 0, len(rows))
+	hiddenUntil := -1
+	for _, r := range rows {
+		l := r.left
+		if l < 0 {
+			l = r.right
+		}
+		if l < hiddenUntil {
+			continue
+		}
+
+		res = append(res, r)
+		if end, ok := folds[l]; ok && r.isShared() {
+			hiddenUntil = end
+		}
+	}
+	return res
+}
+
+var foldSummaryStyle = lipgloss.NewStyle().Foreground(lipgloss.Color(`#888888`))
+
+// foldSummary describes the changes hidden behind the line if it's the header of a fold, and returns nothing otherwise.
+func (u *UI) foldSummary(index int) string {
+	end, ok := u.folds[index]
+	if !ok {
+		return ``
+	}
+
+	var additions, removals int
+	for _, l := range u.doc.Lines[index:end] {
+		switch l.Kind {
+		case patch.AdditionLine:
+			additions++
+		case patch.RemovalLine:
+			removals++
+		}
+	}
+
+	return foldSummaryStyle.Render(fmt.Sprintf(` ⋯ +%d -%d`, additions, removals))
+}
@@ -1,6 +1,7 @@
 package lines
 
 import (
+	"sort"
 	"strings"
 
 	tea "github.com/charmbracelet/bubbletea"
@@ -8,7 +9,10 @@ import (
 	"github.com/cszczepaniak/go-istage/logging"
 	"github.com/cszczepaniak/go-istage/patch"
 	"github.com/cszczepaniak/go-istage/ui/globalstyles"
+	"github.com/cszczepaniak/go-istage/ui/highlight"
+	"github.com/cszczepaniak/go-istage/ui/search"
 	"github.com/cszczepaniak/go-istage/window"
+	"github.com/muesli/reflow/truncate"
 )
 
 type DocType int
@@ -27,28 +31,115 @@ type UI struct {
 	docType   DocType
 	docGetter docGetter
 
+	// unfiltered is the document as it was loaded, and filter holds the paths the view is limited to. The view shows
+	// every file when filter is empty.
+	unfiltered patch.Document
+	filter     map[string]struct{}
+
+	intraline   map[int][]patch.Span
+	highlighter *highlight.Highlighter
+	syntax      map[int][]highlight.Span
+
 	keyCfg Config
 
-	window *window.Window[patch.Line]
+	// marked holds the lines toggled into the selection one by one, and anchor is the line visual mode was started on,
+	// or -1 when not in visual mode. Both are document line indices.
+	marked lineSet
+	anchor int
+
+	// reloadPosition is where the cursor was when a reload was asked for, to put it back once the document arrives.
+	reloadPosition *position
+
+	// searchOrigin is the row the cursor was on when the search started, to go back to if it's cancelled.
+	search       search.Search
+	searchOrigin int
+
+	// foldedFiles and foldedHunks outlive the document, so that folds stay put when it's refreshed. folds holds the
+	// folds of the current document, from computeFolds.
+	foldedFiles map[string]struct{}
+	foldedHunks map[hunkKey]struct{}
+	folds       map[int]int
+
+	rows   []row
+	split  bool
+	side   side
+	window *window.Window[row]
 	cursor int
-	h      int
+	h, w   int
 }
 
+type side int
+
+const (
+	leftSide side = iota
+	rightSide
+)
+
 type Config struct {
+	QuitKey     string
+	UpKey       string
+	DownKey     string
+	PrevHunkKey string
+	NextHunkKey string
+
 	HandleLineKey string
 	HandleHunkKey string
 
 	CanReset     bool
 	ResetLineKey string
 	ResetHunkKey string
+
+	ToggleSplitKey string
+	SwitchSideKey  string
+
+	FoldHunkKey string
+	FoldFileKey string
+
+	VisualModeKey     string
+	ToggleMarkKey     string
+	ClearSelectionKey string
+
+	SearchForwardKey  string
+	SearchBackwardKey string
+	NextMatchKey      string
+	PrevMatchKey      string
+}
+
+// withDefaults fills in the keys for quitting and navigating, which every lines view needs.
+func (c Config) withDefaults() Config {
+	if c.QuitKey == `` {
+		c.QuitKey = `q`
+	}
+	if c.UpKey == `` {
+		c.UpKey = `up`
+	}
+	if c.DownKey == `` {
+		c.DownKey = `down`
+	}
+	if c.PrevHunkKey == `` {
+		c.PrevHunkKey = `left`
+	}
+	if c.NextHunkKey == `` {
+		c.NextHunkKey = `right`
+	}
+	if c.ClearSelectionKey == `` {
+		c.ClearSelectionKey = `esc`
+	}
+	return c
 }
 
 func New(dt DocType, dg docGetter, keyCfg Config, windowSize int) *UI {
 	return &UI{
-		docType:   dt,
-		docGetter: dg,
-		keyCfg:    keyCfg,
-		h:         windowSize,
+		docType:     dt,
+		docGetter:   dg,
+		keyCfg:      keyCfg.withDefaults(),
+		highlighter: highlight.New(),
+		marked:      lineSet{},
+		anchor:      -1,
+		search:      search.New(),
+		foldedFiles: map[string]struct{}{},
+		foldedHunks: map[hunkKey]struct{}{},
+		h:           windowSize,
 	}
 }
 
@@ -63,38 +154,85 @@ func (u *UI) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		// height when setting the window.
 
 		u.h = msg.Height - 1
+		u.w = msg.Width
 		u.resize(u.h)
 	case tea.KeyMsg:
+		if u.search.Typing() {
+			return u, u.updateSearch(msg)
+		}
+
 		switch msg.String() {
-		case "q":
+		case u.keyCfg.QuitKey:
 			return u, tea.Quit
-		case "up":
+		case u.keyCfg.SearchForwardKey:
+			return u, u.startSearch(false)
+		case u.keyCfg.SearchBackwardKey:
+			return u, u.startSearch(true)
+		case u.keyCfg.NextMatchKey:
+			u.nextMatch(false)
+		case u.keyCfg.PrevMatchKey:
+			u.nextMatch(true)
+		case u.keyCfg.UpKey:
 			u.navigate(navigateUp)
-		case "down":
+		case u.keyCfg.DownKey:
 			u.navigate(navigateDown)
-		case "left":
+		case u.keyCfg.PrevHunkKey:
 			u.navigate(navigateLeft)
-		case "right":
+		case u.keyCfg.NextHunkKey:
 			u.navigate(navigateRight)
+		case u.keyCfg.ClearSelectionKey:
+			u.clearSelection()
+		case u.keyCfg.VisualModeKey:
+			u.toggleVisualMode()
+		case u.keyCfg.ToggleMarkKey:
+			u.toggleMark()
 		case u.keyCfg.HandleLineKey:
+			if lines := u.takeSelection(); len(lines) > 0 {
+				return u, u.patchLines(lines)
+			}
 			return u, u.handleLine
 		case u.keyCfg.HandleHunkKey:
 			return u, u.handleHunk
 		case u.keyCfg.ResetLineKey:
 			if u.keyCfg.CanReset {
+				if lines := u.takeSelection(); len(lines) > 0 {
+					return u, u.resetLines(lines)
+				}
 				return u, u.handleResetLine
 			}
 		case u.keyCfg.ResetHunkKey:
 			if u.keyCfg.CanReset {
 				return u, u.handleResetHunk
 			}
+		case u.keyCfg.ToggleSplitKey:
+			u.toggleSplit()
+		case u.keyCfg.SwitchSideKey:
+			if u.split {
+				u.side = 1 - u.side
+			}
+		case u.keyCfg.FoldHunkKey:
+			u.toggleFoldHunk()
+		case u.keyCfg.FoldFileKey:
+			u.toggleFoldFile()
 		}
 	case RefreshMsg:
 		return u, u.UpdateDoc
+	case ReloadMsg:
+		if pos, ok := u.cursorPosition(); ok {
+			u.reloadPosition = &pos
+		}
+		return u, u.UpdateDoc
 	case docMsg:
+		if msg.docType != u.docType {
+			break
+		}
 		logging.Info(`received docMsg`, `docType`, u.docType)
-		u.doc = msg.d
-		u.setDoc(msg.d)
+		u.unfiltered = msg.d
+		u.setDoc(u.filtered(msg.d))
+		if u.reloadPosition != nil {
+			u.restorePosition(*u.reloadPosition)
+			u.reloadPosition = nil
+		}
 	case error:
 		logging.Error(msg.Error())
 	}
@@ -106,20 +244,84 @@ func (u *UI) resize(size int) {
 	if u.window != nil {
 		u.window.Resize(size)
 	} else {
-		u.window = window.NewWindow(u.doc.Lines, u.h)
+		u.window = window.NewWindow(u.rows, u.h)
 	}
 }
 
 func (u *UI) setDoc(doc patch.Document) {
+	// The line indices of the selection don't mean anything in the new document.
+	u.clearSelection()
+
 	u.doc = doc
+	u.intraline = doc.IntralineChanges()
+	u.syntax = u.highlighter.Document(doc)
+	u.setRows()
+}
+
+// SetFilter limits the view to the files with the given paths. No paths removes the filter.
+func (u *UI) SetFilter(paths []string) {
+	u.filter = make(map[string]struct{}, len(paths))
+	for _, p := range paths {
+		u.filter[p] = struct{}{}
+	}
+	u.setDoc(u.filtered(u.unfiltered))
+
+	// Wherever the cursor was probably isn't there anymore.
+	u.cursor = 0
+	u.window.JumpTo(0)
+}
+
+func (u *UI) filtered(doc patch.Document) patch.Document {
+	if len(u.filter) == 0 {
+		return doc
+	}
+
+	return doc.Filter(func(e patch.Entry) bool {
+		_, ok := u.filter[e.Changes.Path]
+		if !ok {
+			// Renamed files can be picked by either name.
+			_, ok = u.filter[e.Changes.OldPath]
+		}
+		return ok
+	})
+}
+
+func (u *UI) setRows() {
+	if u.split {
+		u.rows = splitRows(u.doc)
+	} else {
+		u.rows = unifiedRows(u.doc)
+	}
+	u.folds = u.computeFolds()
+	u.rows = foldRows(u.rows, u.folds)
+
 	if u.window == nil {
-		u.window = window.NewWindow(doc.Lines, u.h)
+		u.window = window.NewWindow(u.rows, u.h)
 	} else {
-		u.window.SetData(doc.Lines)
+		u.window.SetData(u.rows)
 		u.window.Resize(u.h)
 	}
 }
 
+// toggleSplit switches between the unified and the side-by-side layout, keeping the cursor on the same line of the
+// document.
+func (u *UI) toggleSplit() {
+	current := u.currentLineIndex()
+
+	u.split = !u.split
+	u.setRows()
+
+	if current < 0 {
+		return
+	}
+
+	u.side = leftSide
+	if u.split && u.doc.Lines[current].Kind == patch.AdditionLine {
+		u.side = rightSide
+	}
+	u.jumpToLine(current)
+}
+
 func (u *UI) UpdateDoc() tea.Msg {
 	var doc patch.Document
 	var err error
@@ -129,7 +331,10 @@ func (u *UI) UpdateDoc() tea.Msg {
 		return err
 	}
 
-	return docMsg{d: doc}
+	return docMsg{
+		d:       doc,
+		docType: u.docType,
+	}
 }
 
 var kindToColor = map[patch.LineKind]lipgloss.Style{
@@ -139,6 +344,18 @@ var kindToColor = map[patch.LineKind]lipgloss.Style{
 	patch.HunkLine:     lipgloss.NewStyle().Foreground(lipgloss.Color(`#00FFFF`)),
 }
 
+// When a line is syntax highlighted its text is no longer colored by its kind, so additions and removals get a tinted
+// background instead.
+var kindToBackground = map[patch.LineKind]lipgloss.Style{
+	patch.AdditionLine: globalstyles.AdditionBackground,
+	patch.RemovalLine:  globalstyles.RemovalBackground,
+}
+
+var kindToEmphasis = map[patch.LineKind]lipgloss.Style{
+	patch.AdditionLine: globalstyles.AdditionEmphasis,
+	patch.RemovalLine:  globalstyles.RemovalEmphasis,
+}
+
 func (dv *UI) View() string {
 	if dv == nil || dv.window == nil {
 		return ``
@@ -146,21 +363,146 @@ func (dv *UI) View() string {
 
 	sb := &strings.Builder{}
 
-	viewableLines := dv.window.CurrentValues()
+	viewableRows := dv.window.CurrentValues()
+	marked := newLineSet(dv.selectedLines()...)
 
-	for i, l := range viewableLines.Values {
-		s := lipgloss.NewStyle()
-		c, ok := kindToColor[l.Kind]
-		if ok {
-			s = s.Inherit(c)
+	for i, r := range viewableRows.Values {
+		selected := dv.cursor == i
+		if dv.isFullWidth(r) {
+			sb.WriteString(dv.renderLine(r.left, selected, marked.contains(r.left)))
+			sb.WriteString(dv.doc.Lines[r.left].LineBreak)
+			continue
 		}
-		if dv.cursor == i {
-			s = s.Inherit(globalstyles.SelectedBackground)
+
+		sb.WriteString(dv.renderSplitRow(r, selected, marked))
+		sb.WriteString("\n")
+	}
+
+	if dv.search.Typing() {
+		sb.WriteString(dv.search.View())
+	}
+	return sb.String()
+}
+
+// isFullWidth returns whether the row spans the whole width of the view. That's every row in the unified layout, and
+// the header and hunk lines in the split layout.
+func (dv *UI) isFullWidth(r row) bool {
+	if !dv.split {
+		return true
+	}
+	if !r.isShared() {
+		return false
+	}
+
+	switch dv.doc.Lines[r.left].Kind {
+	case patch.DiffLine, patch.HeaderLine, patch.HunkLine:
+		return true
+	}
+	return false
+}
+
+var splitSeparator = lipgloss.NewStyle().Foreground(lipgloss.Color(`#555555`)).Render(`│`)
+
+// renderSplitRow renders a row of the side-by-side layout, with each side cut or padded to half of the width.
+func (dv *UI) renderSplitRow(r row, selected bool, marked lineSet) string {
+	width := (dv.w - lipgloss.Width(splitSeparator)) / 2
+
+	renderSide := func(index int, s side) string {
+		var res string
+		if index >= 0 {
+			res = dv.renderLine(index, selected && dv.side == s, marked.contains(index))
+			// Tabs would throw the columns out of alignment.
+			res = strings.ReplaceAll(res, "\t", `    `)
+		}
+
+		res = truncate.String(res, uint(width))
+		if pad := width - lipgloss.Width(res); pad > 0 {
+			res += strings.Repeat(` `, pad)
+		}
+		return res
+	}
+
+	return renderSide(r.left, leftSide) + splitSeparator + renderSide(r.right, rightSide)
+}
+
+func (dv *UI) renderLine(index int, selected, marked bool) string {
+	l := dv.doc.Lines[index]
+
+	s := lipgloss.NewStyle()
+	c, ok := kindToColor[l.Kind]
+	if ok {
+		s = s.Inherit(c)
+	}
+	if selected {
+		s = s.Inherit(globalstyles.SelectedBackground)
+	} else if marked {
+		s = s.Inherit(globalstyles.MarkedBackground)
+	}
+
+	return dv.renderText(index, l, s) + dv.foldSummary(index)
+}
+
+// renderText renders the text of a line with syntax highlighting, emphasizing the parts that changed compared to the
+// line it was paired with.
+func (dv *UI) renderText(index int, l patch.Line, s lipgloss.Style) string {
+	syntax := dv.syntax[index]
+	changed := dv.intraline[index]
+	found := dv.search.Matches(l.Text)
+	if len(syntax) == 0 && len(changed) == 0 && len(found) == 0 {
+		return s.Render(l.Text)
+	}
+
+	if len(syntax) > 0 {
+		if bg, ok := kindToBackground[l.Kind]; ok {
+			s = s.Copy().Inherit(bg)
+		}
+	}
+
+	cuts := []int{0, len(l.Text)}
+	for _, sp := range syntax {
+		cuts = append(cuts, sp.Start, sp.End)
+	}
+	for _, sp := range changed {
+		cuts = append(cuts, sp.Start, sp.End)
+	}
+	for _, sp := range found {
+		cuts = append(cuts, sp.Start, sp.End)
+	}
+	sort.Ints(cuts)
+
+	sb := &strings.Builder{}
+	for i := 1; i < len(cuts); i++ {
+		start, end := cuts[i-1], cuts[i]
+		if start == end {
+			continue
 		}
 
-		sb.WriteString(s.Render(l.Text))
-		sb.WriteString(l.LineBreak)
+		// Styles set earlier take precedence: search matches win over everything else, then the emphasis of changed
+		// words, and syntax colors win over the colors of the line's kind.
+		segStyle := lipgloss.NewStyle()
+		for _, sp := range found {
+			if sp.Start <= start && end <= sp.End {
+				segStyle = segStyle.Inherit(globalstyles.SearchMatch)
+				break
+			}
+		}
+		for _, sp := range changed {
+			if sp.Start <= start && end <= sp.End {
+				segStyle = segStyle.Inherit(kindToEmphasis[l.Kind])
+				break
+			}
+		}
+		for _, sp := range syntax {
+			if sp.Start <= start && end <= sp.End {
+				segStyle = segStyle.Inherit(sp.Style)
+				break
+			}
+		}
+		segStyle = segStyle.Inherit(s)
+
+		sb.WriteString(segStyle.Render(l.Text[start:end]))
 	}
+
 	return sb.String()
 }
 
@@ -205,31 +547,43 @@ func (dv *UI) cursorLeft() {
 	}
 
 	for i := start - 1; i >= 0; i-- {
-		l := dv.doc.Lines[i]
-		if l.Kind == patch.HunkLine {
-			dv.jumpToLine(i)
+		if dv.isHunkRow(i) {
+			dv.jumpToRow(i)
 			return
 		}
 	}
-	dv.jumpToLine(0)
+	dv.jumpToRow(0)
 }
 
 func (dv *UI) cursorRight() {
 	start := dv.window.AbsoluteIndex(dv.cursor)
-	if start >= len(dv.doc.Lines)-1 {
+	if start >= len(dv.rows)-1 {
 		return
 	}
-	for i := start + 1; i < len(dv.doc.Lines); i++ {
-		l := dv.doc.Lines[i]
-		if l.Kind == patch.HunkLine {
-			dv.jumpToLine(i)
+	for i := start + 1; i < len(dv.rows); i++ {
+		if dv.isHunkRow(i) {
+			dv.jumpToRow(i)
 			return
 		}
 	}
-	dv.jumpToLine(len(dv.doc.Lines) - 1)
+	dv.jumpToRow(len(dv.rows) - 1)
+}
+
+func (dv *UI) isHunkRow(rowIndex int) bool {
+	r := dv.rows[rowIndex]
+	return r.isShared() && dv.doc.Lines[r.left].Kind == patch.HunkLine
 }
 
 func (dv *UI) jumpToLine(index int) {
+	for i, r := range dv.rows {
+		if r.contains(index) {
+			dv.jumpToRow(i)
+			return
+		}
+	}
+}
+
+func (dv *UI) jumpToRow(index int) {
 	relIndex := dv.window.RelativeIndex(index)
 	if relIndex < 0 {
 		dv.window.JumpTo(index)
@@ -238,12 +592,18 @@ func (dv *UI) jumpToLine(index int) {
 	dv.cursor = relIndex
 }
 
-func (dv *UI) currentLine() patch.Line {
-	return dv.doc.Lines[dv.currentLineIndex()]
-}
-
+// currentLineIndex returns the index of the document line under the cursor, or -1 if the document is empty. In the
+// split layout that is the line on the selected side, or the line on the other side if the selected side is empty.
 func (dv *UI) currentLineIndex() int {
-	return dv.window.AbsoluteIndex(dv.cursor)
+	if dv.window == nil || len(dv.rows) == 0 {
+		return -1
+	}
+
+	r := dv.rows[dv.window.AbsoluteIndex(dv.cursor)]
+	if dv.side == rightSide && r.right >= 0 || r.left < 0 {
+		return r.right
+	}
+	return r.left
 }
 
 func (dv *UI) linesInCurrentHunk() []int {
@@ -275,7 +635,8 @@ func findHunk(doc patch.Document, idx int) (patch.Hunk, bool) {
 }
 
 func (u *UI) handleLine() tea.Msg {
-	if ln := u.currentLine(); !ln.Kind.IsAdditionOrRemoval() {
+	idx := u.currentLineIndex()
+	if idx < 0 || !u.doc.Lines[idx].Kind.IsAdditionOrRemoval() {
 		return nil
 	}
 
@@ -311,7 +672,36 @@ func (u *UI) handleHunk() tea.Msg {
 	return msg
 }
 
+func (u *UI) patchLines(lines []int) tea.Cmd {
+	doc := u.doc
+	return func() tea.Msg {
+		msg := PatchMsg{
+			Doc:   doc,
+			Lines: lines,
+		}
+		msg.Direction = patch.Stage
+		if u.docType == Staged {
+			msg.Direction = patch.Unstage
+		}
+		return msg
+	}
+}
+
+func (u *UI) resetLines(lines []int) tea.Cmd {
+	doc := u.doc
+	return func() tea.Msg {
+		return ResetMsg{
+			Doc:   doc,
+			Lines: lines,
+		}
+	}
+}
+
 func (u *UI) handleResetLine() tea.Msg {
+	if u.currentLineIndex() < 0 {
+		return nil
+	}
+
 	return ResetMsg{
 		Doc:   u.doc,
 		Lines: []int{u.currentLineIndex()},
@@ -345,3 +345,394 @@ index 0000000..1fa3451
 
 	assert.EqualValues(t, doc2, lv.doc)
 }
+
+func TestSplitLayout(t *testing.T) {
+	err := logging.Init(logging.Config{})
+	require.NoError(t, err)
+
+	doc := patch.ParseDocument([]string{
+		`diff --git a/a.txt b/a.txt
+index 8baef1b..0c00383 100644
+--- a/a.txt
++++ b/a.txt
+@@ -1,4 +1,3 @@
+ a
+-b
+-c
++d
+ e
+`})
+
+	lv := New(Unstaged, testDocGetter(doc), Config{
+		HandleLineKey:  `s`,
+		ToggleSplitKey: `|`,
+		SwitchSideKey:  `tab`,
+	}, 40)
+	lv = testutils.InitializeModel(t, lv)
+
+	for i := 0; i < 6; i++ {
+		lv = testutils.ExecKeyPressCycle(lv, `down`)
+	}
+	assert.Equal(t, 6, lv.currentLineIndex())
+
+	lv = testutils.ExecKeyPressCycle(lv, `|`)
+	assert.True(t, lv.split)
+	assert.Equal(t, []row{
+		{left: 0, right: 0},
+		{left: 1, right: 1},
+		{left: 2, right: 2},
+		{left: 3, right: 3},
+		{left: 4, right: 4},
+		{left: 5, right: 5},
+		{left: 6, right: 8},
+		{left: 7, right: -1},
+		{left: 9, right: 9},
+	}, lv.rows)
+	assert.Equal(t, 6, lv.cursor)
+
+	lv, msg := testutils.ExecKeyPress(lv, `s`)
+	assert.Equal(t, PatchMsg{
+		Direction: patch.Stage,
+		Doc:       doc,
+		Lines:     []int{6},
+	}, msg)
+
+	lv = testutils.ExecKeyPressCycle(lv, `tab`)
+	lv, msg = testutils.ExecKeyPress(lv, `s`)
+	assert.Equal(t, PatchMsg{
+		Direction: patch.Stage,
+		Doc:       doc,
+		Lines:     []int{8},
+	}, msg)
+
+	// The right side of this row is empty, so the removal on the left is used.
+	lv = testutils.ExecKeyPressCycle(lv, `down`)
+	lv, msg = testutils.ExecKeyPress(lv, `s`)
+	assert.Equal(t, PatchMsg{
+		Direction: patch.Stage,
+		Doc:       doc,
+		Lines:     []int{7},
+	}, msg)
+
+	// Going back to the unified layout keeps the cursor on the same line.
+	lv = testutils.ExecKeyPressCycle(lv, `|`)
+	assert.False(t, lv.split)
+	assert.Equal(t, 7, lv.currentLineIndex())
+	assert.Equal(t, 7, lv.cursor)
+
+	assert.NotEmpty(t, lv.View())
+}
+
+func TestSelection(t *testing.T) {
+	err := logging.Init(logging.Config{})
+	require.NoError(t, err)
+
+	doc := patch.ParseDocument([]string{
+		`diff --git a/a.txt b/a.txt
+index 8baef1b..0c00383 100644
+--- a/a.txt
++++ b/a.txt
+@@ -1,3 +1,3 @@
+ a
+-b
++B
+ c
+@@ -10,3 +10,3 @@
+ j
+-k
++K
+ l
+`,
+		`diff --git a/b.txt b/b.txt
+index 8baef1b..0c00383 100644
+--- a/b.txt
++++ b/b.txt
+@@ -1,2 +1,2 @@
+ x
+-y
++Y
+`})
+
+	lv := New(Unstaged, testDocGetter(doc), Config{
+		HandleLineKey: `s`,
+		VisualModeKey: `v`,
+		ToggleMarkKey: ` `,
+	}, 40)
+	lv = testutils.InitializeModel(t, lv)
+
+	// Select from the addition in the first hunk to the removal in the second one.
+	for i := 0; i < 7; i++ {
+		lv = testutils.ExecKeyPressCycle(lv, `down`)
+	}
+	lv = testutils.ExecKeyPressCycle(lv, `v`)
+	for i := 0; i < 4; i++ {
+		lv = testutils.ExecKeyPressCycle(lv, `down`)
+	}
+	assert.Equal(t, []int{7, 11}, lv.selectedLines())
+
+	lv = testutils.ExecKeyPressCycle(lv, `v`)
+	assert.Equal(t, []int{7, 11}, lv.selectedLines())
+
+	// Then mark a line in the other file, and mark and unmark one that shouldn't end up in the patch.
+	lv = testutils.ExecKeyPressCycle(lv, `down`)
+	lv = testutils.ExecKeyPressCycle(lv, ` `)
+	lv = testutils.ExecKeyPressCycle(lv, ` `)
+	for i := 0; i < 9; i++ {
+		lv = testutils.ExecKeyPressCycle(lv, `down`)
+	}
+	lv = testutils.ExecKeyPressCycle(lv, ` `)
+
+	lv, msg := testutils.ExecKeyPress(lv, `s`)
+	assert.Equal(t, PatchMsg{
+		Direction: patch.Stage,
+		Doc:       patch.Document(doc),
+		Lines:     []int{7, 11, 21},
+	}, msg)
+	assert.Empty(t, lv.selectedLines())
+
+	// Without a selection the line under the cursor is staged.
+	_, msg = testutils.ExecKeyPress(lv, `s`)
+	assert.Equal(t, PatchMsg{
+		Direction: patch.Stage,
+		Doc:       patch.Document(doc),
+		Lines:     []int{21},
+	}, msg)
+}
+
+func TestSearch(t *testing.T) {
+	err := logging.Init(logging.Config{})
+	require.NoError(t, err)
+
+	doc := patch.ParseDocument([]string{
+		`diff --git a/a.go b/a.go
+index 8baef1b..0c00383 100644
+--- a/a.go
++++ b/a.go
+@@ -1,4 +1,4 @@
+ package a
+-func foo() int {
++func bar() int {
+ 	return 1
+ }
+`})
+
+	lv := New(Unstaged, testDocGetter(doc), Config{
+		ToggleSplitKey:    `|`,
+		SearchForwardKey:  `/`,
+		SearchBackwardKey: `?`,
+		NextMatchKey:      `n`,
+		PrevMatchKey:      `N`,
+	}, 40)
+	lv = testutils.InitializeModel(t, lv)
+
+	lv = testutils.ExecKeyPressCycle(lv, `/`)
+	assert.True(t, lv.CapturesInput())
+	for _, k := range []string{`f`, `u`, `n`, `c`} {
+		lv = testutils.ExecKeyPressCycle(lv, k)
+	}
+	assert.Equal(t, 6, lv.currentLineIndex())
+	lv = testutils.ExecKeyPressCycle(lv, `enter`)
+	assert.False(t, lv.CapturesInput())
+
+	for _, exp := range []int{7, 6, 7} {
+		lv = testutils.ExecKeyPressCycle(lv, `n`)
+		assert.Equal(t, exp, lv.currentLineIndex())
+	}
+	lv = testutils.ExecKeyPressCycle(lv, `N`)
+	assert.Equal(t, 6, lv.currentLineIndex())
+
+	// In the split layout, matches on the right move the cursor to the right.
+	lv = testutils.ExecKeyPressCycle(lv, `|`)
+	lv = testutils.ExecKeyPressCycle(lv, `?`)
+	for _, k := range []string{`b`, `a`, `r`} {
+		lv = testutils.ExecKeyPressCycle(lv, k)
+	}
+	lv = testutils.ExecKeyPressCycle(lv, `enter`)
+	assert.Equal(t, 7, lv.currentLineIndex())
+	assert.Equal(t, rightSide, lv.side)
+}
+
+func TestFolding(t *testing.T) {
+	err := logging.Init(logging.Config{})
+	require.NoError(t, err)
+
+	doc := patch.ParseDocument([]string{
+		`diff --git a/a.txt b/a.txt
+index 8baef1b..0c00383 100644
+--- a/a.txt
++++ b/a.txt
+@@ -1,3 +1,3 @@
+ a
+-b
++B
+ c
+@@ -10,3 +10,3 @@
+ j
+-k
++K
+ l
+`,
+		`diff --git a/b.txt b/b.txt
+index 8baef1b..0c00383 100644
+--- a/b.txt
++++ b/b.txt
+@@ -1,2 +1,2 @@
+ x
+-y
++Y
+`})
+
+	lv := New(Unstaged, testDocGetter(doc), Config{
+		FoldHunkKey: `z`,
+		FoldFileKey: `Z`,
+	}, 40)
+	lv = testutils.InitializeModel(t, lv)
+	require.Len(t, lv.rows, 22)
+
+	// Folding a hunk leaves its header, with a summary of what's hidden.
+	for i := 0; i < 5; i++ {
+		lv = testutils.ExecKeyPressCycle(lv, `down`)
+	}
+	lv = testutils.ExecKeyPressCycle(lv, `z`)
+	assert.Len(t, lv.rows, 18)
+	assert.Equal(t, 4, lv.currentLineIndex())
+	assert.Contains(t, lv.foldSummary(4), `+1 -1`)
+
+	lv = testutils.ExecKeyPressCycle(lv, `down`)
+	assert.Equal(t, 9, lv.currentLineIndex())
+
+	// Folding the file hides the other hunk too.
+	lv = testutils.ExecKeyPressCycle(lv, `Z`)
+	assert.Len(t, lv.rows, 9)
+	assert.Equal(t, 0, lv.currentLineIndex())
+	assert.Contains(t, lv.foldSummary(0), `+2 -2`)
+
+	// Folds survive a refresh.
+	lv = testutils.RunUpdateCycle[*UI](lv.Update(RefreshMsg{}))
+	assert.Len(t, lv.rows, 9)
+
+	// Unfolding the file brings back the hunk as it was.
+	lv = testutils.ExecKeyPressCycle(lv, `Z`)
+	assert.Len(t, lv.rows, 18)
+
+	lv = testutils.ExecKeyPressCycle(lv, `down`)
+	lv = testutils.ExecKeyPressCycle(lv, `down`)
+	lv = testutils.ExecKeyPressCycle(lv, `down`)
+	lv = testutils.ExecKeyPressCycle(lv, `down`)
+	lv = testutils.ExecKeyPressCycle(lv, `z`)
+	assert.Len(t, lv.rows, 22)
+}
+
+func TestSelectionAcrossFolds(t *testing.T) {
+	err := logging.Init(logging.Config{})
+	require.NoError(t, err)
+
+	doc := patch.ParseDocument([]string{
+		`diff --git a/a.txt b/a.txt
+index 8baef1b..0c00383 100644
+--- a/a.txt
++++ b/a.txt
+@@ -1,3 +1,3 @@
+ a
+-b
++B
+ c
+@@ -10,3 +10,3 @@
+ j
+-k
++K
+ l
+`,
+		`diff --git a/b.txt b/b.txt
+index 8baef1b..0c00383 100644
+--- a/b.txt
++++ b/b.txt
+@@ -1,2 +1,2 @@
+ x
+-y
++Y
+`})
+
+	lv := New(Unstaged, testDocGetter(doc), Config{
+		VisualModeKey: `v`,
+		FoldHunkKey:   `z`,
+		FoldFileKey:   `Z`,
+	}, 40)
+	lv = testutils.InitializeModel(t, lv)
+
+	// Fold the second hunk, then select from the first one past it: the folded changes are part of the range.
+	for i := 0; i < 9; i++ {
+		lv = testutils.ExecKeyPressCycle(lv, `down`)
+	}
+	lv = testutils.ExecKeyPressCycle(lv, `z`)
+	lv = testutils.ExecKeyPressCycle(lv, `up`)
+	lv = testutils.ExecKeyPressCycle(lv, `up`)
+	require.Equal(t, 7, lv.currentLineIndex())
+	lv = testutils.ExecKeyPressCycle(lv, `v`)
+	for i := 0; i < 3; i++ {
+		lv = testutils.ExecKeyPressCycle(lv, `down`)
+	}
+	require.Equal(t, 14, lv.currentLineIndex())
+	assert.Equal(t, []int{7, 11, 12}, lv.selectedLines())
+
+	// Folding the file with the anchor in it keeps the whole file in the range, rather than only the cursor's row.
+	lv = testutils.ExecKeyPressCycle(lv, `up`)
+	lv = testutils.ExecKeyPressCycle(lv, `Z`)
+	require.Equal(t, 0, lv.currentLineIndex())
+	assert.Equal(t, []int{6, 7, 11, 12}, lv.selectedLines())
+
+	for i := 0; i < 7; i++ {
+		lv = testutils.ExecKeyPressCycle(lv, `down`)
+	}
+	require.Equal(t, 20, lv.currentLineIndex())
+	assert.Equal(t, []int{6, 7, 11, 12, 20}, lv.selectedLines())
+}
+
+func TestReloadKeepsPosition(t *testing.T) {
+	err := logging.Init(logging.Config{})
+	require.NoError(t, err)
+
+	doc := patch.ParseDocument([]string{
+		`diff --git a/a.txt b/a.txt
+index 8baef1b..0c00383 100644
+--- a/a.txt
++++ b/a.txt
+@@ -4,3 +4,3 @@
+ d
+-e
++E
+ f
+`})
+
+	fullDoc := patch.ParseDocument([]string{
+		`diff --git a/a.txt b/a.txt
+index 8baef1b..0c00383 100644
+--- a/a.txt
++++ b/a.txt
+@@ -1,7 +1,7 @@
+ a
+ b
+ c
+ d
+-e
++E
+ f
+ g
+`})
+
+	lv := New(Unstaged, testDocGetter(doc), Config{}, 40)
+	lv = testutils.InitializeModel(t, lv)
+
+	for i := 0; i < 7; i++ {
+		lv = testutils.ExecKeyPressCycle(lv, `down`)
+	}
+	require.Equal(t, `+E`, lv.doc.Lines[lv.currentLineIndex()].Text)
+
+	lv.docGetter = testDocGetter(fullDoc)
+	lv = testutils.RunUpdateCycle[*UI](lv.Update(ReloadMsg{}))
+	assert.Equal(t, 10, lv.currentLineIndex())
+
+	lv.docGetter = testDocGetter(doc)
+	lv = testutils.RunUpdateCycle[*UI](lv.Update(ReloadMsg{}))
+	assert.Equal(t, 7, lv.currentLineIndex())
+}
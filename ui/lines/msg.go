@@ -4,8 +4,15 @@ import "github.com/cszczepaniak/go-istage/patch"
 
 type RefreshMsg struct{}
 
+// ReloadMsg reloads the document after the way it is computed changed, keeping the cursor on the same line of the same
+// file.
+type ReloadMsg struct{}
+
+// docMsg carries a freshly loaded document. Messages go to whichever view is showing, so it says which kind of
+// document it is for.
 type docMsg struct {
-	d patch.Document
+	d       patch.Document
+	docType DocType
 }
 
 type PatchMsg struct {
@@ -0,0 +1,57 @@
+package lines
+
+import "github.com/cszczepaniak/go-istage/patch"
+
+// position is a line of a file, which can be found again in a document computed differently, such as with more context.
+type position struct {
+	path   string
+	oldNum int
+	newNum int
+}
+
+func (u *UI) cursorPosition() (position, bool) {
+	idx := u.currentLineIndex()
+	e, ok := u.doc.FindEntry(idx)
+	if !ok {
+		return position{}, false
+	}
+
+	oldNum, newNum := u.doc.LineNumbers(idx)
+	return position{
+		path:   entryPath(e),
+		oldNum: oldNum,
+		newNum: newNum,
+	}, true
+}
+
+// restorePosition moves the cursor to the line at the given position, or the closest line after it in the same file.
+func (u *UI) restorePosition(p position) {
+	for _, e := range u.doc.Entries {
+		if entryPath(e) != p.path {
+			continue
+		}
+
+		target := e.LineStart()
+		for i := e.LineStart(); i < e.LineEnd(); i++ {
+			oldNum, newNum := u.doc.LineNumbers(i)
+			if oldNum == 0 && newNum == 0 {
+				continue
+			}
+			if oldNum == p.oldNum && newNum == p.newNum {
+				target = i
+				break
+			}
+			if p.newNum > 0 && newNum >= p.newNum || p.newNum == 0 && oldNum >= p.oldNum {
+				target = i
+				break
+			}
+		}
+
+		u.side = leftSide
+		if u.split && u.doc.Lines[target].Kind == patch.AdditionLine {
+			u.side = rightSide
+		}
+		u.jumpToLine(target)
+		return
+	}
+}
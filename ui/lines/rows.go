@@ -0,0 +1,76 @@
+package lines
+
+import "github.com/cszczepaniak/go-istage/patch"
+
+// row is a single line of the view, pointing at the document lines it shows. In the unified layout every row shows one
+// line of the document on both sides. In the split layout a row can show a removal on the left and the addition that
+// replaced it on the right; a side without a line is -1.
+type row struct {
+	left  int
+	right int
+}
+
+func (r row) isShared() bool {
+	return r.left == r.right
+}
+
+func (r row) contains(lineIndex int) bool {
+	return r.left == lineIndex || r.right == lineIndex
+}
+
+func unifiedRows(doc patch.Document) []row {
+	rows := make([]row, 0, len(doc.Lines))
+	for i := range doc.Lines {
+		rows = append(rows, row{left: i, right: i})
+	}
+	return rows
+}
+
+// splitRows lines up each run of removals in a hunk with the run of additions after it, so that the old content ends
+// up on the left and the new content on the right.
+func splitRows(doc patch.Document) []row {
+	rows := make([]row, 0, len(doc.Lines))
+
+	var removals, additions []int
+	flush := func() {
+		for i := 0; i < len(removals) || i < len(additions); i++ {
+			r := row{left: -1, right: -1}
+			if i < len(removals) {
+				r.left = removals[i]
+			}
+			if i < len(additions) {
+				r.right = additions[i]
+			}
+			rows = append(rows, r)
+		}
+		removals = removals[:0]
+		additions = additions[:0]
+	}
+
+	prevKind := patch.ContextLine
+	for i, l := range doc.Lines {
+		kind := l.Kind
+		if kind == patch.NoEndOfLineLine {
+			// The marker belongs to whichever side the line before it is on.
+			kind = prevKind
+		}
+
+		switch kind {
+		case patch.RemovalLine:
+			if len(additions) > 0 {
+				flush()
+			}
+			removals = append(removals, i)
+		case patch.AdditionLine:
+			additions = append(additions, i)
+		default:
+			flush()
+			rows = append(rows, row{left: i, right: i})
+		}
+
+		prevKind = kind
+	}
+	flush()
+
+	return rows
+}
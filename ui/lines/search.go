@@ -0,0 +1,81 @@
+package lines
+
+import (
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/cszczepaniak/go-istage/ui/search"
+)
+
+// CapturesInput returns whether every key should go to the view, because a search query is being typed.
+func (u *UI) CapturesInput() bool {
+	return u.search.Typing()
+}
+
+func (u *UI) startSearch(backward bool) tea.Cmd {
+	if u.window == nil {
+		return nil
+	}
+
+	u.searchOrigin = u.window.AbsoluteIndex(u.cursor)
+
+	// The query is typed on the last line of the view.
+	if u.h > 1 {
+		u.window.Resize(u.h - 1)
+	}
+	if len(u.rows) > 0 && u.window.RelativeIndex(u.searchOrigin) < 0 {
+		u.jumpToRow(u.searchOrigin)
+	}
+
+	return u.search.Start(backward)
+}
+
+func (u *UI) updateSearch(msg tea.KeyMsg) tea.Cmd {
+	ev, cmd := u.search.Update(msg)
+	switch ev {
+	case search.QueryChanged:
+		if !u.jumpToMatch(u.searchOrigin, false) {
+			u.jumpToRow(u.searchOrigin)
+		}
+	case search.Confirmed:
+		u.window.Resize(u.h)
+	case search.Cancelled:
+		u.window.Resize(u.h)
+		u.jumpToRow(u.searchOrigin)
+	}
+	return cmd
+}
+
+// nextMatch moves to the next match after the cursor, or the previous one if reverse is set.
+func (u *UI) nextMatch(reverse bool) {
+	if u.window == nil || len(u.rows) == 0 {
+		return
+	}
+
+	step := 1
+	if u.search.Backward() != reverse {
+		step = -1
+	}
+	u.jumpToMatch(u.window.AbsoluteIndex(u.cursor)+step, reverse)
+}
+
+func (u *UI) jumpToMatch(fromRow int, reverse bool) bool {
+	i, ok := u.search.Next(len(u.rows), fromRow, reverse, u.rowMatches)
+	if !ok {
+		return false
+	}
+
+	r := u.rows[i]
+	if u.split {
+		u.side = leftSide
+		if r.left < 0 || !u.search.Match(u.doc.Lines[r.left].Text) {
+			u.side = rightSide
+		}
+	}
+	u.jumpToRow(i)
+	return true
+}
+
+func (u *UI) rowMatches(i int) bool {
+	r := u.rows[i]
+	return r.left >= 0 && u.search.Match(u.doc.Lines[r.left].Text) ||
+		r.right >= 0 && u.search.Match(u.doc.Lines[r.right].Text)
+}
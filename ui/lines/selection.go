@@ -0,0 +1,123 @@
+package lines
+
+import "sort"
+
+type lineSet map[int]struct{}
+
+func newLineSet(lines ...int) lineSet {
+	s := make(lineSet, len(lines))
+	for _, l := range lines {
+		s[l] = struct{}{}
+	}
+	return s
+}
+
+func (s lineSet) contains(line int) bool {
+	_, ok := s[line]
+	return ok
+}
+
+func (u *UI) clearSelection() {
+	u.marked = lineSet{}
+	u.anchor = -1
+}
+
+// toggleVisualMode starts a range selection at the cursor. Ending it keeps the range marked, so that more lines can be
+// added to the selection elsewhere before it is staged.
+func (u *UI) toggleVisualMode() {
+	if u.anchor < 0 {
+		u.anchor = u.currentLineIndex()
+		return
+	}
+
+	for _, l := range u.visualLines() {
+		u.marked[l] = struct{}{}
+	}
+	u.anchor = -1
+}
+
+func (u *UI) toggleMark() {
+	idx := u.currentLineIndex()
+	if idx < 0 || !u.doc.Lines[idx].Kind.IsAdditionOrRemoval() {
+		return
+	}
+
+	if u.marked.contains(idx) {
+		delete(u.marked, idx)
+	} else {
+		u.marked[idx] = struct{}{}
+	}
+}
+
+// visualLines returns the additions and removals between the anchor of visual mode and the cursor. A folded row stands
+// for everything it hides, so the range has the hidden lines too, and an anchor that was folded away is at its fold.
+func (u *UI) visualLines() []int {
+	if u.anchor < 0 || len(u.rows) == 0 {
+		return nil
+	}
+
+	from := u.window.AbsoluteIndex(u.cursor)
+	to := u.rowOf(u.anchor)
+	if to < 0 {
+		to = from
+	}
+	if from > to {
+		from, to = to, from
+	}
+
+	var lines []int
+	add := func(l int) {
+		if l >= 0 && u.doc.Lines[l].Kind.IsAdditionOrRemoval() {
+			lines = append(lines, l)
+		}
+	}
+	for _, r := range u.rows[from : to+1] {
+		if end, ok := u.folds[r.left]; ok && r.isShared() {
+			for l := r.left; l < end; l++ {
+				add(l)
+			}
+			continue
+		}
+
+		add(r.left)
+		if !r.isShared() {
+			add(r.right)
+		}
+	}
+	return lines
+}
+
+// rowOf returns the row that shows the line, which is the header of its fold if it's folded, or -1 if there is none.
+func (u *UI) rowOf(line int) int {
+	for i, r := range u.rows {
+		if r.contains(line) {
+			return i
+		}
+		if end, ok := u.folds[r.left]; ok && r.isShared() && r.left <= line && line < end {
+			return i
+		}
+	}
+	return -1
+}
+
+// selectedLines returns the marked lines and the lines in the visual range, in document order.
+func (u *UI) selectedLines() []int {
+	set := newLineSet(u.visualLines()...)
+	for l := range u.marked {
+		set[l] = struct{}{}
+	}
+
+	lines := make([]int, 0, len(set))
+	for l := range set {
+		lines = append(lines, l)
+	}
+	sort.Ints(lines)
+	return lines
+}
+
+// takeSelection returns the selected lines and clears the selection.
+func (u *UI) takeSelection() []int {
+	lines := u.selectedLines()
+	u.clearSelection()
+	return lines
+}
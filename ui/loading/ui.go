@@ -1,21 +1,68 @@
 package loading
 
-import tea "github.com/charmbracelet/bubbletea"
+import (
+	"time"
 
-type LoadingView struct{}
+	"github.com/charmbracelet/bubbles/spinner"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// showAfter is how long something must have been running for the spinner to show, so that it doesn't flicker for
+// quick commands.
+const showAfter = 300 * time.Millisecond
+
+// LoadingView says that something is being loaded. Between Start and Stop, it shows a spinner with what is being done.
+type LoadingView struct {
+	spinner spinner.Model
+	label   string
+	since   time.Time
+	running bool
+}
 
 func New() LoadingView {
-	return LoadingView{}
+	return LoadingView{
+		spinner: spinner.New(spinner.WithSpinner(spinner.Dot)),
+	}
+}
+
+// Start shows the spinner with what is being done, and returns the command that animates it if it wasn't running.
+func (lv LoadingView) Start(label string) (LoadingView, tea.Cmd) {
+	lv.label = label
+	if lv.running {
+		return lv, nil
+	}
+
+	lv.running = true
+	lv.since = time.Now()
+	return lv, lv.spinner.Tick
+}
+
+func (lv LoadingView) Stop() LoadingView {
+	lv.running = false
+	return lv
+}
+
+// Shown returns whether the spinner is running and has been for long enough to be seen.
+func (lv LoadingView) Shown() bool {
+	return lv.running && time.Since(lv.since) >= showAfter
 }
 
 func (LoadingView) Init() tea.Cmd {
 	return nil
 }
 
-func (lv LoadingView) Update(tea.Msg) (tea.Model, tea.Cmd) {
+func (lv LoadingView) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if _, ok := msg.(spinner.TickMsg); ok && lv.running {
+		var cmd tea.Cmd
+		lv.spinner, cmd = lv.spinner.Update(msg)
+		return lv, cmd
+	}
 	return lv, nil
 }
 
 func (lv LoadingView) View() string {
-	return `Loading...`
+	if !lv.running {
+		return `Loading...`
+	}
+	return lv.spinner.View() + ` ` + lv.label
 }
@@ -1,6 +1,7 @@
 package ui
 
 import (
+	tea "github.com/charmbracelet/bubbletea"
 	"github.com/cszczepaniak/go-istage/git"
 	"github.com/cszczepaniak/go-istage/patch"
 )
@@ -19,3 +20,8 @@ type filesMsg struct {
 type goToStateMsg struct {
 	state StateVariant
 }
+
+// commandDoneMsg carries the result of a command started with run.
+type commandDoneMsg struct {
+	msg tea.Msg
+}
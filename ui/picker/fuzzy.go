@@ -0,0 +1,78 @@
+package picker
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type match struct {
+	path string
+	// positions are the byte offsets of the matched characters.
+	positions []int
+	score     int
+}
+
+// fuzzyMatch matches the characters of the pattern in order, ignoring case. Consecutive characters and characters at
+// the start of a path segment or word score higher, so that `hand` ranks `api/handler.go` above `api/has_no_doc.go`.
+func fuzzyMatch(pattern, path string) (match, bool) {
+	m := match{
+		path: path,
+	}
+	if pattern == `` {
+		return m, true
+	}
+
+	pattern = strings.ToLower(pattern)
+	// prevEnd is where the previously matched character ended.
+	prevEnd := -1
+	pi := 0
+	for i, r := range path {
+		if pi >= len(pattern) {
+			break
+		}
+
+		pr, size := utf8.DecodeRuneInString(pattern[pi:])
+		if unicode.ToLower(r) != pr {
+			continue
+		}
+
+		m.score++
+		if prevEnd == i {
+			m.score += 5
+		}
+		if i == 0 || strings.ContainsRune(`/_-. `, rune(path[i-1])) {
+			m.score += 3
+		}
+
+		m.positions = append(m.positions, i)
+		prevEnd = i + utf8.RuneLen(r)
+		pi += size
+	}
+
+	if pi < len(pattern) {
+		return match{}, false
+	}
+
+	// Prefer shorter paths when the matches are otherwise equal.
+	m.score = m.score*1000 - len(path)
+	return m, true
+}
+
+func rank(pattern string, paths []string) []match {
+	var res []match
+	for _, p := range paths {
+		if m, ok := fuzzyMatch(pattern, p); ok {
+			res = append(res, m)
+		}
+	}
+
+	sort.SliceStable(res, func(i, j int) bool {
+		if res[i].score != res[j].score {
+			return res[i].score > res[j].score
+		}
+		return res[i].path < res[j].path
+	})
+	return res
+}
@@ -0,0 +1,12 @@
+package picker
+
+// DoneMsg is sent when files have been picked. No paths means the filter should be removed.
+type DoneMsg struct {
+	Paths []string
+}
+
+type CancelMsg struct{}
+
+type filesMsg struct {
+	paths []string
+}
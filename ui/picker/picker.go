@@ -0,0 +1,227 @@
+package picker
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/cursor"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/cszczepaniak/go-istage/git"
+	"github.com/cszczepaniak/go-istage/logging"
+	"github.com/cszczepaniak/go-istage/ui/globalstyles"
+)
+
+type fileGetter interface {
+	GetFiles() ([]git.File, error)
+}
+
+// UI is a fuzzy finder for picking the files the lines views are limited to. Typing narrows down the list, tab marks
+// files, and enter picks the marked files, or the highlighted one if none are marked. Picking with an empty query and
+// nothing marked removes the filter.
+type UI struct {
+	input textinput.Model
+	fg    fileGetter
+
+	paths   []string
+	matches []match
+	marked  map[string]struct{}
+	cursor  int
+
+	h int
+}
+
+func New(fg fileGetter) *UI {
+	input := textinput.New()
+	input.Prompt = `> `
+	input.Placeholder = `filter files`
+	// Blinking would need every message to be passed along to the input, not just keys.
+	input.Cursor.SetMode(cursor.CursorStatic)
+
+	return &UI{
+		input:  input,
+		fg:     fg,
+		marked: map[string]struct{}{},
+	}
+}
+
+func (u *UI) Init() tea.Cmd {
+	return nil
+}
+
+// OnEnter starts picking, with the files of the current filter already marked.
+func (u *UI) OnEnter(current []string) tea.Cmd {
+	u.input.Reset()
+	u.cursor = 0
+	u.marked = map[string]struct{}{}
+	for _, p := range current {
+		u.marked[p] = struct{}{}
+	}
+	u.refilter()
+
+	return tea.Batch(u.input.Focus(), u.UpdateFiles)
+}
+
+// CapturesInput always returns true, since every key is part of the query or picks something.
+func (u *UI) CapturesInput() bool {
+	return true
+}
+
+func (u *UI) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		u.h = msg.Height
+	case filesMsg:
+		u.paths = msg.paths
+		u.refilter()
+	case tea.KeyMsg:
+		switch msg.String() {
+		case `esc`:
+			return u, func() tea.Msg {
+				return CancelMsg{}
+			}
+		case `enter`:
+			return u, u.done(u.picked())
+		case `up`:
+			if u.cursor > 0 {
+				u.cursor--
+			}
+		case `down`:
+			if u.cursor < len(u.matches)-1 {
+				u.cursor++
+			}
+		case `tab`:
+			u.toggleMark()
+		default:
+			var cmd tea.Cmd
+			u.input, cmd = u.input.Update(msg)
+			u.refilter()
+			return u, cmd
+		}
+	case error:
+		logging.Error(msg.Error())
+	}
+	return u, nil
+}
+
+func (u *UI) refilter() {
+	u.matches = rank(u.input.Value(), u.paths)
+	if u.cursor >= len(u.matches) {
+		u.cursor = len(u.matches) - 1
+	}
+	if u.cursor < 0 {
+		u.cursor = 0
+	}
+}
+
+func (u *UI) toggleMark() {
+	if len(u.matches) == 0 {
+		return
+	}
+
+	p := u.matches[u.cursor].path
+	if _, ok := u.marked[p]; ok {
+		delete(u.marked, p)
+	} else {
+		u.marked[p] = struct{}{}
+	}
+}
+
+func (u *UI) picked() []string {
+	if len(u.marked) > 0 {
+		paths := make([]string, 0, len(u.marked))
+		for p := range u.marked {
+			paths = append(paths, p)
+		}
+		sort.Strings(paths)
+		return paths
+	}
+
+	if u.input.Value() == `` || len(u.matches) == 0 {
+		return nil
+	}
+	return []string{u.matches[u.cursor].path}
+}
+
+func (u *UI) done(paths []string) tea.Cmd {
+	return func() tea.Msg {
+		return DoneMsg{
+			Paths: paths,
+		}
+	}
+}
+
+var matchedStyle = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color(`#DAA520`))
+
+func (u *UI) View() string {
+	sb := &strings.Builder{}
+	sb.WriteString(u.input.View())
+	sb.WriteString("\n")
+	fmt.Fprintf(sb, "%d/%d files, %d marked (tab to mark, enter to pick, esc to cancel)\n", len(u.matches), len(u.paths), len(u.marked))
+
+	// Keep the highlighted file in view.
+	height := u.h - 2
+	start := 0
+	if height > 0 && u.cursor >= height {
+		start = u.cursor - height + 1
+	}
+
+	for i := start; i < len(u.matches) && (height <= 0 || i < start+height); i++ {
+		m := u.matches[i]
+
+		mark := `  `
+		if _, ok := u.marked[m.path]; ok {
+			mark = `✓ `
+		}
+
+		line := mark + renderMatch(m)
+		if i == u.cursor {
+			line = globalstyles.SelectedBackground.Render(line)
+		}
+		sb.WriteString(line)
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+func renderMatch(m match) string {
+	sb := &strings.Builder{}
+	prev := 0
+	for _, pos := range m.positions {
+		sb.WriteString(m.path[prev:pos])
+
+		end := pos + 1
+		for end < len(m.path) && !utf8RuneStart(m.path[end]) {
+			end++
+		}
+		sb.WriteString(matchedStyle.Render(m.path[pos:end]))
+		prev = end
+	}
+	sb.WriteString(m.path[prev:])
+	return sb.String()
+}
+
+func utf8RuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+func (u *UI) UpdateFiles() tea.Msg {
+	files, err := u.fg.GetFiles()
+	if err != nil {
+		return err
+	}
+
+	// A file can be both staged and unstaged.
+	seen := make(map[string]struct{}, len(files))
+	paths := make([]string, 0, len(files))
+	for _, f := range files {
+		if _, ok := seen[f.Path]; ok {
+			continue
+		}
+		seen[f.Path] = struct{}{}
+		paths = append(paths, f.Path)
+	}
+	return filesMsg{paths: paths}
+}
@@ -0,0 +1,81 @@
+package picker
+
+import (
+	"testing"
+
+	"github.com/cszczepaniak/go-istage/git"
+	"github.com/cszczepaniak/go-istage/logging"
+	"github.com/cszczepaniak/go-istage/ui/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testFileGetter []git.File
+
+func (fg testFileGetter) GetFiles() ([]git.File, error) {
+	return []git.File(fg), nil
+}
+
+func TestRank(t *testing.T) {
+	paths := []string{
+		`api/has_no_doc.go`,
+		`api/handler.go`,
+		`cmd/main.go`,
+		`README.md`,
+	}
+
+	var got []string
+	for _, m := range rank(`hand`, paths) {
+		got = append(got, m.path)
+	}
+	assert.Equal(t, []string{`api/handler.go`, `api/has_no_doc.go`}, got)
+
+	m, ok := fuzzyMatch(`RM`, `README.md`)
+	require.True(t, ok)
+	assert.Equal(t, []int{0, 4}, m.positions)
+
+	_, ok = fuzzyMatch(`mian`, `cmd/main.go`)
+	assert.False(t, ok)
+
+	assert.Len(t, rank(``, paths), len(paths))
+}
+
+func TestPick(t *testing.T) {
+	err := logging.Init(logging.Config{})
+	require.NoError(t, err)
+
+	files := testFileGetter{
+		{Path: `a/one.go`},
+		{Path: `a/two.go`},
+		{Path: `b/three.go`},
+		{Path: `a/one.go`},
+	}
+
+	p := testutils.InitializeModel(t, New(files))
+	p.OnEnter(nil)
+	_, _ = p.Update(p.UpdateFiles())
+	assert.Equal(t, []string{`a/one.go`, `a/two.go`, `b/three.go`}, p.paths)
+
+	// Nothing typed and nothing marked removes the filter.
+	_, msg := testutils.ExecKeyPress(p, `enter`)
+	assert.Equal(t, DoneMsg{}, msg)
+
+	for _, r := range `two` {
+		p = testutils.ExecKeyPressCycle(p, string(r))
+	}
+	_, msg = testutils.ExecKeyPress(p, `enter`)
+	assert.Equal(t, DoneMsg{Paths: []string{`a/two.go`}}, msg)
+
+	// Marked files win over the highlighted one.
+	p.OnEnter([]string{`b/three.go`})
+	for _, r := range `one` {
+		p = testutils.ExecKeyPressCycle(p, string(r))
+	}
+	p = testutils.ExecKeyPressCycle(p, `tab`)
+	p = testutils.ExecKeyPressCycle(p, `down`)
+	_, msg = testutils.ExecKeyPress(p, `enter`)
+	assert.Equal(t, DoneMsg{Paths: []string{`a/one.go`, `b/three.go`}}, msg)
+
+	_, msg = testutils.ExecKeyPress(p, `esc`)
+	assert.Equal(t, CancelMsg{}, msg)
+}
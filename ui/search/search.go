@@ -0,0 +1,144 @@
+package search
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/charmbracelet/bubbles/cursor"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+type Event int
+
+const (
+	NoEvent Event = iota
+	// QueryChanged is sent for every key typed into the query, so that views can search incrementally.
+	QueryChanged
+	Confirmed
+	Cancelled
+)
+
+// Span is a match, as a range of byte offsets into the searched text.
+type Span struct {
+	Start int
+	End   int
+}
+
+// Search reads a query from the user and finds where it matches. The query is case-insensitive unless it contains an
+// upper case letter.
+type Search struct {
+	input    textinput.Model
+	typing   bool
+	backward bool
+	query    string
+}
+
+func New() Search {
+	input := textinput.New()
+	// Blinking would need the view to pass every message along to the input, not just keys.
+	input.Cursor.SetMode(cursor.CursorStatic)
+	return Search{
+		input: input,
+	}
+}
+
+// Start starts reading a query. Backward searches go up instead of down.
+func (s *Search) Start(backward bool) tea.Cmd {
+	s.typing = true
+	s.backward = backward
+	s.query = ``
+
+	s.input.Prompt = `/`
+	if backward {
+		s.input.Prompt = `?`
+	}
+	s.input.Reset()
+	return s.input.Focus()
+}
+
+// Typing returns whether the query is being typed, in which case every key should go to Update.
+func (s *Search) Typing() bool {
+	return s.typing
+}
+
+func (s *Search) Update(msg tea.KeyMsg) (Event, tea.Cmd) {
+	switch msg.String() {
+	case `enter`:
+		s.stop()
+		return Confirmed, nil
+	case `esc`:
+		s.stop()
+		s.query = ``
+		return Cancelled, nil
+	}
+
+	var cmd tea.Cmd
+	s.input, cmd = s.input.Update(msg)
+	if s.input.Value() == s.query {
+		return NoEvent, cmd
+	}
+
+	s.query = s.input.Value()
+	return QueryChanged, cmd
+}
+
+func (s *Search) stop() {
+	s.typing = false
+	s.input.Blur()
+}
+
+func (s *Search) Backward() bool {
+	return s.backward
+}
+
+func (s *Search) View() string {
+	return s.input.View()
+}
+
+func (s *Search) Matches(text string) []Span {
+	q := s.query
+	if q == `` {
+		return nil
+	}
+	fold := strings.ToLower(q) == q
+
+	var res []Span
+	for i := 0; i+len(q) <= len(text); {
+		candidate := text[i : i+len(q)]
+		if fold && strings.EqualFold(candidate, q) || candidate == q {
+			res = append(res, Span{Start: i, End: i + len(q)})
+			i += len(q)
+			continue
+		}
+
+		_, size := utf8.DecodeRuneInString(text[i:])
+		i += size
+	}
+	return res
+}
+
+func (s *Search) Match(text string) bool {
+	return len(s.Matches(text)) > 0
+}
+
+// Next returns the first of n items that matches, starting at from and going in the direction of the search, or the
+// opposite direction if reverse is set. It wraps around at either end.
+func (s *Search) Next(n, from int, reverse bool, match func(i int) bool) (int, bool) {
+	if s.query == `` || n == 0 {
+		return 0, false
+	}
+
+	step := 1
+	if s.backward != reverse {
+		step = -1
+	}
+
+	for i := 0; i < n; i++ {
+		idx := ((from+i*step)%n + n) % n
+		if match(idx) {
+			return idx, true
+		}
+	}
+	return 0, false
+}
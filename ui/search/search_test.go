@@ -0,0 +1,71 @@
+package search
+
+import (
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/stretchr/testify/assert"
+)
+
+func typeQuery(s *Search, q string) {
+	for _, r := range q {
+		s.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+	}
+}
+
+func TestMatches(t *testing.T) {
+	s := New()
+	s.Start(false)
+	assert.True(t, s.Typing())
+
+	typeQuery(&s, `foo`)
+	assert.Equal(t, []Span{{Start: 0, End: 3}, {Start: 7, End: 10}}, s.Matches(`foo()  FOO`))
+
+	// Upper case makes the search case-sensitive.
+	s.Start(false)
+	typeQuery(&s, `FOO`)
+	assert.Equal(t, []Span{{Start: 7, End: 10}}, s.Matches(`foo()  FOO`))
+
+	ev, _ := s.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	assert.Equal(t, Confirmed, ev)
+	assert.False(t, s.Typing())
+	assert.True(t, s.Match(`a FOO`))
+
+	s.Start(false)
+	typeQuery(&s, `x`)
+	ev, _ = s.Update(tea.KeyMsg{Type: tea.KeyEsc})
+	assert.Equal(t, Cancelled, ev)
+	assert.False(t, s.Match(`x`))
+}
+
+func TestNext(t *testing.T) {
+	items := []string{`a`, `b`, `a`, `c`, `a`}
+	match := func(i int) bool {
+		return items[i] == `a`
+	}
+
+	s := New()
+	s.Start(false)
+	typeQuery(&s, `a`)
+
+	idx, ok := s.Next(len(items), 1, false, match)
+	assert.True(t, ok)
+	assert.Equal(t, 2, idx)
+
+	idx, _ = s.Next(len(items), 1, true, match)
+	assert.Equal(t, 0, idx)
+
+	// Wraps around.
+	idx, _ = s.Next(len(items), 5, false, match)
+	assert.Equal(t, 0, idx)
+
+	s.Start(true)
+	typeQuery(&s, `a`)
+	idx, _ = s.Next(len(items), 3, false, match)
+	assert.Equal(t, 2, idx)
+	idx, _ = s.Next(len(items), 3, true, match)
+	assert.Equal(t, 4, idx)
+
+	_, ok = s.Next(len(items), 0, false, func(int) bool { return false })
+	assert.False(t, ok)
+}
@@ -2,11 +2,12 @@ package ui
 
 import (
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/cszczepaniak/go-istage/keymap"
 	"github.com/cszczepaniak/go-istage/logging"
 )
 
 func (v view) handleStateChange(msg tea.Msg) (view, tea.Cmd) {
-	event := eventFromMsg(msg)
+	event := v.eventFromMsg(msg)
 	if event == UnknownEvent {
 		return v, nil
 	}
@@ -30,16 +31,20 @@ func (v view) handleStateChange(msg tea.Msg) (view, tea.Cmd) {
 
 type Event int
 
-func eventFromMsg(msg tea.Msg) Event {
+func (v view) eventFromMsg(msg tea.Msg) Event {
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
 		switch msg.String() {
-		case `t`:
+		case v.keys[keymap.ToggleSide]:
 			return ToggleStageEvent
-		case `f`:
+		case v.keys[keymap.ToggleView]:
 			return ToggleDiffEvent
-		case `c`:
+		case v.keys[keymap.Commit]:
 			return StartCommitEvent
+		case v.keys[keymap.FilterFiles]:
+			return FilterFilesEvent
+		case v.keys[keymap.ToggleCombined]:
+			return ToggleCombinedEvent
 		}
 	}
 	return UnknownEvent
@@ -50,6 +55,8 @@ const (
 	ToggleStageEvent
 	ToggleDiffEvent
 	StartCommitEvent
+	FilterFilesEvent
+	ToggleCombinedEvent
 )
 
 type StateVariant int
@@ -61,6 +68,8 @@ const (
 	ViewStagedFiles
 	Committing
 	Error
+	FilteringFiles
+	ViewCombined
 )
 
 var stateMap = map[Event]map[StateVariant]StateVariant{
@@ -71,6 +80,8 @@ var stateMap = map[Event]map[StateVariant]StateVariant{
 		ViewStagedFiles:   ViewUnstagedFiles,
 		Committing:        Committing,
 		Error:             Error,
+		FilteringFiles:    FilteringFiles,
+		ViewCombined:      ViewCombined,
 	},
 	ToggleDiffEvent: {
 		ViewUnstagedLines: ViewUnstagedFiles,
@@ -79,6 +90,8 @@ var stateMap = map[Event]map[StateVariant]StateVariant{
 		ViewStagedFiles:   ViewStagedLines,
 		Committing:        Committing,
 		Error:             Error,
+		FilteringFiles:    FilteringFiles,
+		ViewCombined:      ViewUnstagedFiles,
 	},
 	StartCommitEvent: {
 		ViewUnstagedLines: Committing,
@@ -87,6 +100,28 @@ var stateMap = map[Event]map[StateVariant]StateVariant{
 		ViewStagedFiles:   Committing,
 		Committing:        Committing,
 		Error:             Error,
+		FilteringFiles:    FilteringFiles,
+		ViewCombined:      Committing,
+	},
+	FilterFilesEvent: {
+		ViewUnstagedLines: FilteringFiles,
+		ViewUnstagedFiles: ViewUnstagedFiles,
+		ViewStagedLines:   FilteringFiles,
+		ViewStagedFiles:   ViewStagedFiles,
+		Committing:        Committing,
+		Error:             Error,
+		FilteringFiles:    FilteringFiles,
+		ViewCombined:      FilteringFiles,
+	},
+	ToggleCombinedEvent: {
+		ViewUnstagedLines: ViewCombined,
+		ViewUnstagedFiles: ViewCombined,
+		ViewStagedLines:   ViewCombined,
+		ViewStagedFiles:   ViewCombined,
+		Committing:        Committing,
+		Error:             Error,
+		FilteringFiles:    FilteringFiles,
+		ViewCombined:      ViewUnstagedLines,
 	},
 }
 
@@ -99,6 +134,46 @@ func (sv StateVariant) Next(event Event) StateVariant {
 	return nextState
 }
 
+// IsBrowsing returns whether the state shows changes that can be staged, unstaged or reset.
+func (sv StateVariant) IsBrowsing() bool {
+	switch sv {
+	case ViewUnstagedLines, ViewUnstagedFiles, ViewStagedLines, ViewStagedFiles, ViewCombined:
+		return true
+	}
+	return false
+}
+
+// showsLines returns whether the state shows the lines of the changes.
+func (sv StateVariant) showsLines() bool {
+	switch sv {
+	case ViewUnstagedLines, ViewStagedLines, ViewCombined:
+		return true
+	}
+	return false
+}
+
+func (sv StateVariant) keyContext() keymap.Context {
+	switch sv {
+	case ViewUnstagedLines:
+		return keymap.UnstagedLines
+	case ViewUnstagedFiles:
+		return keymap.UnstagedFiles
+	case ViewStagedLines:
+		return keymap.StagedLines
+	case ViewStagedFiles:
+		return keymap.StagedFiles
+	case Committing:
+		return keymap.Committing
+	case Error:
+		return keymap.Error
+	case FilteringFiles:
+		return keymap.Filtering
+	case ViewCombined:
+		return keymap.Combined
+	}
+	panic(`unreachable`)
+}
+
 func (sv StateVariant) Model(v view) tea.Model {
 	switch sv {
 	case ViewUnstagedLines:
@@ -113,6 +188,10 @@ func (sv StateVariant) Model(v view) tea.Model {
 		return v.commitView
 	case Error:
 		return v.errorView
+	case FilteringFiles:
+		return v.pickerView
+	case ViewCombined:
+		return v.combinedView
 	}
 	panic(`unreachable`)
 }
@@ -131,6 +210,10 @@ func (sv StateVariant) OnEnter(v view) tea.Cmd {
 		return v.commitView.OnEnter()
 	case Error:
 		return nil
+	case FilteringFiles:
+		return v.pickerView.OnEnter(v.fileFilter)
+	case ViewCombined:
+		return v.combinedView.OnEnter()
 	}
 	panic(`unreachable`)
 }
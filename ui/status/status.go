@@ -0,0 +1,125 @@
+package status
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/cszczepaniak/go-istage/git"
+	"github.com/cszczepaniak/go-istage/ui/globalstyles"
+)
+
+type InfoMsg struct {
+	Root     string
+	Branch   git.BranchInfo
+	Unstaged git.DiffStats
+	Staged   git.DiffStats
+}
+
+// UI is the bar at the top of the screen. It isn't a screen of its own, so it renders whatever mode it is given.
+type UI struct {
+	info   InfoMsg
+	loaded bool
+	w      int
+}
+
+func New() *UI {
+	return &UI{}
+}
+
+func (u *UI) Update(msg tea.Msg) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		u.w = msg.Width
+	case InfoMsg:
+		u.info = msg
+		u.loaded = true
+	}
+}
+
+var (
+	barStyle    = lipgloss.NewStyle().Background(lipgloss.Color(`#303030`)).Foreground(lipgloss.Color(`#CCCCCC`))
+	branchStyle = lipgloss.NewStyle().Inherit(barStyle).Foreground(lipgloss.Color(`#00FFFF`)).Bold(true)
+	modeStyle   = lipgloss.NewStyle().Inherit(barStyle).Foreground(lipgloss.Color(`#DAA520`))
+	addStyle    = lipgloss.NewStyle().Inherit(barStyle).Inherit(globalstyles.AdditionColor)
+	removeStyle = lipgloss.NewStyle().Inherit(barStyle).Inherit(globalstyles.RemovalColor)
+	sepStyle    = lipgloss.NewStyle().Inherit(barStyle).Foreground(lipgloss.Color(`#777777`))
+)
+
+func (u *UI) View(mode string) string {
+	modePart := modeStyle.Render(mode)
+	if !u.loaded {
+		return u.fit(join(modePart))
+	}
+
+	// When the bar doesn't fit, the counts go first, then the upstream of the branch and the root.
+	root := barStyle.Render(filepath.Base(u.info.Root))
+	unstaged := u.counts(`unstaged`, u.info.Unstaged)
+	staged := u.counts(`staged`, u.info.Staged)
+	layouts := [][]string{
+		{root, u.branch(true), modePart, unstaged, staged},
+		{root, u.branch(true), modePart, unstaged},
+		{root, u.branch(true), modePart},
+		{root, u.branch(false), modePart},
+		{u.branch(false), modePart},
+	}
+	for _, parts := range layouts {
+		if bar := join(parts...); u.w <= 0 || lipgloss.Width(bar) <= u.w {
+			return u.fit(bar)
+		}
+	}
+
+	// Then the branch is shortened to what's left next to the mode.
+	left := u.w - lipgloss.Width(join(``, modePart))
+	if left < 2 {
+		return u.fit(join(modePart))
+	}
+	name := lipgloss.NewStyle().MaxWidth(left-1).Render(u.branchName()) + `…`
+	return u.fit(join(branchStyle.Render(name), modePart))
+}
+
+func join(parts ...string) string {
+	return barStyle.Render(` `) + strings.Join(parts, sepStyle.Render(` │ `))
+}
+
+// fit makes the bar exactly as wide as the screen, cutting off whatever doesn't fit.
+func (u *UI) fit(bar string) string {
+	if u.w <= 0 {
+		return bar
+	}
+	if pad := u.w - lipgloss.Width(bar); pad > 0 {
+		bar += barStyle.Render(strings.Repeat(` `, pad))
+	}
+	return lipgloss.NewStyle().MaxWidth(u.w).Render(bar)
+}
+
+func (u *UI) branch(upstream bool) string {
+	b := u.info.Branch
+
+	res := branchStyle.Render(u.branchName())
+	if upstream && b.Upstream != `` {
+		res += barStyle.Render(fmt.Sprintf(` ↑%d ↓%d %s`, b.Ahead, b.Behind, b.Upstream))
+	}
+	return res
+}
+
+func (u *UI) branchName() string {
+	if u.info.Branch.Detached() {
+		return `HEAD detached at ` + u.info.Branch.Commit
+	}
+	return u.info.Branch.Name
+}
+
+func (u *UI) counts(name string, c git.DiffStats) string {
+	files := `files`
+	if c.Files == 1 {
+		files = `file`
+	}
+
+	return barStyle.Render(fmt.Sprintf(`%s: %d %s `, name, c.Files, files)) +
+		addStyle.Render(fmt.Sprintf(`+%d`, c.Additions)) +
+		barStyle.Render(` `) +
+		removeStyle.Render(fmt.Sprintf(`-%d`, c.Removals))
+}
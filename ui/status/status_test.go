@@ -0,0 +1,67 @@
+package status
+
+import (
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/cszczepaniak/go-istage/git"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestView(t *testing.T) {
+	u := New()
+	u.Update(tea.WindowSizeMsg{Width: 120})
+	assert.Equal(t, 120, lipgloss.Width(u.View(`unstaged lines`)))
+
+	u.Update(InfoMsg{
+		Root: `/src/go-istage`,
+		Branch: git.BranchInfo{
+			Name:     `main`,
+			Upstream: `origin/main`,
+			Ahead:    2,
+		},
+		Unstaged: git.DiffStats{Files: 3, Additions: 10, Removals: 4},
+		Staged:   git.DiffStats{Files: 1, Additions: 1},
+	})
+	assert.Contains(t, u.View(`staged files`),
+		` go-istage │ main ↑2 ↓0 origin/main │ staged files │ unstaged: 3 files +10 -4 │ staged: 1 file +1 -0`)
+
+	u.Update(InfoMsg{
+		Branch: git.BranchInfo{
+			Commit: `abc1234`,
+		},
+	})
+	assert.Contains(t, u.View(`staged files`), `HEAD detached at abc1234`)
+}
+
+func TestViewFitsNarrowScreens(t *testing.T) {
+	u := New()
+	u.Update(InfoMsg{
+		Root: `/src/go-istage`,
+		Branch: git.BranchInfo{
+			Name:     `feature/a-rather-long-branch-name`,
+			Upstream: `origin/feature/a-rather-long-branch-name`,
+			Ahead:    2,
+		},
+		Unstaged: git.DiffStats{Files: 3, Additions: 10, Removals: 4},
+		Staged:   git.DiffStats{Files: 1, Additions: 1},
+	})
+
+	for _, tc := range []struct {
+		w    int
+		want string
+	}{
+		{w: 120, want: ` go-istage │ feature/a-rather-long-branch-name ↑2 ↓0 origin/feature/a-rather-long-branch-name │ staged files`},
+		{w: 70, want: ` go-istage │ feature/a-rather-long-branch-name │ staged files`},
+		{w: 55, want: ` feature/a-rather-long-branch-name │ staged files`},
+		{w: 30, want: ` feature/a-rat… │ staged files`},
+		{w: 10, want: ` staged fi`},
+	} {
+		u.Update(tea.WindowSizeMsg{Width: tc.w})
+		v := u.View(`staged files`)
+		assert.NotContains(t, v, "\n")
+		assert.Equal(t, tc.w, lipgloss.Width(v))
+		assert.Contains(t, v, tc.want)
+	}
+}
@@ -1,19 +1,29 @@
 package ui
 
 import (
+	"errors"
+	"fmt"
+
+	"github.com/charmbracelet/bubbles/spinner"
 	"github.com/charmbracelet/bubbles/textarea"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/cszczepaniak/go-istage/git"
+	"github.com/cszczepaniak/go-istage/keymap"
 	"github.com/cszczepaniak/go-istage/patch"
+	"github.com/cszczepaniak/go-istage/settings"
+	"github.com/cszczepaniak/go-istage/ui/combined"
 	"github.com/cszczepaniak/go-istage/ui/commit"
 	"github.com/cszczepaniak/go-istage/ui/errview"
 	"github.com/cszczepaniak/go-istage/ui/files"
+	"github.com/cszczepaniak/go-istage/ui/help"
 	"github.com/cszczepaniak/go-istage/ui/lines"
 	"github.com/cszczepaniak/go-istage/ui/loading"
+	"github.com/cszczepaniak/go-istage/ui/picker"
+	"github.com/cszczepaniak/go-istage/ui/status"
 )
 
-func RunUI(p patcher, u docUpdater, ge gitExecer, fs fileStager) error {
-	v := newView(p, u, ge, fs)
+func RunUI(p patcher, u docUpdater, fs fileStager, b git.Backend, keys keymap.Keymap) error {
+	v := newView(p, u, fs, b, keys)
 	prog := tea.NewProgram(v)
 	_, err := prog.Run()
 	return err
@@ -21,11 +31,13 @@ func RunUI(p patcher, u docUpdater, ge gitExecer, fs fileStager) error {
 
 type patcher interface {
 	ApplyPatch(dir patch.Direction, doc patch.Document, selectedLines []int) error
+	Undo() error
+	Redo() error
 }
 
 type fileStager interface {
-	StageFile(file git.File) error
-	UnstageFile(file git.File) error
+	StageFiles(files []git.File) error
+	UnstageFiles(files []git.File) error
 }
 
 type docUpdater interface {
@@ -33,17 +45,27 @@ type docUpdater interface {
 	UnstagedChanges() (patch.Document, error)
 	StagedFiles() ([]git.File, error)
 	UnstagedFiles() ([]git.File, error)
+	StagedStats() (git.DiffStats, error)
+	UnstagedStats() (git.DiffStats, error)
+	ToggleFullFile() bool
+	ChangeContext(delta int) (settings.Settings, error)
+	ChangeInterhunk(delta int) (settings.Settings, error)
+	CycleWhitespace() (settings.Settings, error)
+	DiffSettings() settings.Settings
 }
 
-type gitExecer interface {
-	Exec(cmd string) *git.GitExecBuilder
+// inputCapturer is implemented by views that sometimes need every key, like when text is being typed.
+type inputCapturer interface {
+	CapturesInput() bool
 }
 
 type view struct {
 	patcher    patcher
 	updater    docUpdater
-	gitExecer  gitExecer
 	fileStager fileStager
+	backend    git.Backend
+
+	keys keymap.Keymap
 
 	prevState StateVariant
 	state     StateVariant
@@ -56,81 +78,158 @@ type view struct {
 	stagedFilesView   *files.UI
 	unstagedFilesView *files.UI
 
+	// combinedView has lines views of its own, so that the full screen ones keep their size and position.
+	combinedView *combined.UI
+
 	commitView *commit.UI
 
 	errorView *errview.UI
 
+	// fileFilter holds the paths both lines views are limited to.
+	pickerView *picker.UI
+	fileFilter []string
+
+	fullFile     bool
+	diffSettings settings.Settings
+
+	helpView *help.UI
+	showHelp bool
+
+	statusView *status.UI
+
+	// commandView shows what the running commands are doing, and running counts them.
+	commandView loading.LoadingView
+	running     int
+
 	h, w int
 }
 
-func newView(p patcher, u docUpdater, ge gitExecer, fs fileStager) view {
+func newView(p patcher, u docUpdater, fs fileStager, b git.Backend, keys keymap.Keymap) view {
 	v := view{
 		patcher:      p,
 		updater:      u,
-		gitExecer:    ge,
 		fileStager:   fs,
+		backend:      b,
+		keys:         keys,
 		currentModel: loading.New(),
+		commandView:  loading.New(),
+		diffSettings: u.DiffSettings(),
 	}
 
+	stagedCfg := linesConfig(keys, keys[keymap.UnstageLine], keys[keymap.UnstageHunk])
 	v.stagedLinesView = lines.New(
 		lines.Staged,
 		getDocFunc(v.updater.StagedChanges),
-		lines.Config{
-			HandleLineKey: unstageLineKey,
-			HandleHunkKey: unstageHunkKey,
-		},
+		stagedCfg,
 		v.h,
 	)
 
+	unstagedCfg := linesConfig(keys, keys[keymap.StageLine], keys[keymap.StageHunk])
+	unstagedCfg.CanReset = true
+	unstagedCfg.ResetLineKey = keys[keymap.ResetLine]
+	unstagedCfg.ResetHunkKey = keys[keymap.ResetHunk]
 	v.unstagedLinesView = lines.New(
 		lines.Unstaged,
 		getDocFunc(v.updater.UnstagedChanges),
-		lines.Config{
-			HandleLineKey: stageLineKey,
-			HandleHunkKey: stageHunkKey,
+		unstagedCfg,
+		v.h,
+	)
 
-			CanReset:     true,
-			ResetLineKey: resetLineKey,
-			ResetHunkKey: resetHunkKey,
+	v.combinedView = combined.New(
+		lines.New(lines.Unstaged, getDocFunc(v.updater.UnstagedChanges), unstagedCfg, v.h),
+		lines.New(lines.Staged, getDocFunc(v.updater.StagedChanges), stagedCfg, v.h),
+		combined.KeyConfig{
+			SwitchFocusKey: keys[keymap.ToggleSide],
 		},
-		v.h,
 	)
 
 	v.stagedFilesView = files.NewView(
 		files.Staged,
-		files.KeyConfig{
-			HandleFileKey: unstageLineKey,
-		},
+		filesConfig(keys, keys[keymap.UnstageFile]),
 		getFilesFunc(v.updater.StagedFiles),
 		v.h,
 	)
 
 	v.unstagedFilesView = files.NewView(
 		files.Unstaged,
-		files.KeyConfig{
-			HandleFileKey: stageLineKey,
-		},
+		filesConfig(keys, keys[keymap.StageFile]),
 		getFilesFunc(v.updater.UnstagedFiles),
 		v.h,
 	)
 
-	v.commitView = commit.New()
+	v.commitView = commit.New(commit.KeyConfig{
+		CommitKey: keys[keymap.ConfirmCommit],
+	})
+
+	v.errorView = errview.New(errview.KeyConfig{
+		QuitKey:    keys[keymap.Quit],
+		DismissKey: keys[keymap.Dismiss],
+	})
+
+	v.pickerView = picker.New(getFilesFunc(func() ([]git.File, error) {
+		unstaged, err := u.UnstagedFiles()
+		if err != nil {
+			return nil, err
+		}
+		staged, err := u.StagedFiles()
+		if err != nil {
+			return nil, err
+		}
+		return append(unstaged, staged...), nil
+	}))
 
-	v.errorView = errview.New()
+	v.helpView = help.New()
+
+	v.statusView = status.New()
 
 	v.state = ViewUnstagedLines
 	v.currentModel = v.state.Model(v)
 	return v
 }
 
-const (
-	stageLineKey   = "s"
-	stageHunkKey   = "S"
-	unstageLineKey = "u"
-	unstageHunkKey = "U"
-	resetLineKey   = "r"
-	resetHunkKey   = "R"
-)
+func linesConfig(keys keymap.Keymap, handleLineKey, handleHunkKey string) lines.Config {
+	return lines.Config{
+		QuitKey:     keys[keymap.Quit],
+		UpKey:       keys[keymap.Up],
+		DownKey:     keys[keymap.Down],
+		PrevHunkKey: keys[keymap.PrevHunk],
+		NextHunkKey: keys[keymap.NextHunk],
+
+		HandleLineKey: handleLineKey,
+		HandleHunkKey: handleHunkKey,
+
+		ToggleSplitKey: keys[keymap.ToggleSplit],
+		SwitchSideKey:  keys[keymap.SwitchSide],
+
+		FoldHunkKey: keys[keymap.FoldHunk],
+		FoldFileKey: keys[keymap.FoldFile],
+
+		VisualModeKey:     keys[keymap.VisualMode],
+		ToggleMarkKey:     keys[keymap.ToggleMark],
+		ClearSelectionKey: keys[keymap.ClearSelection],
+
+		SearchForwardKey:  keys[keymap.SearchForward],
+		SearchBackwardKey: keys[keymap.SearchBackward],
+		NextMatchKey:      keys[keymap.NextMatch],
+		PrevMatchKey:      keys[keymap.PrevMatch],
+	}
+}
+
+func filesConfig(keys keymap.Keymap, handleFileKey string) files.KeyConfig {
+	return files.KeyConfig{
+		QuitKey: keys[keymap.Quit],
+		UpKey:   keys[keymap.Up],
+		DownKey: keys[keymap.Down],
+
+		HandleFileKey: handleFileKey,
+		ToggleDirKey:  keys[keymap.ToggleDir],
+
+		SearchForwardKey:  keys[keymap.SearchForward],
+		SearchBackwardKey: keys[keymap.SearchBackward],
+		NextMatchKey:      keys[keymap.NextMatch],
+		PrevMatchKey:      keys[keymap.PrevMatch],
+	}
+}
 
 func (v view) Init() tea.Cmd {
 	return tea.Batch(
@@ -139,6 +238,7 @@ func (v view) Init() tea.Cmd {
 		v.stagedFilesView.Init(),
 		v.unstagedFilesView.Init(),
 		v.errorView.Init(),
+		v.updateStatus,
 		textarea.Blink,
 	)
 }
@@ -146,42 +246,143 @@ func (v view) Init() tea.Cmd {
 func (v view) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
-		switch msg.String() {
-		case "ctrl+c":
+		if msg.String() == "ctrl+c" {
 			return v, tea.Quit
 		}
+
+		// Checked before anything else takes the key, since a command can be running on any screen, like a commit.
+		if v.running > 0 && msg.String() == v.keys[keymap.CancelCommand] {
+			v.backend.CancelCommands()
+			return v, nil
+		}
+
+		if m, ok := v.currentModel.(inputCapturer); ok && m.CapturesInput() {
+			_, cmd := v.currentModel.Update(msg)
+			return v, cmd
+		}
+
+		if v.showHelp {
+			// The help covers the whole screen, so it takes every key until it's closed.
+			switch msg.String() {
+			case v.keys[keymap.Help], "esc", "q":
+				v.showHelp = false
+			}
+			return v, nil
+		}
+
+		switch msg.String() {
+		case v.keys[keymap.Help]:
+			if v.state != Committing {
+				ctx := v.state.keyContext()
+				v.helpView.SetBindings(`Keys for the `+ctx.String()+` view`, v.keys.Bindings(ctx))
+				v.showHelp = true
+				return v, nil
+			}
+		case v.keys[keymap.Undo]:
+			if v.state.IsBrowsing() {
+				return v.run(`Undoing`, v.undo())
+			}
+		case v.keys[keymap.Redo]:
+			if v.state.IsBrowsing() {
+				return v.run(`Redoing`, v.redo())
+			}
+		case v.keys[keymap.ToggleFullFile]:
+			if v.state.showsLines() {
+				v.fullFile = v.updater.ToggleFullFile()
+				return v, reloadLines
+			}
+		case v.keys[keymap.MoreContext]:
+			if v.state.showsLines() {
+				return v.changeDiffSettings(v.updater.ChangeContext(1))
+			}
+		case v.keys[keymap.LessContext]:
+			if v.state.showsLines() {
+				return v.changeDiffSettings(v.updater.ChangeContext(-1))
+			}
+		case v.keys[keymap.MoreInterhunk]:
+			if v.state.showsLines() {
+				return v.changeDiffSettings(v.updater.ChangeInterhunk(1))
+			}
+		case v.keys[keymap.LessInterhunk]:
+			if v.state.showsLines() {
+				return v.changeDiffSettings(v.updater.ChangeInterhunk(-1))
+			}
+		case v.keys[keymap.IgnoreWhitespace]:
+			if v.state.showsLines() {
+				return v.changeDiffSettings(v.updater.CycleWhitespace())
+			}
+		}
 	case tea.WindowSizeMsg:
-		// We need to let everybody know right away about the window size.
-		v.stagedFilesView.Update(msg)
-		v.unstagedFilesView.Update(msg)
-		v.stagedLinesView.Update(msg)
-		v.unstagedLinesView.Update(msg)
-		v.commitView.Update(msg)
-		v.errorView.Update(msg)
+		v.statusView.Update(msg)
+		v.helpView.Update(msg)
+
+		// We need to let everybody know right away about the window size. The status bar takes up a line.
+		sub := tea.WindowSizeMsg{
+			Width:  msg.Width,
+			Height: msg.Height - 1,
+		}
+		v.stagedFilesView.Update(sub)
+		v.unstagedFilesView.Update(sub)
+		v.stagedLinesView.Update(sub)
+		v.unstagedLinesView.Update(sub)
+		v.combinedView.Update(sub)
+		v.commitView.Update(sub)
+		v.errorView.Update(sub)
+		v.pickerView.Update(sub)
 		v.w = msg.Width
 		v.h = msg.Height
 		return v, nil
 	case lines.PatchMsg:
-		return v, v.handlePatch(msg)
+		return v.run(directionLabels[msg.Direction], v.handlePatch(msg))
 	case lines.ResetMsg:
-		return v, v.handleResetPatch(msg)
+		return v.run(directionLabels[patch.Reset], v.handleResetPatch(msg))
 	case files.HandleFileMsg:
-		return v, v.handleFile(msg)
+		return v.run(directionLabels[msg.Direction], v.handleFile(msg))
 	case commit.DoCommitMsg:
-		return v, v.commit(msg.CommitMessage)
+		return v.run(`Committing`, v.commit(msg.CommitMessage))
+	case commandDoneMsg:
+		return v.commandDone(msg)
+	case spinner.TickMsg:
+		m, cmd := v.commandView.Update(msg)
+		v.commandView = m.(loading.LoadingView)
+		return v, cmd
 	case errview.ExitMsg:
 		// TODO this should be centralized with the other spot we update state.
 		v.state = v.prevState
 		v.prevState = Error
 		v.currentModel = v.state.Model(v)
 		return v, v.state.OnEnter(v)
+	case picker.DoneMsg:
+		v.fileFilter = msg.Paths
+		v.stagedLinesView.SetFilter(msg.Paths)
+		v.unstagedLinesView.SetFilter(msg.Paths)
+		v.combinedView.SetFilter(msg.Paths)
+		return v, v.goToPrevState
+	case picker.CancelMsg:
+		return v, v.goToPrevState
+	case status.InfoMsg:
+		v.statusView.Update(msg)
+		return v, nil
+	case lines.RefreshMsg, files.RefreshMsg:
+		_, cmd := v.currentModel.Update(msg)
+		return v, tea.Batch(cmd, v.updateStatus)
+	case refreshMsg:
+		return v, tea.Batch(v.state.OnEnter(v), v.updateStatus)
 	case goToStateMsg:
 		// TODO this should be centralized with the other spot we update state.
 		v.prevState = v.state
 		v.state = msg.state
 		v.currentModel = v.state.Model(v)
-		return v, v.state.OnEnter(v)
+		return v, tea.Batch(v.state.OnEnter(v), v.updateStatus)
 	case error:
+		if errors.Is(msg, git.ErrCanceled) {
+			// The user asked for it, so there's nothing to report, but the command may have finished first.
+			return v, tea.Batch(v.state.OnEnter(v), v.updateStatus)
+		}
+		if errors.Is(msg, git.ErrTimeout) {
+			msg = fmt.Errorf("%w\n\nTimeouts can be changed with the -timeout option.", msg)
+		}
+
 		// TODO this should be centralized with the other spot we update state.
 		v.prevState = v.state
 		v.state = Error
@@ -202,6 +403,51 @@ func (v view) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return v, cmd
 }
 
+var whitespaceModes = map[settings.Whitespace]string{
+	settings.IgnoreWhitespaceAtEOL:  `ignoring whitespace at line ends`,
+	settings.IgnoreWhitespaceChange: `ignoring whitespace changes`,
+	settings.IgnoreAllWhitespace:    `ignoring all whitespace`,
+}
+
+func reloadLines() tea.Msg {
+	return lines.ReloadMsg{}
+}
+
+// changeDiffSettings shows the changes again with the new settings. The settings are changed even if they couldn't be
+// saved.
+func (v view) changeDiffSettings(s settings.Settings, err error) (tea.Model, tea.Cmd) {
+	v.diffSettings = s
+	if err != nil {
+		return v, tea.Batch(reloadLines, func() tea.Msg {
+			return err
+		})
+	}
+	return v, reloadLines
+}
+
 func (v view) View() string {
-	return v.currentModel.View()
+	if v.showHelp {
+		return v.helpView.View()
+	}
+	mode := v.state.keyContext().String()
+	if v.fullFile {
+		mode += `, whole files`
+	} else {
+		mode += fmt.Sprintf(`, context %d`, v.diffSettings.ContextLines)
+	}
+	if v.diffSettings.InterhunkLines > 0 {
+		mode += fmt.Sprintf(`, merging hunks %d apart`, v.diffSettings.InterhunkLines)
+	}
+	if ws, ok := whitespaceModes[v.diffSettings.Whitespace]; ok {
+		mode += `, ` + ws
+	}
+	if len(v.fileFilter) == 1 {
+		mode += ` (` + v.fileFilter[0] + `)`
+	} else if len(v.fileFilter) > 1 {
+		mode += fmt.Sprintf(` (%d files)`, len(v.fileFilter))
+	}
+	if v.commandView.Shown() {
+		mode += fmt.Sprintf(`, %s (%s to cancel)`, v.commandView.View(), keymap.DisplayKey(v.keys[keymap.CancelCommand]))
+	}
+	return v.statusView.View(mode) + "\n" + v.currentModel.View()
 }
@@ -0,0 +1,77 @@
+package ui
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/cszczepaniak/go-istage/git"
+	"github.com/cszczepaniak/go-istage/git/gitfake"
+	"github.com/cszczepaniak/go-istage/history"
+	"github.com/cszczepaniak/go-istage/keymap"
+	"github.com/cszczepaniak/go-istage/logging"
+	"github.com/cszczepaniak/go-istage/recovery"
+	"github.com/cszczepaniak/go-istage/services"
+	"github.com/cszczepaniak/go-istage/settings"
+	"github.com/cszczepaniak/go-istage/ui/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestView(t *testing.T, repo *gitfake.Repo) view {
+	require.NoError(t, logging.Init(logging.Config{}))
+	dir := t.TempDir()
+
+	st, err := settings.Open(filepath.Join(dir, `settings.json`))
+	require.NoError(t, err)
+	ds, err := services.NewDocumentService(repo, st)
+	require.NoError(t, err)
+
+	j, err := history.Open(filepath.Join(dir, `history.json`))
+	require.NoError(t, err)
+	ps := services.NewPatchingService(repo, j, recovery.NewStore(filepath.Join(dir, `backups`), repo), ds)
+
+	return testutils.InitializeModel(t, newView(ps, ds, ps, repo, keymap.Default()))
+}
+
+func update(v view, msg tea.Msg) view {
+	m, _ := v.Update(msg)
+	return m.(view)
+}
+
+var cancelKey = tea.KeyMsg{Type: tea.KeyCtrlG}
+
+// pending stands for a command that is still running: the tests deliver its result themselves.
+func pending() tea.Msg {
+	return nil
+}
+
+func TestCancelRunningCommand(t *testing.T) {
+	repo := gitfake.New(`/repo`)
+	v := newTestView(t, repo)
+
+	// Nothing is running, so there is nothing to cancel.
+	v = update(v, cancelKey)
+	assert.Zero(t, repo.Cancels())
+
+	m, _ := v.run(`Staging`, pending)
+	v = update(m.(view), cancelKey)
+	assert.Equal(t, 1, repo.Cancels())
+	assert.Contains(t, v.commandView.View(), `Staging`)
+
+	// The canceled command isn't reported as an error.
+	v = update(v, commandDoneMsg{msg: fmt.Errorf(`failed to stage: %w`, git.ErrCanceled)})
+	assert.Zero(t, v.running)
+	assert.Equal(t, ViewUnstagedLines, v.state)
+}
+
+func TestCommandTimeout(t *testing.T) {
+	v := newTestView(t, gitfake.New(`/repo`))
+
+	m, _ := v.run(`Committing`, pending)
+	v = update(m.(view), commandDoneMsg{msg: fmt.Errorf(`%w: [commit]`, git.ErrTimeout)})
+	assert.Zero(t, v.running)
+	assert.Equal(t, Error, v.state)
+	assert.Contains(t, v.errorView.View(), `-timeout`)
+}